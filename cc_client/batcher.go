@@ -0,0 +1,323 @@
+package cc_client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/tps/tracing"
+	"github.com/cloudfoundry/dropsonde/metrics"
+)
+
+const (
+	appNotificationsBatchPath = "/internal/v4/apps/notifications/batch"
+
+	DefaultBatchMaxSize = 100
+
+	// batchSupportRecheckInterval is how long notifications are sent one by
+	// one after CC turned out not to support the batch endpoint, before the
+	// batch endpoint is tried again.
+	batchSupportRecheckInterval = 10 * time.Minute
+
+	notificationBatchesCounter = "CCNotificationBatches"
+)
+
+// ErrMissingBatchResult is returned for a notification that CC did not report
+// a result for in its response to a batch.
+var ErrMissingBatchResult = errors.New("CC reported no result for the notification")
+
+// errBatchingUnsupported is returned for the notifications of a batch that CC
+// does not support, which are then sent one by one.
+var errBatchingUnsupported = errors.New("CC does not support notification batches")
+
+type BatchConfig struct {
+	// Window is how long notifications are accumulated before they are
+	// delivered as a batch.
+	Window time.Duration
+	// MaxSize is the number of notifications at which a batch is delivered
+	// before its window has passed.
+	MaxSize int
+}
+
+type batchNotification struct {
+	ID             string          `json:"id"`
+	Type           string          `json:"type"`
+	ProcessGuid    string          `json:"process_guid"`
+	IdempotencyKey string          `json:"idempotency_key"`
+	Traceparent    string          `json:"traceparent,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+type batchRequest struct {
+	Notifications []batchNotification `json:"notifications"`
+}
+
+type batchResult struct {
+	ID     string   `json:"id"`
+	Status int      `json:"status"`
+	Error  *ccError `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+type batchItem struct {
+	ctx          context.Context
+	notification batchNotification
+	result       chan error
+}
+
+type batch struct {
+	items []*batchItem
+	full  chan struct{}
+}
+
+// Batcher accumulates the notifications of a client and delivers them in a
+// single request to the batch endpoint of CC, reporting the result of each
+// notification to its sender. While CC does not support the batch endpoint,
+// notifications are sent one by one. A Batcher belongs to a single client.
+// Batch requests are canceled when the Batcher is signalled to stop.
+type Batcher struct {
+	logger lager.Logger
+	clock  clock.Clock
+	config BatchConfig
+	send   func(ctx context.Context, logger lager.Logger, items []*batchItem)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu               sync.Mutex
+	current          *batch
+	unsupportedUntil time.Time
+}
+
+func NewBatcher(logger lager.Logger, clock clock.Clock, config BatchConfig) *Batcher {
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultBatchMaxSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Batcher{
+		logger: logger.Session("cc-batcher"),
+		clock:  clock,
+		config: config,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Run waits until it is signalled and then cancels the batch requests that
+// are in flight.
+func (b *Batcher) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	close(ready)
+	<-signals
+	b.cancel()
+	return nil
+}
+
+func (b *Batcher) supported() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.clock.Now().Before(b.unsupportedUntil)
+}
+
+func (b *Batcher) markUnsupported() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.logger.Info("batching-unsupported", lager.Data{"recheck-in": batchSupportRecheckInterval.String()})
+	b.unsupportedUntil = b.clock.Now().Add(batchSupportRecheckInterval)
+}
+
+// submit adds the notification to the current batch and waits for its
+// result.
+func (b *Batcher) submit(ctx context.Context, notification batchNotification) error {
+	item := &batchItem{ctx: ctx, notification: notification, result: make(chan error, 1)}
+	b.add(item)
+
+	select {
+	case err := <-item.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Batcher) add(item *batchItem) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.current == nil {
+		b.current = &batch{full: make(chan struct{})}
+		go b.await(b.current)
+	}
+
+	item.notification.ID = strconv.Itoa(len(b.current.items))
+	b.current.items = append(b.current.items, item)
+
+	if len(b.current.items) >= b.config.MaxSize {
+		close(b.current.full)
+		b.current = nil
+	}
+}
+
+// await delivers the batch once its window has passed or it is full.
+func (b *Batcher) await(current *batch) {
+	timer := b.clock.NewTimer(b.config.Window)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+	case <-current.full:
+	}
+
+	b.mu.Lock()
+	if b.current == current {
+		b.current = nil
+	}
+	items := current.items
+	b.mu.Unlock()
+
+	b.send(b.ctx, b.logger, items)
+}
+
+// sendBatch delivers the notifications of a batch and hands each of them its
+// result. Notifications whose senders have given up are left out. The request
+// continues the trace of the first notification; the trace of each
+// notification is also sent along with it.
+func (cc *ccClient) sendBatch(ctx context.Context, logger lager.Logger, items []*batchItem) {
+	var traceIDs []string
+	pending := make([]*batchItem, 0, len(items))
+	for _, item := range items {
+		if err := item.ctx.Err(); err != nil {
+			item.result <- err
+			continue
+		}
+		pending = append(pending, item)
+		if span, ok := tracing.FromContext(item.ctx); ok {
+			traceIDs = append(traceIDs, span.TraceID)
+		}
+	}
+	if len(pending) == 0 {
+		// The circuit breaker let the notifications through, so it is told
+		// that none was sent, which releases its probe while it is half-open.
+		logger.Debug("batch-abandoned", lager.Data{"size": len(items)})
+		cc.recordBatch(logger, requestIgnored)
+		return
+	}
+	items = pending
+
+	if span, ok := tracing.FromContext(items[0].ctx); ok {
+		ctx = tracing.NewContext(ctx, span)
+	}
+
+	logger = logger.Session("send-batch", lager.Data{"size": len(items), "trace-ids": traceIDs})
+	metrics.IncrementCounter(notificationBatchesCounter)
+
+	fail := func(err error) {
+		for _, item := range items {
+			item.result <- err
+		}
+	}
+
+	request := batchRequest{Notifications: make([]batchNotification, len(items))}
+	for i, item := range items {
+		request.Notifications[i] = item.notification
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		cc.recordBatch(logger, requestIgnored)
+		fail(err)
+		return
+	}
+
+	response, err := cc.do(ctx, logger, appNotificationsBatchPath, batchIdempotencyKey(items), payload)
+	if err == nil && batchingUnsupported(response.StatusCode) {
+		cc.recordBatch(logger, requestIgnored)
+	} else {
+		cc.recordBatch(logger, outcomeOf(ctx, response, err))
+	}
+	if err != nil {
+		logger.Error("failed-sending-batch", err)
+		fail(err)
+		return
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusOK:
+	case batchingUnsupported(response.StatusCode):
+		cc.batcher.markUnsupported()
+		fail(errBatchingUnsupported)
+		return
+	default:
+		badResponse := newBadResponseError(appNotificationsBatchPath, "", response)
+		for _, item := range items {
+			itemErr := *badResponse
+			itemErr.ProcessGuid = item.notification.ProcessGuid
+			item.result <- &itemErr
+		}
+		return
+	}
+
+	var parsed batchResponse
+	err = json.NewDecoder(response.Body).Decode(&parsed)
+	if err != nil {
+		logger.Error("failed-parsing-batch-response", err)
+		fail(err)
+		return
+	}
+
+	results := make(map[string]batchResult, len(parsed.Results))
+	for _, result := range parsed.Results {
+		results[result.ID] = result
+	}
+
+	for _, item := range items {
+		result, ok := results[item.notification.ID]
+		switch {
+		case !ok:
+			item.result <- ErrMissingBatchResult
+		case result.Status == http.StatusOK:
+			item.result <- nil
+		default:
+			item.result <- newBatchItemError(item.notification, result)
+		}
+	}
+}
+
+// recordBatch records the outcome of a batch request with the circuit breaker,
+// once for all of its notifications.
+func (cc *ccClient) recordBatch(logger lager.Logger, outcome requestOutcome) {
+	if cc.breaker != nil {
+		cc.breaker.record(logger, outcome)
+	}
+}
+
+// batchingUnsupported returns whether CC responded to a batch with a status
+// that means it does not support the batch endpoint.
+func batchingUnsupported(status int) bool {
+	return status == http.StatusNotFound || status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented
+}
+
+func newBatchItemError(notification batchNotification, result batchResult) *BadResponseError {
+	badResponse := &BadResponseError{
+		Endpoint:    appNotificationsBatchPath,
+		ProcessGuid: notification.ProcessGuid,
+		StatusCode:  result.Status,
+	}
+	if result.Error != nil {
+		badResponse.Code = result.Error.Code
+		badResponse.ErrorCode = result.Error.ErrorCode
+		badResponse.Description = result.Error.Description
+	}
+	return badResponse
+}
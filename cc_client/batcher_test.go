@@ -0,0 +1,377 @@
+package cc_client_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	"code.cloudfoundry.org/tps/cc_client"
+	"code.cloudfoundry.org/tps/tracing"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Batcher", func() {
+	var (
+		fakeCC     *ghttp.Server
+		fakeClock  *fakeclock.FakeClock
+		logger     *lagertest.TestLogger
+		config     cc_client.BatchConfig
+		poolConfig cc_client.EndpointPoolConfig
+		pool       *cc_client.EndpointPool
+		breaker    *cc_client.CircuitBreaker
+		batcher    *cc_client.Batcher
+		ccClient   cc_client.CcClient
+		batches    chan []map[string]interface{}
+	)
+
+	const batchPath = "/internal/v4/apps/notifications/batch"
+
+	type notification struct {
+		ID          string          `json:"id"`
+		Type        string          `json:"type"`
+		ProcessGuid string          `json:"process_guid"`
+		Payload     json.RawMessage `json:"payload"`
+	}
+
+	// respondToBatch records the notifications of each batch and responds with
+	// the results returned by results.
+	respondToBatch := func(results func([]notification) []map[string]interface{}) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+
+			var request struct {
+				Notifications []notification `json:"notifications"`
+			}
+			Expect(json.Unmarshal(body, &request)).To(Succeed())
+
+			var recorded []map[string]interface{}
+			Expect(json.Unmarshal(body, &struct {
+				Notifications *[]map[string]interface{} `json:"notifications"`
+			}{&recorded})).To(Succeed())
+			batches <- recorded
+
+			w.Header().Set("Content-Type", "application/json")
+			Expect(json.NewEncoder(w).Encode(map[string]interface{}{"results": results(request.Notifications)})).To(Succeed())
+		}
+	}
+
+	allOK := func(notifications []notification) []map[string]interface{} {
+		results := []map[string]interface{}{}
+		for _, n := range notifications {
+			results = append(results, map[string]interface{}{"id": n.ID, "status": 200})
+		}
+		return results
+	}
+
+	crashWithContext := func(ctx context.Context, guid string) chan error {
+		result := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			result <- ccClient.AppCrashedWithContext(ctx, guid, cc_client.AppCrashedRequest{
+				AppCrashedRequest: cc_messages.AppCrashedRequest{Index: 1},
+			}, logger)
+		}()
+		return result
+	}
+
+	crash := func(guid string) chan error {
+		return crashWithContext(context.Background(), guid)
+	}
+
+	BeforeEach(func() {
+		fakeCC = ghttp.NewServer()
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		logger = lagertest.NewTestLogger("test")
+		config = cc_client.BatchConfig{Window: 100 * time.Millisecond, MaxSize: 10}
+		batches = make(chan []map[string]interface{}, 10)
+		breaker = nil
+		poolConfig = cc_client.EndpointPoolConfig{Routing: cc_client.PriorityRouting}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		pool, err = cc_client.NewEndpointPool(logger, fakeClock, []string{fakeCC.URL()}, nil, poolConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		batcher = cc_client.NewBatcher(logger, fakeClock, config)
+		ccClient = cc_client.NewCcClientWithEndpoints(pool, nil, false, nil, breaker, batcher, nil)
+	})
+
+	AfterEach(func() {
+		fakeCC.Close()
+	})
+
+	Context("when CC supports batches", func() {
+		BeforeEach(func() {
+			config.MaxSize = 2
+			fakeCC.RouteToHandler("POST", batchPath, respondToBatch(allOK))
+		})
+
+		It("delivers a full batch in a single request without waiting for the window", func() {
+			first := crash("guid-1")
+			second := crash("guid-2")
+
+			Eventually(first).Should(Receive(BeNil()))
+			Eventually(second).Should(Receive(BeNil()))
+
+			var batch []map[string]interface{}
+			Expect(batches).To(Receive(&batch))
+			Expect(batch).To(HaveLen(2))
+			Expect(batch).To(ContainElement(And(
+				HaveKeyWithValue("type", "app_crashed"),
+				HaveKeyWithValue("process_guid", "guid-1"),
+				HaveKeyWithValue("idempotency_key", cc_client.IdempotencyKey("guid-1/1", "app_crashed", 0, 0)),
+				HaveKeyWithValue("payload", HaveKeyWithValue("index", BeEquivalentTo(1))),
+			)))
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+			Expect(fakeCC.ReceivedRequests()[0].Header.Get(cc_client.IdempotencyKeyHeader)).NotTo(BeEmpty())
+		})
+
+		It("delivers the notifications of a window once it has passed", func() {
+			result := crash("guid-1")
+			Consistently(result).ShouldNot(Receive())
+			Expect(fakeCC.ReceivedRequests()).To(BeEmpty())
+
+			fakeClock.WaitForWatcherAndIncrement(100 * time.Millisecond)
+			Eventually(result).Should(Receive(BeNil()))
+			Expect(batches).To(Receive(HaveLen(1)))
+		})
+
+		It("continues the trace of the first notification", func() {
+			span := tracing.NewSpan("4bf92f3577b34da6a3ce929d0e0e4736")
+			first := crashWithContext(tracing.NewContext(context.Background(), span), "guid-1")
+			Eventually(fakeClock.WatcherCount).Should(Equal(1))
+			second := crash("guid-2")
+
+			Eventually(first).Should(Receive(BeNil()))
+			Eventually(second).Should(Receive(BeNil()))
+			Expect(fakeCC.ReceivedRequests()[0].Header.Get("traceparent")).To(Equal(span.Traceparent()))
+		})
+
+		It("leaves out notifications whose senders have given up", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			abandoned := crashWithContext(ctx, "guid-1")
+			Eventually(fakeClock.WatcherCount).Should(Equal(1))
+			cancel()
+			Eventually(abandoned).Should(Receive(MatchError(context.Canceled)))
+
+			result := crash("guid-2")
+			Eventually(result).Should(Receive(BeNil()))
+
+			var batch []map[string]interface{}
+			Expect(batches).To(Receive(&batch))
+			Expect(batch).To(ConsistOf(HaveKeyWithValue("process_guid", "guid-2")))
+		})
+	})
+
+	Context("when a batch is abandoned while the circuit breaker is half-open", func() {
+		BeforeEach(func() {
+			breaker = cc_client.NewCircuitBreaker(fakeClock, cc_client.CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Second})
+			fakeCC.RouteToHandler("POST", batchPath, ghttp.RespondWith(http.StatusServiceUnavailable, ""))
+		})
+
+		It("releases the probe", func() {
+			result := crash("guid-1")
+			fakeClock.WaitForWatcherAndIncrement(100 * time.Millisecond)
+			Eventually(result).Should(Receive(HaveOccurred()))
+			Expect(breaker.State()).To(Equal(cc_client.CircuitOpen))
+
+			fakeClock.Increment(time.Second)
+			ctx, cancel := context.WithCancel(context.Background())
+			abandoned := crashWithContext(ctx, "guid-2")
+			Eventually(fakeClock.WatcherCount).Should(Equal(1))
+			Expect(breaker.State()).To(Equal(cc_client.CircuitHalfOpen))
+			cancel()
+			Eventually(abandoned).Should(Receive(MatchError(context.Canceled)))
+
+			fakeClock.WaitForWatcherAndIncrement(100 * time.Millisecond)
+			Eventually(logger).Should(gbytes.Say("batch-abandoned"))
+
+			fakeCC.RouteToHandler("POST", batchPath, respondToBatch(allOK))
+			result = crash("guid-3")
+			fakeClock.WaitForWatcherAndIncrement(100 * time.Millisecond)
+			Eventually(result).Should(Receive(BeNil()))
+			Expect(breaker.State()).To(Equal(cc_client.CircuitClosed))
+		})
+	})
+
+	Context("when the batcher is signalled to stop", func() {
+		var release chan struct{}
+
+		BeforeEach(func() {
+			config.MaxSize = 1
+			release = make(chan struct{})
+			fakeCC.RouteToHandler("POST", batchPath, func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-release:
+				}
+			})
+		})
+
+		AfterEach(func() {
+			close(release)
+		})
+
+		It("cancels the batch request in flight", func() {
+			process := ifrit.Invoke(batcher)
+			result := crash("guid-1")
+			Eventually(fakeCC.ReceivedRequests).Should(HaveLen(1))
+			Consistently(result).ShouldNot(Receive())
+
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+			Eventually(result).Should(Receive(MatchError(ContainSubstring("context canceled"))))
+		})
+	})
+
+	Context("when CC reports results per notification", func() {
+		BeforeEach(func() {
+			fakeCC.RouteToHandler("POST", batchPath, respondToBatch(func(notifications []notification) []map[string]interface{} {
+				var results []map[string]interface{}
+				for _, n := range notifications {
+					switch n.ProcessGuid {
+					case "accepted":
+						results = append(results, map[string]interface{}{"id": n.ID, "status": 200})
+					case "rejected":
+						results = append(results, map[string]interface{}{
+							"id":     n.ID,
+							"status": 422,
+							"error":  map[string]interface{}{"code": 10008, "error_code": "CF-UnprocessableEntity", "description": "bad index"},
+						})
+					}
+				}
+				return results
+			}))
+			config.MaxSize = 3
+		})
+
+		It("hands each sender the result of its notification", func() {
+			accepted := crash("accepted")
+			rejected := crash("rejected")
+			missing := crash("missing")
+
+			Eventually(accepted).Should(Receive(BeNil()))
+
+			var err error
+			Eventually(rejected).Should(Receive(&err))
+			Expect(err).To(BeAssignableToTypeOf(&cc_client.BadResponseError{}))
+			badResponse := err.(*cc_client.BadResponseError)
+			Expect(badResponse.ProcessGuid).To(Equal("rejected"))
+			Expect(badResponse.StatusCode).To(Equal(422))
+			Expect(badResponse.ErrorCode).To(Equal("CF-UnprocessableEntity"))
+			Expect(badResponse.Description).To(Equal("bad index"))
+
+			Eventually(missing).Should(Receive(MatchError(cc_client.ErrMissingBatchResult)))
+		})
+	})
+
+	Context("when CC fails the whole batch", func() {
+		BeforeEach(func() {
+			config.MaxSize = 2
+			fakeCC.RouteToHandler("POST", batchPath, ghttp.RespondWith(http.StatusServiceUnavailable, ""))
+		})
+
+		It("fails every notification of the batch", func() {
+			first := crash("guid-1")
+			second := crash("guid-2")
+
+			var err error
+			Eventually(first).Should(Receive(&err))
+			Expect(err).To(BeAssignableToTypeOf(&cc_client.BadResponseError{}))
+			Expect(err.(*cc_client.BadResponseError).ProcessGuid).To(Equal("guid-1"))
+			Expect(cc_client.IsRetryable(err)).To(BeTrue())
+
+			Eventually(second).Should(Receive(&err))
+			Expect(err.(*cc_client.BadResponseError).ProcessGuid).To(Equal("guid-2"))
+		})
+
+		Context("with a circuit breaker", func() {
+			BeforeEach(func() {
+				breaker = cc_client.NewCircuitBreaker(fakeClock, cc_client.CircuitBreakerConfig{FailureThreshold: 2})
+			})
+
+			It("records the batch as a single failed request", func() {
+				first := crash("guid-1")
+				second := crash("guid-2")
+				Eventually(first).Should(Receive(HaveOccurred()))
+				Eventually(second).Should(Receive(HaveOccurred()))
+				Expect(breaker.State()).To(Equal(cc_client.CircuitClosed))
+
+				first = crash("guid-1")
+				second = crash("guid-2")
+				Eventually(first).Should(Receive(HaveOccurred()))
+				Eventually(second).Should(Receive(HaveOccurred()))
+				Expect(breaker.State()).To(Equal(cc_client.CircuitOpen))
+			})
+		})
+	})
+
+	Context("when CC does not support batches", func() {
+		BeforeEach(func() {
+			fakeCC.RouteToHandler("POST", batchPath, ghttp.RespondWith(http.StatusNotFound, ""))
+			fakeCC.RouteToHandler("POST", "/internal/v4/apps/guid-1/crashed", ghttp.RespondWith(http.StatusOK, `{}`))
+			fakeCC.RouteToHandler("POST", "/internal/v4/apps/guid-2/crashed", ghttp.RespondWith(http.StatusOK, `{}`))
+		})
+
+		batchRequests := func() int {
+			count := 0
+			for _, r := range fakeCC.ReceivedRequests() {
+				if r.URL.Path == batchPath {
+					count++
+				}
+			}
+			return count
+		}
+
+		It("falls back to sending the notifications one by one", func() {
+			result := crash("guid-1")
+			fakeClock.WaitForWatcherAndIncrement(100 * time.Millisecond)
+			Eventually(result).Should(Receive(BeNil()))
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(2))
+
+			Expect(ccClient.AppCrashed("guid-2", cc_client.AppCrashedRequest{}, logger)).To(Succeed())
+			Expect(batchRequests()).To(Equal(1))
+			Expect(logger).To(gbytes.Say("batching-unsupported"))
+		})
+
+		Context("when CC responds that it does not implement them", func() {
+			BeforeEach(func() {
+				poolConfig.FailureThreshold = 1
+				fakeCC.RouteToHandler("POST", batchPath, ghttp.RespondWith(http.StatusNotImplemented, ""))
+			})
+
+			It("does not count the response as a failure of the endpoint", func() {
+				result := crash("guid-1")
+				fakeClock.WaitForWatcherAndIncrement(100 * time.Millisecond)
+				Eventually(result).Should(Receive(BeNil()))
+				Expect(batchRequests()).To(Equal(1))
+				Expect(logger).NotTo(gbytes.Say("cc-endpoint-unhealthy"))
+				Expect(pool.Healthy()).To(Equal([]string{fakeCC.URL()}))
+			})
+		})
+
+		It("tries the batch endpoint again later", func() {
+			result := crash("guid-1")
+			fakeClock.WaitForWatcherAndIncrement(100 * time.Millisecond)
+			Eventually(result).Should(Receive(BeNil()))
+
+			fakeClock.Increment(10 * time.Minute)
+			result = crash("guid-2")
+			fakeClock.WaitForWatcherAndIncrement(100 * time.Millisecond)
+			Eventually(result).Should(Receive(BeNil()))
+			Expect(batchRequests()).To(Equal(2))
+		})
+	})
+})
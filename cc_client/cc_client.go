@@ -2,46 +2,287 @@ package cc_client
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/lager/v3"
 
 	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	"code.cloudfoundry.org/tps/tracing"
 )
 
 const (
 	appCrashedPath          = "/internal/v4/apps/%s/crashed"
 	appReschedulingPath     = "/internal/v4/apps/%s/rescheduling"
 	appReadinessChangedPath = "/internal/v4/apps/%s/readiness_changed"
+	appCrashLoopingPath     = "/internal/v4/apps/%s/crash_looping"
+	appFailedToStartPath    = "/internal/v4/apps/%s/instance_failed_to_start"
+	appRescheduledPath      = "/internal/v4/apps/%s/rescheduled"
+	appInstanceLostPath     = "/internal/v4/apps/%s/instance_lost"
+	appAvailabilityPath     = "/internal/v4/apps/%s/availability_changed"
 	ccRequestTimeout        = 5 * time.Second
 )
 
 //go:generate counterfeiter -o fakes/fake_cc_client.go . CcClient
 type CcClient interface {
-	AppCrashed(guid string, appCrashed cc_messages.AppCrashedRequest, logger lager.Logger) error
-	AppRescheduling(guid string, appRescheduling cc_messages.AppReschedulingRequest, logger lager.Logger) error
-	AppReadinessChanged(guid string, AppReadinessChanged cc_messages.AppReadinessChangedRequest, logger lager.Logger) error
+	AppCrashed(guid string, appCrashed AppCrashedRequest, logger lager.Logger) error
+	AppRescheduling(guid string, appRescheduling AppReschedulingRequest, logger lager.Logger) error
+	AppReadinessChanged(guid string, AppReadinessChanged AppReadinessChangedRequest, logger lager.Logger) error
+	AppCrashedWithContext(ctx context.Context, guid string, appCrashed AppCrashedRequest, logger lager.Logger) error
+	AppReschedulingWithContext(ctx context.Context, guid string, appRescheduling AppReschedulingRequest, logger lager.Logger) error
+	AppReadinessChangedWithContext(ctx context.Context, guid string, AppReadinessChanged AppReadinessChangedRequest, logger lager.Logger) error
+	AppCrashLooping(guid string, appCrashLooping AppCrashLoopingRequest, logger lager.Logger) error
+	AppInstanceFailedToStart(guid string, appFailedToStart AppInstanceFailedToStartRequest, logger lager.Logger) error
+	AppRescheduled(guid string, appRescheduled AppRescheduledRequest, logger lager.Logger) error
+	AppInstanceLost(guid string, appInstanceLost AppInstanceLostRequest, logger lager.Logger) error
+	AppAvailabilityChanged(guid string, appAvailabilityChanged AppAvailabilityChangedRequest, logger lager.Logger) error
+	AppCrashLoopingWithContext(ctx context.Context, guid string, appCrashLooping AppCrashLoopingRequest, logger lager.Logger) error
+	AppInstanceFailedToStartWithContext(ctx context.Context, guid string, appFailedToStart AppInstanceFailedToStartRequest, logger lager.Logger) error
+	AppRescheduledWithContext(ctx context.Context, guid string, appRescheduled AppRescheduledRequest, logger lager.Logger) error
+	AppInstanceLostWithContext(ctx context.Context, guid string, appInstanceLost AppInstanceLostRequest, logger lager.Logger) error
+	AppAvailabilityChangedWithContext(ctx context.Context, guid string, appAvailabilityChanged AppAvailabilityChangedRequest, logger lager.Logger) error
+}
+
+// The availability states of an app as a whole.
+const (
+	AppAvailabilityReady       = "READY"
+	AppAvailabilityDegraded    = "DEGRADED"
+	AppAvailabilityUnavailable = "UNAVAILABLE"
+)
+
+// InstanceDetails describes where an app instance was placed. The fields are
+// only sent to CC when the client is created with includeInstanceDetails, so
+// that older CCs keep receiving the payloads they expect.
+type InstanceDetails struct {
+	AvailabilityZone string                   `json:"availability_zone,omitempty"`
+	MetricTags       map[string]string        `json:"metric_tags,omitempty"`
+	NetInfo          *models.ActualLRPNetInfo `json:"net_info,omitempty"`
+}
+
+type AppCrashedRequest struct {
+	cc_messages.AppCrashedRequest
+	*InstanceDetails
+}
+
+// AppReschedulingRequest reports an instance that is being evacuated. Since
+// is when the evacuating instance last changed, in nanoseconds since the
+// epoch.
+type AppReschedulingRequest struct {
+	cc_messages.AppReschedulingRequest
+	Since int64 `json:"since,omitempty"`
+	*InstanceDetails
+}
+
+// AppReadinessChangedRequest reports an instance that became ready or not
+// ready. Since is when the instance changed, in nanoseconds since the epoch.
+type AppReadinessChangedRequest struct {
+	cc_messages.AppReadinessChangedRequest
+	Since int64 `json:"since,omitempty"`
+	*InstanceDetails
+}
+
+// CrashRecord is a single crash of an instance, as reported by Diego.
+type CrashRecord struct {
+	Instance        string `json:"instance"`
+	CellID          string `json:"cell_id"`
+	ExitDescription string `json:"exit_description,omitempty"`
+	CrashCount      int    `json:"crash_count"`
+	CrashTimestamp  int64  `json:"crash_timestamp"`
+}
+
+// AppCrashLoopingRequest reports that an instance index keeps crashing. Crashes
+// holds the observed crash timeline, oldest first.
+type AppCrashLoopingRequest struct {
+	Index   int           `json:"index"`
+	Reason  string        `json:"reason"`
+	Crashes []CrashRecord `json:"crashes"`
+	*InstanceDetails
+}
+
+// AppInstanceFailedToStartRequest reports an instance that has stayed in the
+// UNCLAIMED or CLAIMED state for too long.
+type AppInstanceFailedToStartRequest struct {
+	Instance       string `json:"instance,omitempty"`
+	Index          int    `json:"index"`
+	CellID         string `json:"cell_id,omitempty"`
+	State          string `json:"state"`
+	Since          int64  `json:"since"`
+	PlacementError string `json:"placement_error,omitempty"`
+	Reason         string `json:"reason"`
+	*InstanceDetails
+}
+
+// AppRescheduledRequest reports that an evacuated instance has been replaced
+// by an instance that is running and ready on another cell. DowntimeMillis is
+// how long the index had no ready instance during the move, and Since when the
+// replacement became ready, in nanoseconds since the epoch.
+type AppRescheduledRequest struct {
+	Instance       string `json:"instance"`
+	Index          int    `json:"index"`
+	CellID         string `json:"cell_id"`
+	OldInstance    string `json:"old_instance"`
+	OldCellID      string `json:"old_cell_id"`
+	DowntimeMillis int64  `json:"downtime_ms"`
+	Since          int64  `json:"since,omitempty"`
+	*InstanceDetails
+}
+
+// AppInstanceLostRequest reports a running instance that disappeared without
+// crashing, being evacuated or being stopped. CellID and State are the last
+// known placement and state of the instance.
+type AppInstanceLostRequest struct {
+	Instance string `json:"instance"`
+	Index    int    `json:"index"`
+	CellID   string `json:"cell_id"`
+	State    string `json:"state"`
+	Since    int64  `json:"since"`
+	Reason   string `json:"reason"`
+	*InstanceDetails
+}
+
+// AppAvailabilityChangedRequest reports that an app moved between being
+// READY, with all desired instances ready, DEGRADED and UNAVAILABLE, with no
+// instance ready. Since is when the change was observed, in nanoseconds since
+// the epoch.
+type AppAvailabilityChangedRequest struct {
+	State            string `json:"state"`
+	PreviousState    string `json:"previous_state"`
+	ReadyInstances   int    `json:"ready_instances"`
+	DesiredInstances int    `json:"desired_instances"`
+	Since            int64  `json:"since,omitempty"`
 }
 
 type ccClient struct {
-	ccURI      string
-	httpClient *http.Client
+	endpoints              *EndpointPool
+	httpClient             *http.Client
+	includeInstanceDetails bool
+	tokens                 TokenSource
+	breaker                *CircuitBreaker
+	batcher                *Batcher
+	deduplicator           *Deduplicator
 }
 
+// BadResponseError is returned when CC responds to a notification with a
+// status other than 200 OK. Code, ErrorCode and Description are parsed from
+// the CC error in the response body, if any; Body holds the start of the raw
+// body.
 type BadResponseError struct {
-	StatusCode int
+	Endpoint    string
+	ProcessGuid string
+	StatusCode  int
+	Code        int
+	ErrorCode   string
+	Description string
+	Body        string
 }
 
 func (b *BadResponseError) Error() string {
-	return fmt.Sprintf("Crashed response POST failed with %d", b.StatusCode)
+	msg := fmt.Sprintf("POST %s for process %s failed with %d", b.Endpoint, b.ProcessGuid, b.StatusCode)
+	if b.ErrorCode != "" {
+		msg += fmt.Sprintf(": %s (%d)", b.ErrorCode, b.Code)
+	}
+	if b.Description != "" {
+		msg += ": " + b.Description
+	}
+	return msg
+}
+
+// Retryable returns whether the notification may succeed when it is sent
+// again, which is the case for server errors, timeouts and rate limiting.
+func (b *BadResponseError) Retryable() bool {
+	switch {
+	case b.StatusCode >= 500:
+		return b.StatusCode != http.StatusNotImplemented && b.StatusCode != http.StatusHTTPVersionNotSupported
+	case b.StatusCode == http.StatusRequestTimeout, b.StatusCode == http.StatusTooManyRequests:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsRetryable returns whether a notification that failed with err may succeed
+// when it is sent again. Failures to reach CC or UAA and short-circuited
+// requests are retryable, canceled requests and requests CC or UAA rejected as
+// invalid are not.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+
+	var classified interface{ Retryable() bool }
+	if errors.As(err, &classified) {
+		return classified.Retryable()
+	}
+
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr)
+}
+
+// maxErrorBodySize bounds how much of an error response is read.
+const maxErrorBodySize = 64 * 1024
+
+// maxErrorBodyDetail bounds how much of an error response is kept in a
+// BadResponseError.
+const maxErrorBodyDetail = 1024
+
+// ccError is an error in the format of the CC v2 API, or of the v3 API, which
+// reports a list of errors.
+type ccError struct {
+	Code        int    `json:"code"`
+	ErrorCode   string `json:"error_code"`
+	Description string `json:"description"`
+	Errors      []struct {
+		Code   int    `json:"code"`
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+	} `json:"errors"`
+}
+
+func newBadResponseError(endpoint, guid string, response *http.Response) *BadResponseError {
+	badResponse := &BadResponseError{
+		Endpoint:    endpoint,
+		ProcessGuid: guid,
+		StatusCode:  response.StatusCode,
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
+	if err != nil || len(body) == 0 {
+		return badResponse
+	}
+
+	badResponse.Body = string(body)
+	if len(body) > maxErrorBodyDetail {
+		badResponse.Body = string(body[:maxErrorBodyDetail])
+	}
+
+	var parsed ccError
+	if json.Unmarshal(body, &parsed) != nil {
+		return badResponse
+	}
+	if len(parsed.Errors) > 0 {
+		badResponse.Code = parsed.Errors[0].Code
+		badResponse.ErrorCode = parsed.Errors[0].Title
+		badResponse.Description = parsed.Errors[0].Detail
+	} else {
+		badResponse.Code = parsed.Code
+		badResponse.ErrorCode = parsed.ErrorCode
+		badResponse.Description = parsed.Description
+	}
+	return badResponse
 }
 
 func NewTLSConfig(certFile string, keyFile string, caCertFile string) (*tls.Config, error) {
@@ -76,8 +317,48 @@ func NewTLSConfig(certFile string, keyFile string, caCertFile string) (*tls.Conf
 	return tlsConfig, nil
 }
 
-func NewCcClient(baseURI string, tlsConfig *tls.Config) CcClient {
-	httpClient := &http.Client{
+func NewCcClient(baseURI string, tlsConfig *tls.Config, includeInstanceDetails bool) CcClient {
+	return NewCcClientWithEndpoints(newEndpointPool([]string{baseURI}, EndpointPoolConfig{
+		Routing:          PriorityRouting,
+		FailureThreshold: DefaultEndpointFailureThreshold,
+	}), tlsConfig, includeInstanceDetails, nil, nil, nil, nil)
+}
+
+// NewOAuthCcClient returns a client that authenticates to CC with the bearer
+// tokens of the token source instead of a client certificate. A request that
+// CC rejects as unauthorized is sent once more with a new token.
+func NewOAuthCcClient(baseURI string, tlsConfig *tls.Config, includeInstanceDetails bool, tokens TokenSource) CcClient {
+	return NewCcClientWithEndpoints(newEndpointPool([]string{baseURI}, EndpointPoolConfig{
+		Routing:          PriorityRouting,
+		FailureThreshold: DefaultEndpointFailureThreshold,
+	}), tlsConfig, includeInstanceDetails, tokens, nil, nil, nil)
+}
+
+// NewCcClientWithEndpoints returns a client that sends each request to the
+// endpoints of the pool in turn until one of them neither fails to respond
+// nor responds with a server error. Without a token source the client
+// authenticates with the client certificate of the TLS config, without a
+// circuit breaker requests are never short-circuited, without a batcher every
+// notification is sent in a request of its own, and without a deduplicator
+// notifications that were already delivered are sent again.
+func NewCcClientWithEndpoints(endpoints *EndpointPool, tlsConfig *tls.Config, includeInstanceDetails bool, tokens TokenSource, breaker *CircuitBreaker, batcher *Batcher, deduplicator *Deduplicator) CcClient {
+	client := &ccClient{
+		endpoints:              endpoints,
+		httpClient:             newHTTPClient(tlsConfig),
+		includeInstanceDetails: includeInstanceDetails,
+		tokens:                 tokens,
+		breaker:                breaker,
+		batcher:                batcher,
+		deduplicator:           deduplicator,
+	}
+	if batcher != nil {
+		batcher.send = client.sendBatch
+	}
+	return client
+}
+
+func newHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
 		Timeout: ccRequestTimeout,
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
@@ -89,108 +370,320 @@ func NewCcClient(baseURI string, tlsConfig *tls.Config) CcClient {
 			TLSClientConfig:     tlsConfig,
 		},
 	}
+}
 
-	return &ccClient{
-		ccURI:      baseURI,
-		httpClient: httpClient,
-	}
+func (cc *ccClient) AppCrashed(guid string, appCrashed AppCrashedRequest, logger lager.Logger) error {
+	return cc.AppCrashedWithContext(context.Background(), guid, appCrashed, logger)
 }
 
-func (cc *ccClient) AppCrashed(guid string, appCrashed cc_messages.AppCrashedRequest, logger lager.Logger) error {
-	logger = logger.Session("cc-client")
-	logger.Debug("delivering-app-crashed-response", lager.Data{"app_crashed": appCrashed})
+func (cc *ccClient) AppRescheduling(guid string, appRescheduling AppReschedulingRequest, logger lager.Logger) error {
+	return cc.AppReschedulingWithContext(context.Background(), guid, appRescheduling, logger)
+}
 
-	payload, err := json.Marshal(appCrashed)
-	if err != nil {
-		return err
-	}
+func (cc *ccClient) AppReadinessChanged(guid string, appReadinessChanged AppReadinessChangedRequest, logger lager.Logger) error {
+	return cc.AppReadinessChangedWithContext(context.Background(), guid, appReadinessChanged, logger)
+}
 
-	url := fmt.Sprintf(cc.ccURI+appCrashedPath, guid)
-	request, err := http.NewRequest("POST", url, bytes.NewReader(payload))
-	if err != nil {
-		return err
+// AppCrashedWithContext is AppCrashed with a context that cancels the request
+// or sets its deadline. The request never outlives the client's own timeout.
+func (cc *ccClient) AppCrashedWithContext(ctx context.Context, guid string, appCrashed AppCrashedRequest, logger lager.Logger) error {
+	if !cc.includeInstanceDetails {
+		appCrashed.InstanceDetails = nil
 	}
+	notification := newIdempotency(instanceSubject(guid, appCrashed.Instance, appCrashed.Index), "app_crashed", "", appCrashed.CrashCount, appCrashed.CrashTimestamp)
+	return cc.post(ctx, logger, appCrashedPath, guid, "app-crashed", notification, appCrashed)
+}
 
-	request.Header.Set("content-type", "application/json")
+// AppReschedulingWithContext is AppRescheduling with a context that cancels
+// the request or sets its deadline.
+func (cc *ccClient) AppReschedulingWithContext(ctx context.Context, guid string, appRescheduling AppReschedulingRequest, logger lager.Logger) error {
+	if !cc.includeInstanceDetails {
+		appRescheduling.InstanceDetails = nil
+	}
+	notification := newIdempotency(instanceSubject(guid, appRescheduling.Instance, appRescheduling.Index), "app_rescheduling", "", 0, appRescheduling.Since)
+	return cc.post(ctx, logger, appReschedulingPath, guid, "app-rescheduling", notification, appRescheduling)
+}
 
-	response, err := cc.httpClient.Do(request)
-	if err != nil {
-		logger.Error("deliver-app-crashed-response-failed", err)
-		return err
+// AppReadinessChangedWithContext is AppReadinessChanged with a context that
+// cancels the request or sets its deadline.
+func (cc *ccClient) AppReadinessChangedWithContext(ctx context.Context, guid string, appReadinessChanged AppReadinessChangedRequest, logger lager.Logger) error {
+	if !cc.includeInstanceDetails {
+		appReadinessChanged.InstanceDetails = nil
 	}
+	state := "not-ready"
+	if appReadinessChanged.Ready {
+		state = "ready"
+	}
+	notification := newIdempotency(instanceSubject(guid, appReadinessChanged.Instance, appReadinessChanged.Index), "app_readiness_changed", state, 0, appReadinessChanged.Since)
+	return cc.post(ctx, logger, appReadinessChangedPath, guid, "app-readiness-changed", notification, appReadinessChanged)
+}
 
-	defer response.Body.Close()
+func (cc *ccClient) AppCrashLooping(guid string, appCrashLooping AppCrashLoopingRequest, logger lager.Logger) error {
+	return cc.AppCrashLoopingWithContext(context.Background(), guid, appCrashLooping, logger)
+}
 
-	if response.StatusCode != http.StatusOK {
-		return &BadResponseError{response.StatusCode}
-	}
+func (cc *ccClient) AppInstanceFailedToStart(guid string, appFailedToStart AppInstanceFailedToStartRequest, logger lager.Logger) error {
+	return cc.AppInstanceFailedToStartWithContext(context.Background(), guid, appFailedToStart, logger)
+}
 
-	logger.Debug("delivered-app-crashed-response")
-	return nil
+func (cc *ccClient) AppRescheduled(guid string, appRescheduled AppRescheduledRequest, logger lager.Logger) error {
+	return cc.AppRescheduledWithContext(context.Background(), guid, appRescheduled, logger)
 }
 
-func (cc *ccClient) AppRescheduling(guid string, appRescheduling cc_messages.AppReschedulingRequest, logger lager.Logger) error {
-	logger = logger.Session("cc-client")
-	logger.Debug("delivering-app-rescheduling-response", lager.Data{"app_rescheduling": appRescheduling})
+func (cc *ccClient) AppInstanceLost(guid string, appInstanceLost AppInstanceLostRequest, logger lager.Logger) error {
+	return cc.AppInstanceLostWithContext(context.Background(), guid, appInstanceLost, logger)
+}
 
-	payload, err := json.Marshal(appRescheduling)
-	if err != nil {
-		return err
+func (cc *ccClient) AppAvailabilityChanged(guid string, appAvailabilityChanged AppAvailabilityChangedRequest, logger lager.Logger) error {
+	return cc.AppAvailabilityChangedWithContext(context.Background(), guid, appAvailabilityChanged, logger)
+}
+
+// AppCrashLoopingWithContext is AppCrashLooping with a context that cancels
+// the request or sets its deadline.
+func (cc *ccClient) AppCrashLoopingWithContext(ctx context.Context, guid string, appCrashLooping AppCrashLoopingRequest, logger lager.Logger) error {
+	if !cc.includeInstanceDetails {
+		appCrashLooping.InstanceDetails = nil
+	}
+	var lastCrash CrashRecord
+	if len(appCrashLooping.Crashes) > 0 {
+		lastCrash = appCrashLooping.Crashes[len(appCrashLooping.Crashes)-1]
 	}
+	notification := newIdempotency(instanceSubject(guid, "", appCrashLooping.Index), "app_crash_looping", appCrashLooping.Reason, lastCrash.CrashCount, lastCrash.CrashTimestamp)
+	return cc.post(ctx, logger, appCrashLoopingPath, guid, "app-crash-looping", notification, appCrashLooping)
+}
 
-	url := fmt.Sprintf(cc.ccURI+appReschedulingPath, guid)
-	request, err := http.NewRequest("POST", url, bytes.NewReader(payload))
-	if err != nil {
-		return err
+// AppInstanceFailedToStartWithContext is AppInstanceFailedToStart with a
+// context that cancels the request or sets its deadline.
+func (cc *ccClient) AppInstanceFailedToStartWithContext(ctx context.Context, guid string, appFailedToStart AppInstanceFailedToStartRequest, logger lager.Logger) error {
+	if !cc.includeInstanceDetails {
+		appFailedToStart.InstanceDetails = nil
 	}
+	notification := newIdempotency(instanceSubject(guid, appFailedToStart.Instance, appFailedToStart.Index), "app_instance_failed_to_start", appFailedToStart.State, 0, appFailedToStart.Since)
+	return cc.post(ctx, logger, appFailedToStartPath, guid, "app-instance-failed-to-start", notification, appFailedToStart)
+}
 
-	request.Header.Set("content-type", "application/json")
+// AppRescheduledWithContext is AppRescheduled with a context that cancels the
+// request or sets its deadline.
+func (cc *ccClient) AppRescheduledWithContext(ctx context.Context, guid string, appRescheduled AppRescheduledRequest, logger lager.Logger) error {
+	if !cc.includeInstanceDetails {
+		appRescheduled.InstanceDetails = nil
+	}
+	notification := newIdempotency(instanceSubject(guid, appRescheduled.Instance, appRescheduled.Index), "app_rescheduled", "", 0, appRescheduled.Since)
+	return cc.post(ctx, logger, appRescheduledPath, guid, "app-rescheduled", notification, appRescheduled)
+}
 
-	response, err := cc.httpClient.Do(request)
-	if err != nil {
-		logger.Error("deliver-app-rescheduling-response-failed", err)
-		return err
+// AppInstanceLostWithContext is AppInstanceLost with a context that cancels
+// the request or sets its deadline.
+func (cc *ccClient) AppInstanceLostWithContext(ctx context.Context, guid string, appInstanceLost AppInstanceLostRequest, logger lager.Logger) error {
+	if !cc.includeInstanceDetails {
+		appInstanceLost.InstanceDetails = nil
 	}
+	notification := newIdempotency(instanceSubject(guid, appInstanceLost.Instance, appInstanceLost.Index), "app_instance_lost", "", 0, appInstanceLost.Since)
+	return cc.post(ctx, logger, appInstanceLostPath, guid, "app-instance-lost", notification, appInstanceLost)
+}
 
-	defer response.Body.Close()
+// AppAvailabilityChangedWithContext is AppAvailabilityChanged with a context
+// that cancels the request or sets its deadline.
+func (cc *ccClient) AppAvailabilityChangedWithContext(ctx context.Context, guid string, appAvailabilityChanged AppAvailabilityChangedRequest, logger lager.Logger) error {
+	notification := newIdempotency(guid, "app_availability_changed", appAvailabilityChanged.State, 0, appAvailabilityChanged.Since)
+	return cc.post(ctx, logger, appAvailabilityPath, guid, "app-availability-changed", notification, appAvailabilityChanged)
+}
 
-	if response.StatusCode != http.StatusOK {
-		return &BadResponseError{response.StatusCode}
+// instanceSubject identifies an instance by its guid or, when a notification
+// does not name the instance, by its index.
+func instanceSubject(guid, instance string, index int) string {
+	if instance != "" {
+		return instance
 	}
-
-	logger.Debug("delivered-app-rescheduling-response")
-	return nil
+	return fmt.Sprintf("%s/%d", guid, index)
 }
 
-func (cc *ccClient) AppReadinessChanged(guid string, appReadinessChanged cc_messages.AppReadinessChangedRequest, logger lager.Logger) error {
-	logger = logger.Session("cc-client")
-	logger.Debug("delivering-app-readiness-changed-response", lager.Data{"app_readiness_changed": appReadinessChanged})
+func (cc *ccClient) post(ctx context.Context, logger lager.Logger, pathFormat, guid, name string, notification idempotency, message interface{}) error {
+	logger = logger.Session("cc-client", lager.Data{"idempotency-key": notification.key})
+	logger.Debug("delivering-"+name+"-response", lager.Data{strings.Replace(name, "-", "_", -1): message})
+
+	if cc.deduplicator == nil {
+		return cc.deliver(ctx, logger, pathFormat, guid, name, notification, message)
+	}
 
-	payload, err := json.Marshal(appReadinessChanged)
+	release, claimed := cc.deduplicator.claim(logger, notification)
+	if !claimed {
+		return nil
+	}
+	err := cc.deliver(ctx, logger, pathFormat, guid, name, notification, message)
 	if err != nil {
-		return err
+		release()
 	}
+	return err
+}
 
-	url := fmt.Sprintf(cc.ccURI+appReadinessChangedPath, guid)
-	request, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+func (cc *ccClient) deliver(ctx context.Context, logger lager.Logger, pathFormat, guid, name string, notification idempotency, message interface{}) error {
+	payload, err := json.Marshal(message)
 	if err != nil {
 		return err
 	}
 
-	request.Header.Set("content-type", "application/json")
+	if cc.breaker != nil {
+		err = cc.breaker.allow(logger)
+		if err != nil {
+			return err
+		}
+	}
 
-	response, err := cc.httpClient.Do(request)
+	if cc.batcher != nil && cc.batcher.supported() {
+		var traceparent string
+		if span, ok := tracing.FromContext(ctx); ok {
+			traceparent = span.Traceparent()
+		}
+		err = cc.batcher.submit(ctx, batchNotification{
+			Type:           strings.Replace(name, "-", "_", -1),
+			ProcessGuid:    guid,
+			IdempotencyKey: notification.key,
+			Traceparent:    traceparent,
+			Payload:        payload,
+		})
+		// The batch request, rather than each of its notifications, is
+		// recorded with the circuit breaker.
+		if !errors.Is(err, errBatchingUnsupported) {
+			if err != nil {
+				return err
+			}
+			logger.Debug("delivered-" + name + "-response")
+			return nil
+		}
+	}
+
+	endpoint := fmt.Sprintf(pathFormat, guid)
+	response, err := cc.do(ctx, logger, endpoint, notification.key, payload)
+	if cc.breaker != nil {
+		cc.breaker.record(logger, outcomeOf(ctx, response, err))
+	}
 	if err != nil {
-		logger.Error("deliver-app-readiness-changed-response-failed", err)
+		logger.Error("deliver-"+name+"-response-failed", err)
 		return err
 	}
 
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return &BadResponseError{response.StatusCode}
+		return newBadResponseError(endpoint, guid, response)
 	}
 
-	logger.Debug("delivered-app-readiness-changed-response")
+	logger.Debug("delivered-" + name + "-response")
 	return nil
 }
+
+// do sends the payload to the endpoint of the first CC that neither fails to
+// respond nor responds with a server error, and records the outcome in the
+// endpoint pool. The response of the last CC tried is returned. A CC that
+// does not support the batch endpoint is not unhealthy, so its response to a
+// batch is returned without being recorded.
+func (cc *ccClient) do(ctx context.Context, logger lager.Logger, endpoint, idempotencyKey string, payload []byte) (*http.Response, error) {
+	candidates := cc.endpoints.candidates()
+
+	for i, baseURI := range candidates {
+		response, err := cc.send(ctx, logger, baseURI+endpoint, idempotencyKey, payload)
+		if outcomeOf(ctx, response, err) == requestIgnored {
+			return response, err
+		}
+		if err == nil && endpoint == appNotificationsBatchPath && batchingUnsupported(response.StatusCode) {
+			return response, nil
+		}
+
+		last := i == len(candidates)-1
+		switch {
+		case err != nil:
+			cc.endpoints.recordFailure(logger, baseURI)
+			if last {
+				return nil, err
+			}
+			logger.Error("failing-over", err, lager.Data{"endpoint": baseURI})
+
+		case response.StatusCode >= http.StatusInternalServerError:
+			cc.endpoints.recordFailure(logger, baseURI)
+			if last {
+				return response, nil
+			}
+			logger.Info("failing-over", lager.Data{"endpoint": baseURI, "status": response.StatusCode})
+			drain(response)
+
+		default:
+			cc.endpoints.recordSuccess(logger, baseURI)
+			return response, nil
+		}
+	}
+
+	return nil, ErrNoEndpoints
+}
+
+// outcomeOf classifies the outcome of a request for the endpoint pool and the
+// circuit breaker. Requests that were canceled or could not obtain a token
+// say nothing about the health of CC.
+func outcomeOf(ctx context.Context, response *http.Response, err error) requestOutcome {
+	var tokenErr tokenError
+	switch {
+	case ctx.Err() != nil, errors.As(err, &tokenErr):
+		return requestIgnored
+	case err != nil, response.StatusCode >= http.StatusInternalServerError:
+		return requestFailed
+	default:
+		return requestSucceeded
+	}
+}
+
+// tokenError is a failure to obtain a token, which says nothing about the
+// health of the CC endpoint.
+type tokenError struct {
+	error
+}
+
+func (e tokenError) Unwrap() error {
+	return e.error
+}
+
+// send posts the payload to the url with its idempotency key, with the span of
+// the context if it carries one, and with a bearer token if the client has a
+// token source. When CC rejects the token, it is discarded and the request is
+// sent once more with a new one.
+func (cc *ccClient) send(ctx context.Context, logger lager.Logger, url, idempotencyKey string, payload []byte) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("content-type", "application/json")
+		request.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+		if span, ok := tracing.FromContext(ctx); ok {
+			span.SetHeaders(request.Header)
+		}
+
+		var token string
+		if cc.tokens != nil {
+			token, err = cc.tokens.Token(ctx)
+			if err != nil {
+				return nil, tokenError{err}
+			}
+			request.Header.Set("authorization", "bearer "+token)
+		}
+
+		response, err := cc.httpClient.Do(request)
+		if err != nil {
+			return nil, err
+		}
+
+		if cc.tokens == nil || response.StatusCode != http.StatusUnauthorized || attempt > 1 {
+			return response, nil
+		}
+
+		logger.Info("token-rejected-retrying")
+		drain(response)
+		cc.tokens.Invalidate(token)
+	}
+}
+
+// drain reads and closes the body of a response that is discarded, so that
+// its connection can be reused.
+func drain(response *http.Response) {
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(response.Body, maxErrorBodySize))
+	response.Body.Close()
+}
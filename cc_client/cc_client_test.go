@@ -1,14 +1,19 @@
 package cc_client_test
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"time"
 
+	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/runtimeschema/cc_messages"
 	"code.cloudfoundry.org/tps/cc_client"
+	"code.cloudfoundry.org/tps/tracing"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/ghttp"
@@ -35,7 +40,7 @@ var _ = Describe("CC Client", func() {
 			"../fixtures/watcher_cc_client.key",
 			"../fixtures/watcher_cc_ca.crt")
 		Expect(err).NotTo(HaveOccurred())
-		ccClient = cc_client.NewCcClient(fakeCC.URL(), tlsConfig)
+		ccClient = cc_client.NewCcClient(fakeCC.URL(), tlsConfig, false)
 	})
 
 	AfterEach(func() {
@@ -64,8 +69,10 @@ var _ = Describe("CC Client", func() {
 		})
 
 		It("sends the request payload to the CC without modification", func() {
-			err := ccClient.AppCrashed(guid, cc_messages.AppCrashedRequest{
-				Index: 1,
+			err := ccClient.AppCrashed(guid, cc_client.AppCrashedRequest{
+				AppCrashedRequest: cc_messages.AppCrashedRequest{
+					Index: 1,
+				},
 			}, logger)
 			Expect(err).NotTo(HaveOccurred())
 		})
@@ -91,11 +98,13 @@ var _ = Describe("CC Client", func() {
 		})
 
 		It("sends the request payload to the CC without modification", func() {
-			err := ccClient.AppRescheduling(guid, cc_messages.AppReschedulingRequest{
-				Index:    3,
-				Instance: "instance-id",
-				CellID:   "id-of-cell",
-				Reason:   "reason-for-evacuation",
+			err := ccClient.AppRescheduling(guid, cc_client.AppReschedulingRequest{
+				AppReschedulingRequest: cc_messages.AppReschedulingRequest{
+					Index:    3,
+					Instance: "instance-id",
+					CellID:   "id-of-cell",
+					Reason:   "reason-for-evacuation",
+				},
 			}, logger)
 			Expect(err).NotTo(HaveOccurred())
 		})
@@ -124,43 +133,309 @@ var _ = Describe("CC Client", func() {
 		})
 
 		It("sends the request payload to the CC without modification", func() {
-			err := ccClient.AppReadinessChanged(guid, cc_messages.AppReadinessChangedRequest{
-				Index:    3,
-				Instance: "instance-id",
-				CellID:   "id-of-cell",
-				Ready:    true,
+			err := ccClient.AppReadinessChanged(guid, cc_client.AppReadinessChangedRequest{
+				AppReadinessChangedRequest: cc_messages.AppReadinessChangedRequest{
+					Index:    3,
+					Instance: "instance-id",
+					CellID:   "id-of-cell",
+					Ready:    true,
+				},
 			}, logger)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(callCount).To(Equal(1))
 		})
 	})
 
+	Describe("Successfully calling the Cloud Controller's crash looping endpoint", func() {
+		var expectedBody = []byte(`{"index":3,"reason":"CRASH_BACKOFF","crashes":[{"instance":"instance-id","cell_id":"id-of-cell","exit_description":"oom","crash_count":4,"crash_timestamp":12}]}`)
+
+		BeforeEach(func() {
+			fakeCC.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/crash_looping"),
+					ghttp.RespondWith(200, `{}`),
+					func(w http.ResponseWriter, req *http.Request) {
+						body, err := ioutil.ReadAll(req.Body)
+						defer req.Body.Close()
+
+						Expect(err).NotTo(HaveOccurred())
+						Expect(body).To(Equal(expectedBody))
+					},
+				),
+			)
+		})
+
+		It("sends the crash timeline to the CC", func() {
+			err := ccClient.AppCrashLooping(guid, cc_client.AppCrashLoopingRequest{
+				Index:  3,
+				Reason: "CRASH_BACKOFF",
+				Crashes: []cc_client.CrashRecord{{
+					Instance:        "instance-id",
+					CellID:          "id-of-cell",
+					ExitDescription: "oom",
+					CrashCount:      4,
+					CrashTimestamp:  12,
+				}},
+			}, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+		})
+	})
+
+	Describe("Successfully calling the Cloud Controller's instance failed to start endpoint", func() {
+		var expectedBody = []byte(`{"index":3,"state":"UNCLAIMED","since":12,"placement_error":"insufficient resources","reason":"Instance has been UNCLAIMED for more than 10m0s"}`)
+
+		BeforeEach(func() {
+			fakeCC.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/instance_failed_to_start"),
+					ghttp.RespondWith(200, `{}`),
+					func(w http.ResponseWriter, req *http.Request) {
+						body, err := ioutil.ReadAll(req.Body)
+						defer req.Body.Close()
+
+						Expect(err).NotTo(HaveOccurred())
+						Expect(body).To(Equal(expectedBody))
+					},
+				),
+			)
+		})
+
+		It("sends the request payload to the CC", func() {
+			err := ccClient.AppInstanceFailedToStart(guid, cc_client.AppInstanceFailedToStartRequest{
+				Index:          3,
+				State:          "UNCLAIMED",
+				Since:          12,
+				PlacementError: "insufficient resources",
+				Reason:         "Instance has been UNCLAIMED for more than 10m0s",
+			}, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+		})
+	})
+
+	Describe("Successfully calling the Cloud Controller's rescheduled endpoint", func() {
+		var expectedBody = []byte(`{"instance":"new-instance-id","index":3,"cell_id":"new-cell","old_instance":"old-instance-id","old_cell_id":"old-cell","downtime_ms":1500}`)
+
+		BeforeEach(func() {
+			fakeCC.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/rescheduled"),
+					ghttp.RespondWith(200, `{}`),
+					func(w http.ResponseWriter, req *http.Request) {
+						body, err := ioutil.ReadAll(req.Body)
+						defer req.Body.Close()
+
+						Expect(err).NotTo(HaveOccurred())
+						Expect(body).To(Equal(expectedBody))
+					},
+				),
+			)
+		})
+
+		It("sends the request payload to the CC", func() {
+			err := ccClient.AppRescheduled(guid, cc_client.AppRescheduledRequest{
+				Instance:       "new-instance-id",
+				Index:          3,
+				CellID:         "new-cell",
+				OldInstance:    "old-instance-id",
+				OldCellID:      "old-cell",
+				DowntimeMillis: 1500,
+			}, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+		})
+	})
+
+	Describe("Successfully calling the Cloud Controller's instance_lost endpoint", func() {
+		var expectedBody = []byte(`{"instance":"instance-id","index":1,"cell_id":"cell-id","state":"RUNNING","since":1234,"reason":"CELL_LOST"}`)
+
+		BeforeEach(func() {
+			fakeCC.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/instance_lost"),
+					ghttp.RespondWith(200, `{}`),
+					func(w http.ResponseWriter, req *http.Request) {
+						body, err := ioutil.ReadAll(req.Body)
+						defer req.Body.Close()
+
+						Expect(err).NotTo(HaveOccurred())
+						Expect(body).To(Equal(expectedBody))
+					},
+				),
+			)
+		})
+
+		It("sends the request payload to the CC", func() {
+			err := ccClient.AppInstanceLost(guid, cc_client.AppInstanceLostRequest{
+				Instance: "instance-id",
+				Index:    1,
+				CellID:   "cell-id",
+				State:    "RUNNING",
+				Since:    1234,
+				Reason:   "CELL_LOST",
+			}, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+		})
+	})
+
+	Describe("Successfully calling the Cloud Controller's availability_changed endpoint", func() {
+		var expectedBody = []byte(`{"state":"DEGRADED","previous_state":"READY","ready_instances":2,"desired_instances":3}`)
+
+		BeforeEach(func() {
+			fakeCC.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/availability_changed"),
+					ghttp.RespondWith(200, `{}`),
+					func(w http.ResponseWriter, req *http.Request) {
+						body, err := ioutil.ReadAll(req.Body)
+						defer req.Body.Close()
+
+						Expect(err).NotTo(HaveOccurred())
+						Expect(body).To(Equal(expectedBody))
+					},
+				),
+			)
+		})
+
+		It("sends the request payload to the CC", func() {
+			err := ccClient.AppAvailabilityChanged(guid, cc_client.AppAvailabilityChangedRequest{
+				State:            cc_client.AppAvailabilityDegraded,
+				PreviousState:    cc_client.AppAvailabilityReady,
+				ReadyInstances:   2,
+				DesiredInstances: 3,
+			}, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+		})
+	})
+
+	Describe("Instance details", func() {
+		var (
+			body    []byte
+			details *cc_client.InstanceDetails
+		)
+
+		BeforeEach(func() {
+			body = nil
+			details = &cc_client.InstanceDetails{
+				AvailabilityZone: "z1",
+				MetricTags:       map[string]string{"app_name": "dora"},
+				NetInfo: &models.ActualLRPNetInfo{
+					Address:         "1.2.3.4",
+					InstanceAddress: "5.6.7.8",
+					Ports:           []*models.PortMapping{models.NewPortMapping(61000, 8080)},
+				},
+			}
+
+			fakeCC.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/crashed"),
+					ghttp.RespondWith(200, `{}`),
+					func(w http.ResponseWriter, req *http.Request) {
+						var err error
+						body, err = ioutil.ReadAll(req.Body)
+						defer req.Body.Close()
+						Expect(err).NotTo(HaveOccurred())
+					},
+				),
+			)
+		})
+
+		Context("when the client does not include instance details", func() {
+			It("sends the original payload", func() {
+				err := ccClient.AppCrashed(guid, cc_client.AppCrashedRequest{
+					AppCrashedRequest: cc_messages.AppCrashedRequest{
+						Index: 1,
+					},
+					InstanceDetails: details,
+				}, logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(body).To(MatchJSON(`{"instance":"","index":1,"cell_id":"","reason":"","crash_count":0,"crash_timestamp":0}`))
+			})
+		})
+
+		Context("when the client includes instance details", func() {
+			BeforeEach(func() {
+				tlsConfig, err := cc_client.NewTLSConfig(
+					"../fixtures/watcher_cc_client.crt",
+					"../fixtures/watcher_cc_client.key",
+					"../fixtures/watcher_cc_ca.crt")
+				Expect(err).NotTo(HaveOccurred())
+				ccClient = cc_client.NewCcClient(fakeCC.URL(), tlsConfig, true)
+			})
+
+			It("adds the availability zone, metric tags and net info to the payload", func() {
+				err := ccClient.AppCrashed(guid, cc_client.AppCrashedRequest{
+					AppCrashedRequest: cc_messages.AppCrashedRequest{
+						Index: 1,
+					},
+					InstanceDetails: details,
+				}, logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(body).To(MatchJSON(`{
+					"instance":"",
+					"index":1,
+					"cell_id":"",
+					"reason":"",
+					"crash_count":0,
+					"crash_timestamp":0,
+					"availability_zone":"z1",
+					"metric_tags":{"app_name":"dora"},
+					"net_info":{
+						"address":"1.2.3.4",
+						"ports":[{"container_port":8080,"host_port":61000,"container_tls_proxy_port":0,"host_tls_proxy_port":0}],
+						"instance_address":"5.6.7.8",
+						"preferred_address":"UNKNOWN"
+					}
+				}`))
+			})
+
+			It("omits the details when none are known", func() {
+				err := ccClient.AppCrashed(guid, cc_client.AppCrashedRequest{
+					AppCrashedRequest: cc_messages.AppCrashedRequest{
+						Index: 1,
+					},
+				}, logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(body).To(MatchJSON(`{"instance":"","index":1,"cell_id":"","reason":"","crash_count":0,"crash_timestamp":0}`))
+			})
+		})
+	})
+
 	Describe("Error conditions", func() {
 		Context("when the request couldn't be completed", func() {
 			BeforeEach(func() {
 				bogusURL := "http://0.0.0.0.0:80"
-				ccClient = cc_client.NewCcClient(bogusURL, &tls.Config{})
+				ccClient = cc_client.NewCcClient(bogusURL, &tls.Config{}, false)
 			})
 
 			It("percolates errors calling app crashed", func() {
-				err := ccClient.AppCrashed(guid, cc_messages.AppCrashedRequest{
-					Index: 1,
+				err := ccClient.AppCrashed(guid, cc_client.AppCrashedRequest{
+					AppCrashedRequest: cc_messages.AppCrashedRequest{
+						Index: 1,
+					},
 				}, logger)
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(BeAssignableToTypeOf(&url.Error{}))
 			})
 
 			It("percolates errors calling app rescheduling", func() {
-				err := ccClient.AppRescheduling(guid, cc_messages.AppReschedulingRequest{
-					Index: 1,
+				err := ccClient.AppRescheduling(guid, cc_client.AppReschedulingRequest{
+					AppReschedulingRequest: cc_messages.AppReschedulingRequest{
+						Index: 1,
+					},
 				}, logger)
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(BeAssignableToTypeOf(&url.Error{}))
 			})
 
 			It("percolates errors calling app readiness changed", func() {
-				err := ccClient.AppReadinessChanged(guid, cc_messages.AppReadinessChangedRequest{
-					Index: 1,
+				err := ccClient.AppReadinessChanged(guid, cc_client.AppReadinessChangedRequest{
+					AppReadinessChangedRequest: cc_messages.AppReadinessChangedRequest{
+						Index: 1,
+					},
 				}, logger)
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(BeAssignableToTypeOf(&url.Error{}))
@@ -178,8 +453,10 @@ var _ = Describe("CC Client", func() {
 			})
 
 			It("returns an error with the actual status code", func() {
-				err := ccClient.AppCrashed(guid, cc_messages.AppCrashedRequest{
-					Index: 1,
+				err := ccClient.AppCrashed(guid, cc_client.AppCrashedRequest{
+					AppCrashedRequest: cc_messages.AppCrashedRequest{
+						Index: 1,
+					},
 				}, logger)
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(BeAssignableToTypeOf(&cc_client.BadResponseError{}))
@@ -198,7 +475,29 @@ var _ = Describe("CC Client", func() {
 			})
 
 			It("returns an error with the actual status code", func() {
-				err := ccClient.AppRescheduling(guid, cc_messages.AppReschedulingRequest{
+				err := ccClient.AppRescheduling(guid, cc_client.AppReschedulingRequest{
+					AppReschedulingRequest: cc_messages.AppReschedulingRequest{
+						Index: 1,
+					},
+				}, logger)
+				Expect(err).To(HaveOccurred())
+				Expect(err).To(BeAssignableToTypeOf(&cc_client.BadResponseError{}))
+				Expect(err.(*cc_client.BadResponseError).StatusCode).To(Equal(500))
+			})
+		})
+
+		Context("when the crash looping response code is not StatusOK (200)", func() {
+			BeforeEach(func() {
+				fakeCC.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/crash_looping"),
+						ghttp.RespondWith(500, `{}`),
+					),
+				)
+			})
+
+			It("returns an error with the actual status code", func() {
+				err := ccClient.AppCrashLooping(guid, cc_client.AppCrashLoopingRequest{
 					Index: 1,
 				}, logger)
 				Expect(err).To(HaveOccurred())
@@ -207,6 +506,77 @@ var _ = Describe("CC Client", func() {
 			})
 		})
 
+		Context("when CC responds with a v2 error", func() {
+			BeforeEach(func() {
+				fakeCC.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/rescheduled"),
+						ghttp.RespondWith(404, `{"code":100004,"description":"The app could not be found: a-guid","error_code":"CF-AppNotFound"}`),
+					),
+				)
+			})
+
+			It("returns an error with the endpoint and the CC error", func() {
+				err := ccClient.AppRescheduled(guid, cc_client.AppRescheduledRequest{}, logger)
+
+				var badResponse *cc_client.BadResponseError
+				Expect(errors.As(err, &badResponse)).To(BeTrue())
+				Expect(badResponse.Endpoint).To(Equal("/internal/v4/apps/" + guid + "/rescheduled"))
+				Expect(badResponse.ProcessGuid).To(Equal(guid))
+				Expect(badResponse.StatusCode).To(Equal(404))
+				Expect(badResponse.Code).To(Equal(100004))
+				Expect(badResponse.ErrorCode).To(Equal("CF-AppNotFound"))
+				Expect(badResponse.Description).To(Equal("The app could not be found: a-guid"))
+				Expect(badResponse.Body).To(ContainSubstring("CF-AppNotFound"))
+				Expect(err.Error()).To(Equal("POST /internal/v4/apps/a-guid/rescheduled for process a-guid failed with 404: CF-AppNotFound (100004): The app could not be found: a-guid"))
+				Expect(cc_client.IsRetryable(err)).To(BeFalse())
+			})
+		})
+
+		Context("when CC responds with a v3 error", func() {
+			BeforeEach(func() {
+				fakeCC.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/instance_lost"),
+						ghttp.RespondWith(503, `{"errors":[{"code":10001,"title":"CF-ServiceUnavailable","detail":"try again later"}]}`),
+					),
+				)
+			})
+
+			It("returns an error with the first CC error", func() {
+				err := ccClient.AppInstanceLost(guid, cc_client.AppInstanceLostRequest{}, logger)
+
+				var badResponse *cc_client.BadResponseError
+				Expect(errors.As(err, &badResponse)).To(BeTrue())
+				Expect(badResponse.StatusCode).To(Equal(503))
+				Expect(badResponse.Code).To(Equal(10001))
+				Expect(badResponse.ErrorCode).To(Equal("CF-ServiceUnavailable"))
+				Expect(badResponse.Description).To(Equal("try again later"))
+				Expect(cc_client.IsRetryable(err)).To(BeTrue())
+			})
+		})
+
+		Context("when CC responds with a body that is not a CC error", func() {
+			BeforeEach(func() {
+				fakeCC.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/availability_changed"),
+						ghttp.RespondWith(502, `<html>Bad Gateway</html>`),
+					),
+				)
+			})
+
+			It("keeps the raw body", func() {
+				err := ccClient.AppAvailabilityChanged(guid, cc_client.AppAvailabilityChangedRequest{}, logger)
+
+				var badResponse *cc_client.BadResponseError
+				Expect(errors.As(err, &badResponse)).To(BeTrue())
+				Expect(badResponse.ErrorCode).To(BeEmpty())
+				Expect(badResponse.Body).To(Equal("<html>Bad Gateway</html>"))
+				Expect(err.Error()).To(Equal("POST /internal/v4/apps/a-guid/availability_changed for process a-guid failed with 502"))
+			})
+		})
+
 		Context("when the readiness changed response code is not StatusOK (200)", func() {
 			BeforeEach(func() {
 				fakeCC.AppendHandlers(
@@ -218,8 +588,10 @@ var _ = Describe("CC Client", func() {
 			})
 
 			It("returns an error with the actual status code", func() {
-				err := ccClient.AppReadinessChanged(guid, cc_messages.AppReadinessChangedRequest{
-					Index: 1,
+				err := ccClient.AppReadinessChanged(guid, cc_client.AppReadinessChangedRequest{
+					AppReadinessChangedRequest: cc_messages.AppReadinessChangedRequest{
+						Index: 1,
+					},
 				}, logger)
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(BeAssignableToTypeOf(&cc_client.BadResponseError{}))
@@ -228,4 +600,105 @@ var _ = Describe("CC Client", func() {
 		})
 	})
 
+	Describe("Contexts", func() {
+		It("sends requests made with a context", func() {
+			fakeCC.AppendHandlers(
+				ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/crashed"),
+				ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/rescheduling"),
+				ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/readiness_changed"),
+				ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/crash_looping"),
+				ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/instance_failed_to_start"),
+				ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/rescheduled"),
+				ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/instance_lost"),
+				ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/availability_changed"),
+			)
+
+			ctx := context.Background()
+			Expect(ccClient.AppCrashedWithContext(ctx, guid, cc_client.AppCrashedRequest{}, logger)).To(Succeed())
+			Expect(ccClient.AppReschedulingWithContext(ctx, guid, cc_client.AppReschedulingRequest{}, logger)).To(Succeed())
+			Expect(ccClient.AppReadinessChangedWithContext(ctx, guid, cc_client.AppReadinessChangedRequest{}, logger)).To(Succeed())
+			Expect(ccClient.AppCrashLoopingWithContext(ctx, guid, cc_client.AppCrashLoopingRequest{}, logger)).To(Succeed())
+			Expect(ccClient.AppInstanceFailedToStartWithContext(ctx, guid, cc_client.AppInstanceFailedToStartRequest{}, logger)).To(Succeed())
+			Expect(ccClient.AppRescheduledWithContext(ctx, guid, cc_client.AppRescheduledRequest{}, logger)).To(Succeed())
+			Expect(ccClient.AppInstanceLostWithContext(ctx, guid, cc_client.AppInstanceLostRequest{}, logger)).To(Succeed())
+			Expect(ccClient.AppAvailabilityChangedWithContext(ctx, guid, cc_client.AppAvailabilityChangedRequest{}, logger)).To(Succeed())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(8))
+		})
+
+		It("propagates the span of the context", func() {
+			fakeCC.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/internal/v4/apps/"+guid+"/crashed"),
+				ghttp.VerifyHeaderKV("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"),
+				ghttp.VerifyHeaderKV("X-Vcap-Request-Id", "4bf92f3577b34da6a3ce929d0e0e4736"),
+			))
+
+			ctx := tracing.NewContext(context.Background(), tracing.Span{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"})
+			Expect(ccClient.AppCrashedWithContext(ctx, guid, cc_client.AppCrashedRequest{}, logger)).To(Succeed())
+		})
+
+		It("sends no trace headers without a span", func() {
+			fakeCC.AppendHandlers(func(w http.ResponseWriter, req *http.Request) {
+				Expect(req.Header.Get("traceparent")).To(BeEmpty())
+				Expect(req.Header.Get("X-Vcap-Request-Id")).To(BeEmpty())
+			})
+
+			Expect(ccClient.AppCrashed(guid, cc_client.AppCrashedRequest{}, logger)).To(Succeed())
+		})
+
+		It("does not send requests whose context is already canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			err := ccClient.AppCrashedWithContext(ctx, guid, cc_client.AppCrashedRequest{}, logger)
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+			Expect(fakeCC.ReceivedRequests()).To(BeEmpty())
+		})
+
+		It("gives up on requests that outlive the deadline of their context", func() {
+			done := make(chan struct{})
+			defer close(done)
+			fakeCC.AppendHandlers(func(w http.ResponseWriter, req *http.Request) {
+				select {
+				case <-done:
+				case <-req.Context().Done():
+				}
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			err := ccClient.AppReadinessChangedWithContext(ctx, guid, cc_client.AppReadinessChangedRequest{}, logger)
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		})
+	})
+	Describe("IsRetryable", func() {
+		DescribeTable("classifies bad responses by status",
+			func(status int, retryable bool) {
+				Expect(cc_client.IsRetryable(&cc_client.BadResponseError{StatusCode: status})).To(Equal(retryable))
+			},
+			Entry("bad request", 400, false),
+			Entry("unauthorized", 401, false),
+			Entry("not found", 404, false),
+			Entry("request timeout", 408, true),
+			Entry("too many requests", 429, true),
+			Entry("internal server error", 500, true),
+			Entry("not implemented", 501, false),
+			Entry("bad gateway", 502, true),
+			Entry("service unavailable", 503, true),
+		)
+
+		It("retries failures to reach CC", func() {
+			ccClient = cc_client.NewCcClient("http://0.0.0.0.0:80", &tls.Config{}, false)
+			err := ccClient.AppCrashed(guid, cc_client.AppCrashedRequest{}, logger)
+			Expect(err).To(HaveOccurred())
+			Expect(cc_client.IsRetryable(err)).To(BeTrue())
+		})
+
+		It("retries requests that timed out but not canceled ones", func() {
+			Expect(cc_client.IsRetryable(context.DeadlineExceeded)).To(BeTrue())
+			Expect(cc_client.IsRetryable(context.Canceled)).To(BeFalse())
+			Expect(cc_client.IsRetryable(nil)).To(BeFalse())
+			Expect(cc_client.IsRetryable(errors.New("invalid payload"))).To(BeFalse())
+		})
+	})
 })
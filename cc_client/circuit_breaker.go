@@ -0,0 +1,162 @@
+package cc_client
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/cloudfoundry/dropsonde/metrics"
+)
+
+// The states of a circuit breaker. It is closed while CC accepts requests,
+// open while requests are short-circuited, and half-open while a single
+// request probes whether CC has recovered.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+const (
+	DefaultCircuitFailureThreshold = 5
+	DefaultCircuitOpenTimeout      = 30 * time.Second
+
+	circuitBreakerStateMetric    = "CCCircuitBreakerState"
+	circuitBreakerOpensCounter   = "CCCircuitBreakerOpens"
+	shortCircuitedRequestCounter = "CCRequestsShortCircuited"
+)
+
+// ErrCircuitOpen is returned without contacting CC while the circuit breaker
+// is open. The watcher spools the notifications refused with it and sends
+// them again once the breaker lets requests through.
+var ErrCircuitOpen = errors.New("CC circuit breaker is open")
+
+// circuitStateValues are the values of the state metric.
+var circuitStateValues = map[string]float64{
+	CircuitClosed:   0,
+	CircuitHalfOpen: 1,
+	CircuitOpen:     2,
+}
+
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed requests after
+	// which the circuit opens.
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before a request is let
+	// through to probe CC.
+	OpenTimeout time.Duration
+}
+
+// CircuitBreaker stops requests to CC after consecutive failures, so that
+// workers do not wait for requests that time out while CC is down. A request
+// fails when CC cannot be reached or responds with a server error. It is safe
+// for concurrent use.
+type CircuitBreaker struct {
+	clock  clock.Clock
+	config CircuitBreakerConfig
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewCircuitBreaker(clock clock.Clock, config CircuitBreakerConfig) *CircuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = DefaultCircuitFailureThreshold
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = DefaultCircuitOpenTimeout
+	}
+
+	return &CircuitBreaker{
+		clock:  clock,
+		config: config,
+		state:  CircuitClosed,
+	}
+}
+
+// State returns the current state of the circuit.
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow returns ErrCircuitOpen if the request must not be sent. Once the open
+// timeout has passed, a single request is let through as a probe.
+func (b *CircuitBreaker) allow(logger lager.Logger) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.clock.Since(b.openedAt) < b.config.OpenTimeout {
+			break
+		}
+		b.transition(logger, CircuitHalfOpen)
+		b.probing = true
+		return nil
+
+	case CircuitHalfOpen:
+		if b.probing {
+			break
+		}
+		b.probing = true
+		return nil
+
+	default:
+		return nil
+	}
+
+	metrics.IncrementCounter(shortCircuitedRequestCounter)
+	return ErrCircuitOpen
+}
+
+// record updates the circuit with the outcome of a request that was allowed.
+func (b *CircuitBreaker) record(logger lager.Logger, outcome requestOutcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitHalfOpen {
+		b.probing = false
+	}
+
+	switch outcome {
+	case requestSucceeded:
+		b.failures = 0
+		if b.state != CircuitClosed {
+			b.transition(logger, CircuitClosed)
+		}
+
+	case requestFailed:
+		b.failures++
+		if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.failures >= b.config.FailureThreshold) {
+			b.openedAt = b.clock.Now()
+			b.transition(logger, CircuitOpen)
+			metrics.IncrementCounter(circuitBreakerOpensCounter)
+		}
+	}
+}
+
+func (b *CircuitBreaker) transition(logger lager.Logger, state string) {
+	logger.Info("cc-circuit-breaker-"+state, lager.Data{"previous-state": b.state, "failures": b.failures})
+	b.state = state
+
+	if chainer := metrics.Value(circuitBreakerStateMetric, circuitStateValues[state], "Metric"); chainer != nil {
+		_ = chainer.Send()
+	}
+}
+
+type requestOutcome int
+
+const (
+	// requestIgnored is the outcome of requests that say nothing about the
+	// health of CC, such as canceled ones.
+	requestIgnored requestOutcome = iota
+	requestSucceeded
+	requestFailed
+)
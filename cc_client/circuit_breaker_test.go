@@ -0,0 +1,161 @@
+package cc_client_test
+
+import (
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	"code.cloudfoundry.org/tps/cc_client"
+	"github.com/cloudfoundry/dropsonde/emitter/fake"
+	"github.com/cloudfoundry/dropsonde/metric_sender"
+	"github.com/cloudfoundry/dropsonde/metrics"
+	sonde_events "github.com/cloudfoundry/sonde-go/events"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("CircuitBreaker", func() {
+	var (
+		fakeCC      *ghttp.Server
+		fakeClock   *fakeclock.FakeClock
+		fakeEmitter *fake.FakeEventEmitter
+		logger      *lagertest.TestLogger
+		breaker     *cc_client.CircuitBreaker
+		ccClient    cc_client.CcClient
+		status      int
+		request     cc_client.AppCrashedRequest
+	)
+
+	send := func() error {
+		return ccClient.AppCrashed("a-guid", request, logger)
+	}
+
+	counter := func(name string) uint64 {
+		var total uint64
+		for _, event := range fakeEmitter.GetEvents() {
+			if counter, ok := event.(*sonde_events.CounterEvent); ok && counter.GetName() == name {
+				total += counter.GetDelta()
+			}
+		}
+		return total
+	}
+
+	stateValues := func() []float64 {
+		var values []float64
+		for _, envelope := range fakeEmitter.GetEnvelopes() {
+			if envelope.GetEventType() == sonde_events.Envelope_ValueMetric && envelope.ValueMetric.GetName() == "CCCircuitBreakerState" {
+				values = append(values, envelope.ValueMetric.GetValue())
+			}
+		}
+		return values
+	}
+
+	BeforeEach(func() {
+		fakeCC = ghttp.NewServer()
+		status = http.StatusOK
+		fakeCC.RouteToHandler("POST", "/internal/v4/apps/a-guid/crashed", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		})
+
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		fakeEmitter = fake.NewFakeEventEmitter("tps-watcher")
+		metrics.Initialize(metric_sender.NewMetricSender(fakeEmitter), nil)
+		logger = lagertest.NewTestLogger("test")
+
+		breaker = cc_client.NewCircuitBreaker(fakeClock, cc_client.CircuitBreakerConfig{
+			FailureThreshold: 3,
+			OpenTimeout:      time.Minute,
+		})
+		pool, err := cc_client.NewEndpointPool(logger, fakeClock, []string{fakeCC.URL()}, nil, cc_client.EndpointPoolConfig{
+			Routing: cc_client.PriorityRouting,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		ccClient = cc_client.NewCcClientWithEndpoints(pool, nil, false, nil, breaker, nil, nil)
+
+		request = cc_client.AppCrashedRequest{AppCrashedRequest: cc_messages.AppCrashedRequest{Index: 1}}
+	})
+
+	AfterEach(func() {
+		fakeCC.Close()
+	})
+
+	It("starts closed", func() {
+		Expect(breaker.State()).To(Equal(cc_client.CircuitClosed))
+		Expect(send()).To(Succeed())
+	})
+
+	Context("when CC keeps failing", func() {
+		BeforeEach(func() {
+			status = http.StatusServiceUnavailable
+		})
+
+		JustBeforeEach(func() {
+			for i := 0; i < 3; i++ {
+				Expect(send()).To(BeAssignableToTypeOf(&cc_client.BadResponseError{}))
+			}
+		})
+
+		It("opens after the consecutive failures", func() {
+			Expect(breaker.State()).To(Equal(cc_client.CircuitOpen))
+			Expect(counter("CCCircuitBreakerOpens")).To(BeEquivalentTo(1))
+			Expect(stateValues()).To(Equal([]float64{2}))
+			Expect(logger).To(gbytes.Say("cc-circuit-breaker-open"))
+		})
+
+		It("short-circuits requests while it is open", func() {
+			err := send()
+			Expect(err).To(MatchError(cc_client.ErrCircuitOpen))
+			Expect(cc_client.IsRetryable(err)).To(BeTrue())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(3))
+			Expect(counter("CCRequestsShortCircuited")).To(BeEquivalentTo(1))
+		})
+
+		Context("once the open timeout has passed", func() {
+			JustBeforeEach(func() {
+				fakeClock.Increment(time.Minute)
+			})
+
+			It("closes when the probing request succeeds", func() {
+				status = http.StatusOK
+				Expect(send()).To(Succeed())
+				Expect(breaker.State()).To(Equal(cc_client.CircuitClosed))
+				Expect(stateValues()).To(Equal([]float64{2, 1, 0}))
+			})
+
+			It("opens again when the probing request fails", func() {
+				Expect(send()).NotTo(Succeed())
+				Expect(breaker.State()).To(Equal(cc_client.CircuitOpen))
+				Expect(fakeCC.ReceivedRequests()).To(HaveLen(4))
+
+				Expect(send()).To(MatchError(cc_client.ErrCircuitOpen))
+				Expect(fakeCC.ReceivedRequests()).To(HaveLen(4))
+			})
+		})
+	})
+
+	It("only counts consecutive failures", func() {
+		status = http.StatusServiceUnavailable
+		Expect(send()).NotTo(Succeed())
+		Expect(send()).NotTo(Succeed())
+
+		status = http.StatusOK
+		Expect(send()).To(Succeed())
+
+		status = http.StatusServiceUnavailable
+		Expect(send()).NotTo(Succeed())
+		Expect(send()).NotTo(Succeed())
+		Expect(breaker.State()).To(Equal(cc_client.CircuitClosed))
+	})
+
+	It("does not count requests CC rejects as failures", func() {
+		status = http.StatusBadRequest
+		for i := 0; i < 5; i++ {
+			Expect(send()).NotTo(Succeed())
+		}
+		Expect(breaker.State()).To(Equal(cc_client.CircuitClosed))
+	})
+})
@@ -0,0 +1,251 @@
+package cc_client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/cloudfoundry/dropsonde/metrics"
+)
+
+// The orders in which requests are routed to healthy endpoints: spread over
+// them in turn, or to the first one in the configured order.
+const (
+	RoundRobinRouting = "round-robin"
+	PriorityRouting   = "priority"
+)
+
+const (
+	DefaultEndpointFailureThreshold = 3
+	DefaultEndpointProbeInterval    = 10 * time.Second
+
+	endpointProbePath      = "/healthz"
+	healthyEndpointsMetric = "CCHealthyEndpoints"
+)
+
+var ErrNoEndpoints = errors.New("no CC endpoints configured")
+
+type EndpointPoolConfig struct {
+	Routing string
+	// FailureThreshold is the number of consecutive failed requests or probes
+	// after which an endpoint is considered unhealthy.
+	FailureThreshold int
+	ProbeInterval    time.Duration
+}
+
+type endpoint struct {
+	baseURI  string
+	failures int
+}
+
+// EndpointPool tracks the health of the CC endpoints from the outcome of the
+// requests sent to them and from periodic probes of their health endpoint.
+// Requests go to healthy endpoints first; unhealthy ones are only tried when
+// no healthy endpoint accepted the request. It is safe for concurrent use.
+type EndpointPool struct {
+	logger     lager.Logger
+	clock      clock.Clock
+	config     EndpointPoolConfig
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	next      int
+}
+
+func NewEndpointPool(logger lager.Logger, clock clock.Clock, baseURIs []string, tlsConfig *tls.Config, config EndpointPoolConfig) (*EndpointPool, error) {
+	if len(baseURIs) == 0 {
+		return nil, ErrNoEndpoints
+	}
+
+	switch config.Routing {
+	case RoundRobinRouting, PriorityRouting:
+	default:
+		return nil, fmt.Errorf("unknown routing %q", config.Routing)
+	}
+
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = DefaultEndpointFailureThreshold
+	}
+	if config.ProbeInterval <= 0 {
+		config.ProbeInterval = DefaultEndpointProbeInterval
+	}
+
+	pool := newEndpointPool(baseURIs, config)
+	pool.logger = logger.Session("cc-endpoint-pool")
+	pool.clock = clock
+	pool.httpClient = newHTTPClient(tlsConfig)
+	return pool, nil
+}
+
+func newEndpointPool(baseURIs []string, config EndpointPoolConfig) *EndpointPool {
+	endpoints := make([]*endpoint, len(baseURIs))
+	for i, baseURI := range baseURIs {
+		endpoints[i] = &endpoint{baseURI: baseURI}
+	}
+	return &EndpointPool{config: config, endpoints: endpoints}
+}
+
+// Healthy returns the base URIs of the healthy endpoints in the configured
+// order.
+func (p *EndpointPool) Healthy() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var healthy []string
+	for _, e := range p.endpoints {
+		if p.healthy(e) {
+			healthy = append(healthy, e.baseURI)
+		}
+	}
+	return healthy
+}
+
+// candidates returns the base URIs in the order a request should try them:
+// the healthy endpoints in routing order, followed by the unhealthy ones.
+func (p *EndpointPool) candidates() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var healthy, unhealthy []string
+	for _, e := range p.endpoints {
+		if p.healthy(e) {
+			healthy = append(healthy, e.baseURI)
+		} else {
+			unhealthy = append(unhealthy, e.baseURI)
+		}
+	}
+
+	if p.config.Routing == RoundRobinRouting && len(healthy) > 1 {
+		start := p.next % len(healthy)
+		p.next++
+		healthy = append(healthy[start:], healthy[:start]...)
+	}
+	return append(healthy, unhealthy...)
+}
+
+func (p *EndpointPool) healthy(e *endpoint) bool {
+	return e.failures < p.config.FailureThreshold
+}
+
+func (p *EndpointPool) recordSuccess(logger lager.Logger, baseURI string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, e := range p.endpoints {
+		if e.baseURI != baseURI {
+			continue
+		}
+		if !p.healthy(e) {
+			logger.Info("cc-endpoint-recovered", lager.Data{"endpoint": baseURI})
+		}
+		e.failures = 0
+	}
+}
+
+func (p *EndpointPool) recordFailure(logger lager.Logger, baseURI string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, e := range p.endpoints {
+		if e.baseURI != baseURI {
+			continue
+		}
+		e.failures++
+		if e.failures == p.config.FailureThreshold {
+			logger.Info("cc-endpoint-unhealthy", lager.Data{"endpoint": baseURI, "failures": e.failures})
+		}
+	}
+}
+
+// Run probes every endpoint each probe interval until it is signalled, so
+// that unhealthy endpoints are taken back into use once they recover and
+// failing ones are noticed before requests are sent to them.
+func (p *EndpointPool) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	logger := p.logger.Session("prober")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ticker := p.clock.NewTicker(p.config.ProbeInterval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	probed := make(chan struct{}, 1)
+	probing := false
+	for {
+		select {
+		case <-ticker.C():
+			if probing {
+				continue
+			}
+			probing = true
+			go func() {
+				p.probeAll(ctx, logger)
+				probed <- struct{}{}
+			}()
+
+		case <-probed:
+			probing = false
+
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+func (p *EndpointPool) probeAll(ctx context.Context, logger lager.Logger) {
+	p.mu.Lock()
+	baseURIs := make([]string, len(p.endpoints))
+	for i, e := range p.endpoints {
+		baseURIs[i] = e.baseURI
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, baseURI := range baseURIs {
+		wg.Add(1)
+		go func(baseURI string) {
+			defer wg.Done()
+
+			err := p.probe(ctx, baseURI)
+			if err != nil {
+				logger.Debug("probe-failed", lager.Data{"endpoint": baseURI, "error": err.Error()})
+				p.recordFailure(logger, baseURI)
+				return
+			}
+			p.recordSuccess(logger, baseURI)
+		}(baseURI)
+	}
+	wg.Wait()
+
+	if chainer := metrics.Value(healthyEndpointsMetric, float64(len(p.Healthy())), "Metric"); chainer != nil {
+		_ = chainer.Send()
+	}
+}
+
+func (p *EndpointPool) probe(ctx context.Context, baseURI string) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", baseURI+endpointProbePath, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := p.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("probe responded with status %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package cc_client_test
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	"code.cloudfoundry.org/tps/cc_client"
+	"github.com/cloudfoundry/dropsonde/emitter/fake"
+	"github.com/cloudfoundry/dropsonde/metric_sender"
+	"github.com/cloudfoundry/dropsonde/metrics"
+	sonde_events "github.com/cloudfoundry/sonde-go/events"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("EndpointPool", func() {
+	var (
+		first, second *ghttp.Server
+		baseURIs      []string
+		fakeClock     *fakeclock.FakeClock
+		logger        *lagertest.TestLogger
+		config        cc_client.EndpointPoolConfig
+		pool          *cc_client.EndpointPool
+		ccClient      cc_client.CcClient
+		request       cc_client.AppCrashedRequest
+	)
+
+	BeforeEach(func() {
+		first = ghttp.NewServer()
+		second = ghttp.NewServer()
+		first.SetAllowUnhandledRequests(true)
+		second.SetAllowUnhandledRequests(true)
+		baseURIs = []string{first.URL(), second.URL()}
+
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		logger = lagertest.NewTestLogger("test")
+		config = cc_client.EndpointPoolConfig{
+			Routing:          cc_client.PriorityRouting,
+			FailureThreshold: 2,
+			ProbeInterval:    time.Second,
+		}
+		request = cc_client.AppCrashedRequest{AppCrashedRequest: cc_messages.AppCrashedRequest{Index: 1}}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		pool, err = cc_client.NewEndpointPool(logger, fakeClock, baseURIs, nil, config)
+		Expect(err).NotTo(HaveOccurred())
+		ccClient = cc_client.NewCcClientWithEndpoints(pool, nil, false, nil, nil, nil, nil)
+	})
+
+	AfterEach(func() {
+		if first.HTTPTestServer != nil {
+			first.Close()
+		}
+		second.Close()
+	})
+
+	crashedRequests := func(server *ghttp.Server) int {
+		count := 0
+		for _, r := range server.ReceivedRequests() {
+			if r.URL.Path == "/internal/v4/apps/a-guid/crashed" {
+				count++
+			}
+		}
+		return count
+	}
+
+	Context("with priority routing", func() {
+		It("sends requests to the first healthy endpoint", func() {
+			first.RouteToHandler("POST", "/internal/v4/apps/a-guid/crashed", ghttp.RespondWith(http.StatusOK, `{}`))
+
+			Expect(ccClient.AppCrashed("a-guid", request, logger)).To(Succeed())
+			Expect(ccClient.AppCrashed("a-guid", request, logger)).To(Succeed())
+			Expect(crashedRequests(first)).To(Equal(2))
+			Expect(crashedRequests(second)).To(BeZero())
+		})
+
+		Context("when an endpoint responds with a server error", func() {
+			BeforeEach(func() {
+				first.RouteToHandler("POST", "/internal/v4/apps/a-guid/crashed", ghttp.RespondWith(http.StatusServiceUnavailable, ""))
+				second.RouteToHandler("POST", "/internal/v4/apps/a-guid/crashed", ghttp.RespondWith(http.StatusOK, `{}`))
+			})
+
+			It("fails over to the next endpoint", func() {
+				Expect(ccClient.AppCrashed("a-guid", request, logger)).To(Succeed())
+				Expect(crashedRequests(first)).To(Equal(1))
+				Expect(crashedRequests(second)).To(Equal(1))
+			})
+
+			It("stops sending requests to it once it is unhealthy", func() {
+				Expect(ccClient.AppCrashed("a-guid", request, logger)).To(Succeed())
+				Expect(ccClient.AppCrashed("a-guid", request, logger)).To(Succeed())
+				Expect(pool.Healthy()).To(Equal([]string{baseURIs[1]}))
+				Expect(logger).To(gbytes.Say("cc-endpoint-unhealthy"))
+
+				Expect(ccClient.AppCrashed("a-guid", request, logger)).To(Succeed())
+				Expect(crashedRequests(first)).To(Equal(2))
+				Expect(crashedRequests(second)).To(Equal(3))
+			})
+		})
+
+		Context("when an endpoint cannot be reached", func() {
+			BeforeEach(func() {
+				first.Close()
+				second.RouteToHandler("POST", "/internal/v4/apps/a-guid/crashed", ghttp.RespondWith(http.StatusOK, `{}`))
+			})
+
+			It("fails over to the next endpoint", func() {
+				Expect(ccClient.AppCrashed("a-guid", request, logger)).To(Succeed())
+				Expect(crashedRequests(second)).To(Equal(1))
+			})
+		})
+
+		Context("when every endpoint responds with a server error", func() {
+			BeforeEach(func() {
+				first.RouteToHandler("POST", "/internal/v4/apps/a-guid/crashed", ghttp.RespondWith(http.StatusServiceUnavailable, ""))
+				second.RouteToHandler("POST", "/internal/v4/apps/a-guid/crashed", ghttp.RespondWith(http.StatusBadGateway, ""))
+			})
+
+			It("returns the error of the last endpoint", func() {
+				err := ccClient.AppCrashed("a-guid", request, logger)
+				Expect(err).To(BeAssignableToTypeOf(&cc_client.BadResponseError{}))
+				Expect(err.(*cc_client.BadResponseError).StatusCode).To(Equal(http.StatusBadGateway))
+			})
+
+			It("still tries the unhealthy endpoints", func() {
+				for i := 0; i < 3; i++ {
+					Expect(ccClient.AppCrashed("a-guid", request, logger)).NotTo(Succeed())
+				}
+				Expect(pool.Healthy()).To(BeEmpty())
+				Expect(crashedRequests(first)).To(Equal(3))
+				Expect(crashedRequests(second)).To(Equal(3))
+			})
+		})
+
+		Context("when an endpoint rejects the request", func() {
+			BeforeEach(func() {
+				first.RouteToHandler("POST", "/internal/v4/apps/a-guid/crashed", ghttp.RespondWith(http.StatusBadRequest, ""))
+			})
+
+			It("does not fail over", func() {
+				Expect(ccClient.AppCrashed("a-guid", request, logger)).NotTo(Succeed())
+				Expect(crashedRequests(second)).To(BeZero())
+				Expect(pool.Healthy()).To(HaveLen(2))
+			})
+		})
+	})
+
+	Context("with round-robin routing", func() {
+		BeforeEach(func() {
+			config.Routing = cc_client.RoundRobinRouting
+			first.RouteToHandler("POST", "/internal/v4/apps/a-guid/crashed", ghttp.RespondWith(http.StatusOK, `{}`))
+			second.RouteToHandler("POST", "/internal/v4/apps/a-guid/crashed", ghttp.RespondWith(http.StatusOK, `{}`))
+		})
+
+		It("spreads requests over the healthy endpoints", func() {
+			for i := 0; i < 4; i++ {
+				Expect(ccClient.AppCrashed("a-guid", request, logger)).To(Succeed())
+			}
+			Expect(crashedRequests(first)).To(Equal(2))
+			Expect(crashedRequests(second)).To(Equal(2))
+		})
+	})
+
+	Describe("probing", func() {
+		var (
+			fakeEmitter *fake.FakeEventEmitter
+			process     ifrit.Process
+			firstHealth int
+		)
+
+		healthyEndpointValues := func() []float64 {
+			var values []float64
+			for _, envelope := range fakeEmitter.GetEnvelopes() {
+				if envelope.GetEventType() == sonde_events.Envelope_ValueMetric && envelope.ValueMetric.GetName() == "CCHealthyEndpoints" {
+					values = append(values, envelope.ValueMetric.GetValue())
+				}
+			}
+			return values
+		}
+
+		BeforeEach(func() {
+			fakeEmitter = fake.NewFakeEventEmitter("tps-watcher")
+			metrics.Initialize(metric_sender.NewMetricSender(fakeEmitter), nil)
+
+			firstHealth = http.StatusServiceUnavailable
+			first.RouteToHandler("GET", "/healthz", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(firstHealth)
+			})
+			second.RouteToHandler("GET", "/healthz", ghttp.RespondWith(http.StatusOK, "ok"))
+		})
+
+		JustBeforeEach(func() {
+			process = ifrit.Invoke(pool)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+		})
+
+		It("marks endpoints that fail their probes unhealthy and recovered ones healthy", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(healthyEndpointValues).Should(Equal([]float64{2}))
+
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(healthyEndpointValues).Should(Equal([]float64{2, 1}))
+			Expect(pool.Healthy()).To(Equal([]string{baseURIs[1]}))
+
+			firstHealth = http.StatusOK
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(healthyEndpointValues).Should(Equal([]float64{2, 1, 2}))
+			Expect(logger).To(gbytes.Say("cc-endpoint-recovered"))
+		})
+	})
+
+	It("requires at least one endpoint", func() {
+		_, err := cc_client.NewEndpointPool(logger, fakeClock, nil, nil, config)
+		Expect(err).To(MatchError(cc_client.ErrNoEndpoints))
+	})
+
+	It("rejects an unknown routing", func() {
+		config.Routing = "random"
+		_, err := cc_client.NewEndpointPool(logger, fakeClock, []string{first.URL()}, nil, config)
+		Expect(err).To(MatchError(`unknown routing "random"`))
+	})
+})
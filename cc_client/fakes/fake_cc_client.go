@@ -2,19 +2,73 @@
 package fakes
 
 import (
+	"context"
 	"sync"
 
 	lager "code.cloudfoundry.org/lager/v3"
-	"code.cloudfoundry.org/runtimeschema/cc_messages"
 	"code.cloudfoundry.org/tps/cc_client"
 )
 
 type FakeCcClient struct {
-	AppCrashedStub        func(string, cc_messages.AppCrashedRequest, lager.Logger) error
+	AppAvailabilityChangedStub        func(string, cc_client.AppAvailabilityChangedRequest, lager.Logger) error
+	appAvailabilityChangedMutex       sync.RWMutex
+	appAvailabilityChangedArgsForCall []struct {
+		arg1 string
+		arg2 cc_client.AppAvailabilityChangedRequest
+		arg3 lager.Logger
+	}
+	appAvailabilityChangedReturns struct {
+		result1 error
+	}
+	appAvailabilityChangedReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AppAvailabilityChangedWithContextStub        func(context.Context, string, cc_client.AppAvailabilityChangedRequest, lager.Logger) error
+	appAvailabilityChangedWithContextMutex       sync.RWMutex
+	appAvailabilityChangedWithContextArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppAvailabilityChangedRequest
+		arg4 lager.Logger
+	}
+	appAvailabilityChangedWithContextReturns struct {
+		result1 error
+	}
+	appAvailabilityChangedWithContextReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AppCrashLoopingStub        func(string, cc_client.AppCrashLoopingRequest, lager.Logger) error
+	appCrashLoopingMutex       sync.RWMutex
+	appCrashLoopingArgsForCall []struct {
+		arg1 string
+		arg2 cc_client.AppCrashLoopingRequest
+		arg3 lager.Logger
+	}
+	appCrashLoopingReturns struct {
+		result1 error
+	}
+	appCrashLoopingReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AppCrashLoopingWithContextStub        func(context.Context, string, cc_client.AppCrashLoopingRequest, lager.Logger) error
+	appCrashLoopingWithContextMutex       sync.RWMutex
+	appCrashLoopingWithContextArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppCrashLoopingRequest
+		arg4 lager.Logger
+	}
+	appCrashLoopingWithContextReturns struct {
+		result1 error
+	}
+	appCrashLoopingWithContextReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AppCrashedStub        func(string, cc_client.AppCrashedRequest, lager.Logger) error
 	appCrashedMutex       sync.RWMutex
 	appCrashedArgsForCall []struct {
 		arg1 string
-		arg2 cc_messages.AppCrashedRequest
+		arg2 cc_client.AppCrashedRequest
 		arg3 lager.Logger
 	}
 	appCrashedReturns struct {
@@ -23,11 +77,79 @@ type FakeCcClient struct {
 	appCrashedReturnsOnCall map[int]struct {
 		result1 error
 	}
-	AppReadinessChangedStub        func(string, cc_messages.AppReadinessChangedRequest, lager.Logger) error
+	AppCrashedWithContextStub        func(context.Context, string, cc_client.AppCrashedRequest, lager.Logger) error
+	appCrashedWithContextMutex       sync.RWMutex
+	appCrashedWithContextArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppCrashedRequest
+		arg4 lager.Logger
+	}
+	appCrashedWithContextReturns struct {
+		result1 error
+	}
+	appCrashedWithContextReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AppInstanceFailedToStartStub        func(string, cc_client.AppInstanceFailedToStartRequest, lager.Logger) error
+	appInstanceFailedToStartMutex       sync.RWMutex
+	appInstanceFailedToStartArgsForCall []struct {
+		arg1 string
+		arg2 cc_client.AppInstanceFailedToStartRequest
+		arg3 lager.Logger
+	}
+	appInstanceFailedToStartReturns struct {
+		result1 error
+	}
+	appInstanceFailedToStartReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AppInstanceFailedToStartWithContextStub        func(context.Context, string, cc_client.AppInstanceFailedToStartRequest, lager.Logger) error
+	appInstanceFailedToStartWithContextMutex       sync.RWMutex
+	appInstanceFailedToStartWithContextArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppInstanceFailedToStartRequest
+		arg4 lager.Logger
+	}
+	appInstanceFailedToStartWithContextReturns struct {
+		result1 error
+	}
+	appInstanceFailedToStartWithContextReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AppInstanceLostStub        func(string, cc_client.AppInstanceLostRequest, lager.Logger) error
+	appInstanceLostMutex       sync.RWMutex
+	appInstanceLostArgsForCall []struct {
+		arg1 string
+		arg2 cc_client.AppInstanceLostRequest
+		arg3 lager.Logger
+	}
+	appInstanceLostReturns struct {
+		result1 error
+	}
+	appInstanceLostReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AppInstanceLostWithContextStub        func(context.Context, string, cc_client.AppInstanceLostRequest, lager.Logger) error
+	appInstanceLostWithContextMutex       sync.RWMutex
+	appInstanceLostWithContextArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppInstanceLostRequest
+		arg4 lager.Logger
+	}
+	appInstanceLostWithContextReturns struct {
+		result1 error
+	}
+	appInstanceLostWithContextReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AppReadinessChangedStub        func(string, cc_client.AppReadinessChangedRequest, lager.Logger) error
 	appReadinessChangedMutex       sync.RWMutex
 	appReadinessChangedArgsForCall []struct {
 		arg1 string
-		arg2 cc_messages.AppReadinessChangedRequest
+		arg2 cc_client.AppReadinessChangedRequest
 		arg3 lager.Logger
 	}
 	appReadinessChangedReturns struct {
@@ -36,11 +158,52 @@ type FakeCcClient struct {
 	appReadinessChangedReturnsOnCall map[int]struct {
 		result1 error
 	}
-	AppReschedulingStub        func(string, cc_messages.AppReschedulingRequest, lager.Logger) error
+	AppReadinessChangedWithContextStub        func(context.Context, string, cc_client.AppReadinessChangedRequest, lager.Logger) error
+	appReadinessChangedWithContextMutex       sync.RWMutex
+	appReadinessChangedWithContextArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppReadinessChangedRequest
+		arg4 lager.Logger
+	}
+	appReadinessChangedWithContextReturns struct {
+		result1 error
+	}
+	appReadinessChangedWithContextReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AppRescheduledStub        func(string, cc_client.AppRescheduledRequest, lager.Logger) error
+	appRescheduledMutex       sync.RWMutex
+	appRescheduledArgsForCall []struct {
+		arg1 string
+		arg2 cc_client.AppRescheduledRequest
+		arg3 lager.Logger
+	}
+	appRescheduledReturns struct {
+		result1 error
+	}
+	appRescheduledReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AppRescheduledWithContextStub        func(context.Context, string, cc_client.AppRescheduledRequest, lager.Logger) error
+	appRescheduledWithContextMutex       sync.RWMutex
+	appRescheduledWithContextArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppRescheduledRequest
+		arg4 lager.Logger
+	}
+	appRescheduledWithContextReturns struct {
+		result1 error
+	}
+	appRescheduledWithContextReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AppReschedulingStub        func(string, cc_client.AppReschedulingRequest, lager.Logger) error
 	appReschedulingMutex       sync.RWMutex
 	appReschedulingArgsForCall []struct {
 		arg1 string
-		arg2 cc_messages.AppReschedulingRequest
+		arg2 cc_client.AppReschedulingRequest
 		arg3 lager.Logger
 	}
 	appReschedulingReturns struct {
@@ -49,16 +212,284 @@ type FakeCcClient struct {
 	appReschedulingReturnsOnCall map[int]struct {
 		result1 error
 	}
+	AppReschedulingWithContextStub        func(context.Context, string, cc_client.AppReschedulingRequest, lager.Logger) error
+	appReschedulingWithContextMutex       sync.RWMutex
+	appReschedulingWithContextArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppReschedulingRequest
+		arg4 lager.Logger
+	}
+	appReschedulingWithContextReturns struct {
+		result1 error
+	}
+	appReschedulingWithContextReturnsOnCall map[int]struct {
+		result1 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeCcClient) AppCrashed(arg1 string, arg2 cc_messages.AppCrashedRequest, arg3 lager.Logger) error {
+func (fake *FakeCcClient) AppAvailabilityChanged(arg1 string, arg2 cc_client.AppAvailabilityChangedRequest, arg3 lager.Logger) error {
+	fake.appAvailabilityChangedMutex.Lock()
+	ret, specificReturn := fake.appAvailabilityChangedReturnsOnCall[len(fake.appAvailabilityChangedArgsForCall)]
+	fake.appAvailabilityChangedArgsForCall = append(fake.appAvailabilityChangedArgsForCall, struct {
+		arg1 string
+		arg2 cc_client.AppAvailabilityChangedRequest
+		arg3 lager.Logger
+	}{arg1, arg2, arg3})
+	stub := fake.AppAvailabilityChangedStub
+	fakeReturns := fake.appAvailabilityChangedReturns
+	fake.recordInvocation("AppAvailabilityChanged", []interface{}{arg1, arg2, arg3})
+	fake.appAvailabilityChangedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCcClient) AppAvailabilityChangedCallCount() int {
+	fake.appAvailabilityChangedMutex.RLock()
+	defer fake.appAvailabilityChangedMutex.RUnlock()
+	return len(fake.appAvailabilityChangedArgsForCall)
+}
+
+func (fake *FakeCcClient) AppAvailabilityChangedCalls(stub func(string, cc_client.AppAvailabilityChangedRequest, lager.Logger) error) {
+	fake.appAvailabilityChangedMutex.Lock()
+	defer fake.appAvailabilityChangedMutex.Unlock()
+	fake.AppAvailabilityChangedStub = stub
+}
+
+func (fake *FakeCcClient) AppAvailabilityChangedArgsForCall(i int) (string, cc_client.AppAvailabilityChangedRequest, lager.Logger) {
+	fake.appAvailabilityChangedMutex.RLock()
+	defer fake.appAvailabilityChangedMutex.RUnlock()
+	argsForCall := fake.appAvailabilityChangedArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeCcClient) AppAvailabilityChangedReturns(result1 error) {
+	fake.appAvailabilityChangedMutex.Lock()
+	defer fake.appAvailabilityChangedMutex.Unlock()
+	fake.AppAvailabilityChangedStub = nil
+	fake.appAvailabilityChangedReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppAvailabilityChangedReturnsOnCall(i int, result1 error) {
+	fake.appAvailabilityChangedMutex.Lock()
+	defer fake.appAvailabilityChangedMutex.Unlock()
+	fake.AppAvailabilityChangedStub = nil
+	if fake.appAvailabilityChangedReturnsOnCall == nil {
+		fake.appAvailabilityChangedReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.appAvailabilityChangedReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppAvailabilityChangedWithContext(arg1 context.Context, arg2 string, arg3 cc_client.AppAvailabilityChangedRequest, arg4 lager.Logger) error {
+	fake.appAvailabilityChangedWithContextMutex.Lock()
+	ret, specificReturn := fake.appAvailabilityChangedWithContextReturnsOnCall[len(fake.appAvailabilityChangedWithContextArgsForCall)]
+	fake.appAvailabilityChangedWithContextArgsForCall = append(fake.appAvailabilityChangedWithContextArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppAvailabilityChangedRequest
+		arg4 lager.Logger
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.AppAvailabilityChangedWithContextStub
+	fakeReturns := fake.appAvailabilityChangedWithContextReturns
+	fake.recordInvocation("AppAvailabilityChangedWithContext", []interface{}{arg1, arg2, arg3, arg4})
+	fake.appAvailabilityChangedWithContextMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCcClient) AppAvailabilityChangedWithContextCallCount() int {
+	fake.appAvailabilityChangedWithContextMutex.RLock()
+	defer fake.appAvailabilityChangedWithContextMutex.RUnlock()
+	return len(fake.appAvailabilityChangedWithContextArgsForCall)
+}
+
+func (fake *FakeCcClient) AppAvailabilityChangedWithContextCalls(stub func(context.Context, string, cc_client.AppAvailabilityChangedRequest, lager.Logger) error) {
+	fake.appAvailabilityChangedWithContextMutex.Lock()
+	defer fake.appAvailabilityChangedWithContextMutex.Unlock()
+	fake.AppAvailabilityChangedWithContextStub = stub
+}
+
+func (fake *FakeCcClient) AppAvailabilityChangedWithContextArgsForCall(i int) (context.Context, string, cc_client.AppAvailabilityChangedRequest, lager.Logger) {
+	fake.appAvailabilityChangedWithContextMutex.RLock()
+	defer fake.appAvailabilityChangedWithContextMutex.RUnlock()
+	argsForCall := fake.appAvailabilityChangedWithContextArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeCcClient) AppAvailabilityChangedWithContextReturns(result1 error) {
+	fake.appAvailabilityChangedWithContextMutex.Lock()
+	defer fake.appAvailabilityChangedWithContextMutex.Unlock()
+	fake.AppAvailabilityChangedWithContextStub = nil
+	fake.appAvailabilityChangedWithContextReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppAvailabilityChangedWithContextReturnsOnCall(i int, result1 error) {
+	fake.appAvailabilityChangedWithContextMutex.Lock()
+	defer fake.appAvailabilityChangedWithContextMutex.Unlock()
+	fake.AppAvailabilityChangedWithContextStub = nil
+	if fake.appAvailabilityChangedWithContextReturnsOnCall == nil {
+		fake.appAvailabilityChangedWithContextReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.appAvailabilityChangedWithContextReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppCrashLooping(arg1 string, arg2 cc_client.AppCrashLoopingRequest, arg3 lager.Logger) error {
+	fake.appCrashLoopingMutex.Lock()
+	ret, specificReturn := fake.appCrashLoopingReturnsOnCall[len(fake.appCrashLoopingArgsForCall)]
+	fake.appCrashLoopingArgsForCall = append(fake.appCrashLoopingArgsForCall, struct {
+		arg1 string
+		arg2 cc_client.AppCrashLoopingRequest
+		arg3 lager.Logger
+	}{arg1, arg2, arg3})
+	stub := fake.AppCrashLoopingStub
+	fakeReturns := fake.appCrashLoopingReturns
+	fake.recordInvocation("AppCrashLooping", []interface{}{arg1, arg2, arg3})
+	fake.appCrashLoopingMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCcClient) AppCrashLoopingCallCount() int {
+	fake.appCrashLoopingMutex.RLock()
+	defer fake.appCrashLoopingMutex.RUnlock()
+	return len(fake.appCrashLoopingArgsForCall)
+}
+
+func (fake *FakeCcClient) AppCrashLoopingCalls(stub func(string, cc_client.AppCrashLoopingRequest, lager.Logger) error) {
+	fake.appCrashLoopingMutex.Lock()
+	defer fake.appCrashLoopingMutex.Unlock()
+	fake.AppCrashLoopingStub = stub
+}
+
+func (fake *FakeCcClient) AppCrashLoopingArgsForCall(i int) (string, cc_client.AppCrashLoopingRequest, lager.Logger) {
+	fake.appCrashLoopingMutex.RLock()
+	defer fake.appCrashLoopingMutex.RUnlock()
+	argsForCall := fake.appCrashLoopingArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeCcClient) AppCrashLoopingReturns(result1 error) {
+	fake.appCrashLoopingMutex.Lock()
+	defer fake.appCrashLoopingMutex.Unlock()
+	fake.AppCrashLoopingStub = nil
+	fake.appCrashLoopingReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppCrashLoopingReturnsOnCall(i int, result1 error) {
+	fake.appCrashLoopingMutex.Lock()
+	defer fake.appCrashLoopingMutex.Unlock()
+	fake.AppCrashLoopingStub = nil
+	if fake.appCrashLoopingReturnsOnCall == nil {
+		fake.appCrashLoopingReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.appCrashLoopingReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppCrashLoopingWithContext(arg1 context.Context, arg2 string, arg3 cc_client.AppCrashLoopingRequest, arg4 lager.Logger) error {
+	fake.appCrashLoopingWithContextMutex.Lock()
+	ret, specificReturn := fake.appCrashLoopingWithContextReturnsOnCall[len(fake.appCrashLoopingWithContextArgsForCall)]
+	fake.appCrashLoopingWithContextArgsForCall = append(fake.appCrashLoopingWithContextArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppCrashLoopingRequest
+		arg4 lager.Logger
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.AppCrashLoopingWithContextStub
+	fakeReturns := fake.appCrashLoopingWithContextReturns
+	fake.recordInvocation("AppCrashLoopingWithContext", []interface{}{arg1, arg2, arg3, arg4})
+	fake.appCrashLoopingWithContextMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCcClient) AppCrashLoopingWithContextCallCount() int {
+	fake.appCrashLoopingWithContextMutex.RLock()
+	defer fake.appCrashLoopingWithContextMutex.RUnlock()
+	return len(fake.appCrashLoopingWithContextArgsForCall)
+}
+
+func (fake *FakeCcClient) AppCrashLoopingWithContextCalls(stub func(context.Context, string, cc_client.AppCrashLoopingRequest, lager.Logger) error) {
+	fake.appCrashLoopingWithContextMutex.Lock()
+	defer fake.appCrashLoopingWithContextMutex.Unlock()
+	fake.AppCrashLoopingWithContextStub = stub
+}
+
+func (fake *FakeCcClient) AppCrashLoopingWithContextArgsForCall(i int) (context.Context, string, cc_client.AppCrashLoopingRequest, lager.Logger) {
+	fake.appCrashLoopingWithContextMutex.RLock()
+	defer fake.appCrashLoopingWithContextMutex.RUnlock()
+	argsForCall := fake.appCrashLoopingWithContextArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeCcClient) AppCrashLoopingWithContextReturns(result1 error) {
+	fake.appCrashLoopingWithContextMutex.Lock()
+	defer fake.appCrashLoopingWithContextMutex.Unlock()
+	fake.AppCrashLoopingWithContextStub = nil
+	fake.appCrashLoopingWithContextReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppCrashLoopingWithContextReturnsOnCall(i int, result1 error) {
+	fake.appCrashLoopingWithContextMutex.Lock()
+	defer fake.appCrashLoopingWithContextMutex.Unlock()
+	fake.AppCrashLoopingWithContextStub = nil
+	if fake.appCrashLoopingWithContextReturnsOnCall == nil {
+		fake.appCrashLoopingWithContextReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.appCrashLoopingWithContextReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppCrashed(arg1 string, arg2 cc_client.AppCrashedRequest, arg3 lager.Logger) error {
 	fake.appCrashedMutex.Lock()
 	ret, specificReturn := fake.appCrashedReturnsOnCall[len(fake.appCrashedArgsForCall)]
 	fake.appCrashedArgsForCall = append(fake.appCrashedArgsForCall, struct {
 		arg1 string
-		arg2 cc_messages.AppCrashedRequest
+		arg2 cc_client.AppCrashedRequest
 		arg3 lager.Logger
 	}{arg1, arg2, arg3})
 	stub := fake.AppCrashedStub
@@ -80,13 +511,13 @@ func (fake *FakeCcClient) AppCrashedCallCount() int {
 	return len(fake.appCrashedArgsForCall)
 }
 
-func (fake *FakeCcClient) AppCrashedCalls(stub func(string, cc_messages.AppCrashedRequest, lager.Logger) error) {
+func (fake *FakeCcClient) AppCrashedCalls(stub func(string, cc_client.AppCrashedRequest, lager.Logger) error) {
 	fake.appCrashedMutex.Lock()
 	defer fake.appCrashedMutex.Unlock()
 	fake.AppCrashedStub = stub
 }
 
-func (fake *FakeCcClient) AppCrashedArgsForCall(i int) (string, cc_messages.AppCrashedRequest, lager.Logger) {
+func (fake *FakeCcClient) AppCrashedArgsForCall(i int) (string, cc_client.AppCrashedRequest, lager.Logger) {
 	fake.appCrashedMutex.RLock()
 	defer fake.appCrashedMutex.RUnlock()
 	argsForCall := fake.appCrashedArgsForCall[i]
@@ -116,12 +547,330 @@ func (fake *FakeCcClient) AppCrashedReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
-func (fake *FakeCcClient) AppReadinessChanged(arg1 string, arg2 cc_messages.AppReadinessChangedRequest, arg3 lager.Logger) error {
+func (fake *FakeCcClient) AppCrashedWithContext(arg1 context.Context, arg2 string, arg3 cc_client.AppCrashedRequest, arg4 lager.Logger) error {
+	fake.appCrashedWithContextMutex.Lock()
+	ret, specificReturn := fake.appCrashedWithContextReturnsOnCall[len(fake.appCrashedWithContextArgsForCall)]
+	fake.appCrashedWithContextArgsForCall = append(fake.appCrashedWithContextArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppCrashedRequest
+		arg4 lager.Logger
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.AppCrashedWithContextStub
+	fakeReturns := fake.appCrashedWithContextReturns
+	fake.recordInvocation("AppCrashedWithContext", []interface{}{arg1, arg2, arg3, arg4})
+	fake.appCrashedWithContextMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCcClient) AppCrashedWithContextCallCount() int {
+	fake.appCrashedWithContextMutex.RLock()
+	defer fake.appCrashedWithContextMutex.RUnlock()
+	return len(fake.appCrashedWithContextArgsForCall)
+}
+
+func (fake *FakeCcClient) AppCrashedWithContextCalls(stub func(context.Context, string, cc_client.AppCrashedRequest, lager.Logger) error) {
+	fake.appCrashedWithContextMutex.Lock()
+	defer fake.appCrashedWithContextMutex.Unlock()
+	fake.AppCrashedWithContextStub = stub
+}
+
+func (fake *FakeCcClient) AppCrashedWithContextArgsForCall(i int) (context.Context, string, cc_client.AppCrashedRequest, lager.Logger) {
+	fake.appCrashedWithContextMutex.RLock()
+	defer fake.appCrashedWithContextMutex.RUnlock()
+	argsForCall := fake.appCrashedWithContextArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeCcClient) AppCrashedWithContextReturns(result1 error) {
+	fake.appCrashedWithContextMutex.Lock()
+	defer fake.appCrashedWithContextMutex.Unlock()
+	fake.AppCrashedWithContextStub = nil
+	fake.appCrashedWithContextReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppCrashedWithContextReturnsOnCall(i int, result1 error) {
+	fake.appCrashedWithContextMutex.Lock()
+	defer fake.appCrashedWithContextMutex.Unlock()
+	fake.AppCrashedWithContextStub = nil
+	if fake.appCrashedWithContextReturnsOnCall == nil {
+		fake.appCrashedWithContextReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.appCrashedWithContextReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppInstanceFailedToStart(arg1 string, arg2 cc_client.AppInstanceFailedToStartRequest, arg3 lager.Logger) error {
+	fake.appInstanceFailedToStartMutex.Lock()
+	ret, specificReturn := fake.appInstanceFailedToStartReturnsOnCall[len(fake.appInstanceFailedToStartArgsForCall)]
+	fake.appInstanceFailedToStartArgsForCall = append(fake.appInstanceFailedToStartArgsForCall, struct {
+		arg1 string
+		arg2 cc_client.AppInstanceFailedToStartRequest
+		arg3 lager.Logger
+	}{arg1, arg2, arg3})
+	stub := fake.AppInstanceFailedToStartStub
+	fakeReturns := fake.appInstanceFailedToStartReturns
+	fake.recordInvocation("AppInstanceFailedToStart", []interface{}{arg1, arg2, arg3})
+	fake.appInstanceFailedToStartMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCcClient) AppInstanceFailedToStartCallCount() int {
+	fake.appInstanceFailedToStartMutex.RLock()
+	defer fake.appInstanceFailedToStartMutex.RUnlock()
+	return len(fake.appInstanceFailedToStartArgsForCall)
+}
+
+func (fake *FakeCcClient) AppInstanceFailedToStartCalls(stub func(string, cc_client.AppInstanceFailedToStartRequest, lager.Logger) error) {
+	fake.appInstanceFailedToStartMutex.Lock()
+	defer fake.appInstanceFailedToStartMutex.Unlock()
+	fake.AppInstanceFailedToStartStub = stub
+}
+
+func (fake *FakeCcClient) AppInstanceFailedToStartArgsForCall(i int) (string, cc_client.AppInstanceFailedToStartRequest, lager.Logger) {
+	fake.appInstanceFailedToStartMutex.RLock()
+	defer fake.appInstanceFailedToStartMutex.RUnlock()
+	argsForCall := fake.appInstanceFailedToStartArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeCcClient) AppInstanceFailedToStartReturns(result1 error) {
+	fake.appInstanceFailedToStartMutex.Lock()
+	defer fake.appInstanceFailedToStartMutex.Unlock()
+	fake.AppInstanceFailedToStartStub = nil
+	fake.appInstanceFailedToStartReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppInstanceFailedToStartReturnsOnCall(i int, result1 error) {
+	fake.appInstanceFailedToStartMutex.Lock()
+	defer fake.appInstanceFailedToStartMutex.Unlock()
+	fake.AppInstanceFailedToStartStub = nil
+	if fake.appInstanceFailedToStartReturnsOnCall == nil {
+		fake.appInstanceFailedToStartReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.appInstanceFailedToStartReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppInstanceFailedToStartWithContext(arg1 context.Context, arg2 string, arg3 cc_client.AppInstanceFailedToStartRequest, arg4 lager.Logger) error {
+	fake.appInstanceFailedToStartWithContextMutex.Lock()
+	ret, specificReturn := fake.appInstanceFailedToStartWithContextReturnsOnCall[len(fake.appInstanceFailedToStartWithContextArgsForCall)]
+	fake.appInstanceFailedToStartWithContextArgsForCall = append(fake.appInstanceFailedToStartWithContextArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppInstanceFailedToStartRequest
+		arg4 lager.Logger
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.AppInstanceFailedToStartWithContextStub
+	fakeReturns := fake.appInstanceFailedToStartWithContextReturns
+	fake.recordInvocation("AppInstanceFailedToStartWithContext", []interface{}{arg1, arg2, arg3, arg4})
+	fake.appInstanceFailedToStartWithContextMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCcClient) AppInstanceFailedToStartWithContextCallCount() int {
+	fake.appInstanceFailedToStartWithContextMutex.RLock()
+	defer fake.appInstanceFailedToStartWithContextMutex.RUnlock()
+	return len(fake.appInstanceFailedToStartWithContextArgsForCall)
+}
+
+func (fake *FakeCcClient) AppInstanceFailedToStartWithContextCalls(stub func(context.Context, string, cc_client.AppInstanceFailedToStartRequest, lager.Logger) error) {
+	fake.appInstanceFailedToStartWithContextMutex.Lock()
+	defer fake.appInstanceFailedToStartWithContextMutex.Unlock()
+	fake.AppInstanceFailedToStartWithContextStub = stub
+}
+
+func (fake *FakeCcClient) AppInstanceFailedToStartWithContextArgsForCall(i int) (context.Context, string, cc_client.AppInstanceFailedToStartRequest, lager.Logger) {
+	fake.appInstanceFailedToStartWithContextMutex.RLock()
+	defer fake.appInstanceFailedToStartWithContextMutex.RUnlock()
+	argsForCall := fake.appInstanceFailedToStartWithContextArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeCcClient) AppInstanceFailedToStartWithContextReturns(result1 error) {
+	fake.appInstanceFailedToStartWithContextMutex.Lock()
+	defer fake.appInstanceFailedToStartWithContextMutex.Unlock()
+	fake.AppInstanceFailedToStartWithContextStub = nil
+	fake.appInstanceFailedToStartWithContextReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppInstanceFailedToStartWithContextReturnsOnCall(i int, result1 error) {
+	fake.appInstanceFailedToStartWithContextMutex.Lock()
+	defer fake.appInstanceFailedToStartWithContextMutex.Unlock()
+	fake.AppInstanceFailedToStartWithContextStub = nil
+	if fake.appInstanceFailedToStartWithContextReturnsOnCall == nil {
+		fake.appInstanceFailedToStartWithContextReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.appInstanceFailedToStartWithContextReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppInstanceLost(arg1 string, arg2 cc_client.AppInstanceLostRequest, arg3 lager.Logger) error {
+	fake.appInstanceLostMutex.Lock()
+	ret, specificReturn := fake.appInstanceLostReturnsOnCall[len(fake.appInstanceLostArgsForCall)]
+	fake.appInstanceLostArgsForCall = append(fake.appInstanceLostArgsForCall, struct {
+		arg1 string
+		arg2 cc_client.AppInstanceLostRequest
+		arg3 lager.Logger
+	}{arg1, arg2, arg3})
+	stub := fake.AppInstanceLostStub
+	fakeReturns := fake.appInstanceLostReturns
+	fake.recordInvocation("AppInstanceLost", []interface{}{arg1, arg2, arg3})
+	fake.appInstanceLostMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCcClient) AppInstanceLostCallCount() int {
+	fake.appInstanceLostMutex.RLock()
+	defer fake.appInstanceLostMutex.RUnlock()
+	return len(fake.appInstanceLostArgsForCall)
+}
+
+func (fake *FakeCcClient) AppInstanceLostCalls(stub func(string, cc_client.AppInstanceLostRequest, lager.Logger) error) {
+	fake.appInstanceLostMutex.Lock()
+	defer fake.appInstanceLostMutex.Unlock()
+	fake.AppInstanceLostStub = stub
+}
+
+func (fake *FakeCcClient) AppInstanceLostArgsForCall(i int) (string, cc_client.AppInstanceLostRequest, lager.Logger) {
+	fake.appInstanceLostMutex.RLock()
+	defer fake.appInstanceLostMutex.RUnlock()
+	argsForCall := fake.appInstanceLostArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeCcClient) AppInstanceLostReturns(result1 error) {
+	fake.appInstanceLostMutex.Lock()
+	defer fake.appInstanceLostMutex.Unlock()
+	fake.AppInstanceLostStub = nil
+	fake.appInstanceLostReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppInstanceLostReturnsOnCall(i int, result1 error) {
+	fake.appInstanceLostMutex.Lock()
+	defer fake.appInstanceLostMutex.Unlock()
+	fake.AppInstanceLostStub = nil
+	if fake.appInstanceLostReturnsOnCall == nil {
+		fake.appInstanceLostReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.appInstanceLostReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppInstanceLostWithContext(arg1 context.Context, arg2 string, arg3 cc_client.AppInstanceLostRequest, arg4 lager.Logger) error {
+	fake.appInstanceLostWithContextMutex.Lock()
+	ret, specificReturn := fake.appInstanceLostWithContextReturnsOnCall[len(fake.appInstanceLostWithContextArgsForCall)]
+	fake.appInstanceLostWithContextArgsForCall = append(fake.appInstanceLostWithContextArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppInstanceLostRequest
+		arg4 lager.Logger
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.AppInstanceLostWithContextStub
+	fakeReturns := fake.appInstanceLostWithContextReturns
+	fake.recordInvocation("AppInstanceLostWithContext", []interface{}{arg1, arg2, arg3, arg4})
+	fake.appInstanceLostWithContextMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCcClient) AppInstanceLostWithContextCallCount() int {
+	fake.appInstanceLostWithContextMutex.RLock()
+	defer fake.appInstanceLostWithContextMutex.RUnlock()
+	return len(fake.appInstanceLostWithContextArgsForCall)
+}
+
+func (fake *FakeCcClient) AppInstanceLostWithContextCalls(stub func(context.Context, string, cc_client.AppInstanceLostRequest, lager.Logger) error) {
+	fake.appInstanceLostWithContextMutex.Lock()
+	defer fake.appInstanceLostWithContextMutex.Unlock()
+	fake.AppInstanceLostWithContextStub = stub
+}
+
+func (fake *FakeCcClient) AppInstanceLostWithContextArgsForCall(i int) (context.Context, string, cc_client.AppInstanceLostRequest, lager.Logger) {
+	fake.appInstanceLostWithContextMutex.RLock()
+	defer fake.appInstanceLostWithContextMutex.RUnlock()
+	argsForCall := fake.appInstanceLostWithContextArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeCcClient) AppInstanceLostWithContextReturns(result1 error) {
+	fake.appInstanceLostWithContextMutex.Lock()
+	defer fake.appInstanceLostWithContextMutex.Unlock()
+	fake.AppInstanceLostWithContextStub = nil
+	fake.appInstanceLostWithContextReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppInstanceLostWithContextReturnsOnCall(i int, result1 error) {
+	fake.appInstanceLostWithContextMutex.Lock()
+	defer fake.appInstanceLostWithContextMutex.Unlock()
+	fake.AppInstanceLostWithContextStub = nil
+	if fake.appInstanceLostWithContextReturnsOnCall == nil {
+		fake.appInstanceLostWithContextReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.appInstanceLostWithContextReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppReadinessChanged(arg1 string, arg2 cc_client.AppReadinessChangedRequest, arg3 lager.Logger) error {
 	fake.appReadinessChangedMutex.Lock()
 	ret, specificReturn := fake.appReadinessChangedReturnsOnCall[len(fake.appReadinessChangedArgsForCall)]
 	fake.appReadinessChangedArgsForCall = append(fake.appReadinessChangedArgsForCall, struct {
 		arg1 string
-		arg2 cc_messages.AppReadinessChangedRequest
+		arg2 cc_client.AppReadinessChangedRequest
 		arg3 lager.Logger
 	}{arg1, arg2, arg3})
 	stub := fake.AppReadinessChangedStub
@@ -143,13 +892,13 @@ func (fake *FakeCcClient) AppReadinessChangedCallCount() int {
 	return len(fake.appReadinessChangedArgsForCall)
 }
 
-func (fake *FakeCcClient) AppReadinessChangedCalls(stub func(string, cc_messages.AppReadinessChangedRequest, lager.Logger) error) {
+func (fake *FakeCcClient) AppReadinessChangedCalls(stub func(string, cc_client.AppReadinessChangedRequest, lager.Logger) error) {
 	fake.appReadinessChangedMutex.Lock()
 	defer fake.appReadinessChangedMutex.Unlock()
 	fake.AppReadinessChangedStub = stub
 }
 
-func (fake *FakeCcClient) AppReadinessChangedArgsForCall(i int) (string, cc_messages.AppReadinessChangedRequest, lager.Logger) {
+func (fake *FakeCcClient) AppReadinessChangedArgsForCall(i int) (string, cc_client.AppReadinessChangedRequest, lager.Logger) {
 	fake.appReadinessChangedMutex.RLock()
 	defer fake.appReadinessChangedMutex.RUnlock()
 	argsForCall := fake.appReadinessChangedArgsForCall[i]
@@ -179,12 +928,203 @@ func (fake *FakeCcClient) AppReadinessChangedReturnsOnCall(i int, result1 error)
 	}{result1}
 }
 
-func (fake *FakeCcClient) AppRescheduling(arg1 string, arg2 cc_messages.AppReschedulingRequest, arg3 lager.Logger) error {
+func (fake *FakeCcClient) AppReadinessChangedWithContext(arg1 context.Context, arg2 string, arg3 cc_client.AppReadinessChangedRequest, arg4 lager.Logger) error {
+	fake.appReadinessChangedWithContextMutex.Lock()
+	ret, specificReturn := fake.appReadinessChangedWithContextReturnsOnCall[len(fake.appReadinessChangedWithContextArgsForCall)]
+	fake.appReadinessChangedWithContextArgsForCall = append(fake.appReadinessChangedWithContextArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppReadinessChangedRequest
+		arg4 lager.Logger
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.AppReadinessChangedWithContextStub
+	fakeReturns := fake.appReadinessChangedWithContextReturns
+	fake.recordInvocation("AppReadinessChangedWithContext", []interface{}{arg1, arg2, arg3, arg4})
+	fake.appReadinessChangedWithContextMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCcClient) AppReadinessChangedWithContextCallCount() int {
+	fake.appReadinessChangedWithContextMutex.RLock()
+	defer fake.appReadinessChangedWithContextMutex.RUnlock()
+	return len(fake.appReadinessChangedWithContextArgsForCall)
+}
+
+func (fake *FakeCcClient) AppReadinessChangedWithContextCalls(stub func(context.Context, string, cc_client.AppReadinessChangedRequest, lager.Logger) error) {
+	fake.appReadinessChangedWithContextMutex.Lock()
+	defer fake.appReadinessChangedWithContextMutex.Unlock()
+	fake.AppReadinessChangedWithContextStub = stub
+}
+
+func (fake *FakeCcClient) AppReadinessChangedWithContextArgsForCall(i int) (context.Context, string, cc_client.AppReadinessChangedRequest, lager.Logger) {
+	fake.appReadinessChangedWithContextMutex.RLock()
+	defer fake.appReadinessChangedWithContextMutex.RUnlock()
+	argsForCall := fake.appReadinessChangedWithContextArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeCcClient) AppReadinessChangedWithContextReturns(result1 error) {
+	fake.appReadinessChangedWithContextMutex.Lock()
+	defer fake.appReadinessChangedWithContextMutex.Unlock()
+	fake.AppReadinessChangedWithContextStub = nil
+	fake.appReadinessChangedWithContextReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppReadinessChangedWithContextReturnsOnCall(i int, result1 error) {
+	fake.appReadinessChangedWithContextMutex.Lock()
+	defer fake.appReadinessChangedWithContextMutex.Unlock()
+	fake.AppReadinessChangedWithContextStub = nil
+	if fake.appReadinessChangedWithContextReturnsOnCall == nil {
+		fake.appReadinessChangedWithContextReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.appReadinessChangedWithContextReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppRescheduled(arg1 string, arg2 cc_client.AppRescheduledRequest, arg3 lager.Logger) error {
+	fake.appRescheduledMutex.Lock()
+	ret, specificReturn := fake.appRescheduledReturnsOnCall[len(fake.appRescheduledArgsForCall)]
+	fake.appRescheduledArgsForCall = append(fake.appRescheduledArgsForCall, struct {
+		arg1 string
+		arg2 cc_client.AppRescheduledRequest
+		arg3 lager.Logger
+	}{arg1, arg2, arg3})
+	stub := fake.AppRescheduledStub
+	fakeReturns := fake.appRescheduledReturns
+	fake.recordInvocation("AppRescheduled", []interface{}{arg1, arg2, arg3})
+	fake.appRescheduledMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCcClient) AppRescheduledCallCount() int {
+	fake.appRescheduledMutex.RLock()
+	defer fake.appRescheduledMutex.RUnlock()
+	return len(fake.appRescheduledArgsForCall)
+}
+
+func (fake *FakeCcClient) AppRescheduledCalls(stub func(string, cc_client.AppRescheduledRequest, lager.Logger) error) {
+	fake.appRescheduledMutex.Lock()
+	defer fake.appRescheduledMutex.Unlock()
+	fake.AppRescheduledStub = stub
+}
+
+func (fake *FakeCcClient) AppRescheduledArgsForCall(i int) (string, cc_client.AppRescheduledRequest, lager.Logger) {
+	fake.appRescheduledMutex.RLock()
+	defer fake.appRescheduledMutex.RUnlock()
+	argsForCall := fake.appRescheduledArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeCcClient) AppRescheduledReturns(result1 error) {
+	fake.appRescheduledMutex.Lock()
+	defer fake.appRescheduledMutex.Unlock()
+	fake.AppRescheduledStub = nil
+	fake.appRescheduledReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppRescheduledReturnsOnCall(i int, result1 error) {
+	fake.appRescheduledMutex.Lock()
+	defer fake.appRescheduledMutex.Unlock()
+	fake.AppRescheduledStub = nil
+	if fake.appRescheduledReturnsOnCall == nil {
+		fake.appRescheduledReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.appRescheduledReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppRescheduledWithContext(arg1 context.Context, arg2 string, arg3 cc_client.AppRescheduledRequest, arg4 lager.Logger) error {
+	fake.appRescheduledWithContextMutex.Lock()
+	ret, specificReturn := fake.appRescheduledWithContextReturnsOnCall[len(fake.appRescheduledWithContextArgsForCall)]
+	fake.appRescheduledWithContextArgsForCall = append(fake.appRescheduledWithContextArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppRescheduledRequest
+		arg4 lager.Logger
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.AppRescheduledWithContextStub
+	fakeReturns := fake.appRescheduledWithContextReturns
+	fake.recordInvocation("AppRescheduledWithContext", []interface{}{arg1, arg2, arg3, arg4})
+	fake.appRescheduledWithContextMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCcClient) AppRescheduledWithContextCallCount() int {
+	fake.appRescheduledWithContextMutex.RLock()
+	defer fake.appRescheduledWithContextMutex.RUnlock()
+	return len(fake.appRescheduledWithContextArgsForCall)
+}
+
+func (fake *FakeCcClient) AppRescheduledWithContextCalls(stub func(context.Context, string, cc_client.AppRescheduledRequest, lager.Logger) error) {
+	fake.appRescheduledWithContextMutex.Lock()
+	defer fake.appRescheduledWithContextMutex.Unlock()
+	fake.AppRescheduledWithContextStub = stub
+}
+
+func (fake *FakeCcClient) AppRescheduledWithContextArgsForCall(i int) (context.Context, string, cc_client.AppRescheduledRequest, lager.Logger) {
+	fake.appRescheduledWithContextMutex.RLock()
+	defer fake.appRescheduledWithContextMutex.RUnlock()
+	argsForCall := fake.appRescheduledWithContextArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeCcClient) AppRescheduledWithContextReturns(result1 error) {
+	fake.appRescheduledWithContextMutex.Lock()
+	defer fake.appRescheduledWithContextMutex.Unlock()
+	fake.AppRescheduledWithContextStub = nil
+	fake.appRescheduledWithContextReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppRescheduledWithContextReturnsOnCall(i int, result1 error) {
+	fake.appRescheduledWithContextMutex.Lock()
+	defer fake.appRescheduledWithContextMutex.Unlock()
+	fake.AppRescheduledWithContextStub = nil
+	if fake.appRescheduledWithContextReturnsOnCall == nil {
+		fake.appRescheduledWithContextReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.appRescheduledWithContextReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppRescheduling(arg1 string, arg2 cc_client.AppReschedulingRequest, arg3 lager.Logger) error {
 	fake.appReschedulingMutex.Lock()
 	ret, specificReturn := fake.appReschedulingReturnsOnCall[len(fake.appReschedulingArgsForCall)]
 	fake.appReschedulingArgsForCall = append(fake.appReschedulingArgsForCall, struct {
 		arg1 string
-		arg2 cc_messages.AppReschedulingRequest
+		arg2 cc_client.AppReschedulingRequest
 		arg3 lager.Logger
 	}{arg1, arg2, arg3})
 	stub := fake.AppReschedulingStub
@@ -206,13 +1146,13 @@ func (fake *FakeCcClient) AppReschedulingCallCount() int {
 	return len(fake.appReschedulingArgsForCall)
 }
 
-func (fake *FakeCcClient) AppReschedulingCalls(stub func(string, cc_messages.AppReschedulingRequest, lager.Logger) error) {
+func (fake *FakeCcClient) AppReschedulingCalls(stub func(string, cc_client.AppReschedulingRequest, lager.Logger) error) {
 	fake.appReschedulingMutex.Lock()
 	defer fake.appReschedulingMutex.Unlock()
 	fake.AppReschedulingStub = stub
 }
 
-func (fake *FakeCcClient) AppReschedulingArgsForCall(i int) (string, cc_messages.AppReschedulingRequest, lager.Logger) {
+func (fake *FakeCcClient) AppReschedulingArgsForCall(i int) (string, cc_client.AppReschedulingRequest, lager.Logger) {
 	fake.appReschedulingMutex.RLock()
 	defer fake.appReschedulingMutex.RUnlock()
 	argsForCall := fake.appReschedulingArgsForCall[i]
@@ -242,15 +1182,105 @@ func (fake *FakeCcClient) AppReschedulingReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeCcClient) AppReschedulingWithContext(arg1 context.Context, arg2 string, arg3 cc_client.AppReschedulingRequest, arg4 lager.Logger) error {
+	fake.appReschedulingWithContextMutex.Lock()
+	ret, specificReturn := fake.appReschedulingWithContextReturnsOnCall[len(fake.appReschedulingWithContextArgsForCall)]
+	fake.appReschedulingWithContextArgsForCall = append(fake.appReschedulingWithContextArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 cc_client.AppReschedulingRequest
+		arg4 lager.Logger
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.AppReschedulingWithContextStub
+	fakeReturns := fake.appReschedulingWithContextReturns
+	fake.recordInvocation("AppReschedulingWithContext", []interface{}{arg1, arg2, arg3, arg4})
+	fake.appReschedulingWithContextMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCcClient) AppReschedulingWithContextCallCount() int {
+	fake.appReschedulingWithContextMutex.RLock()
+	defer fake.appReschedulingWithContextMutex.RUnlock()
+	return len(fake.appReschedulingWithContextArgsForCall)
+}
+
+func (fake *FakeCcClient) AppReschedulingWithContextCalls(stub func(context.Context, string, cc_client.AppReschedulingRequest, lager.Logger) error) {
+	fake.appReschedulingWithContextMutex.Lock()
+	defer fake.appReschedulingWithContextMutex.Unlock()
+	fake.AppReschedulingWithContextStub = stub
+}
+
+func (fake *FakeCcClient) AppReschedulingWithContextArgsForCall(i int) (context.Context, string, cc_client.AppReschedulingRequest, lager.Logger) {
+	fake.appReschedulingWithContextMutex.RLock()
+	defer fake.appReschedulingWithContextMutex.RUnlock()
+	argsForCall := fake.appReschedulingWithContextArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeCcClient) AppReschedulingWithContextReturns(result1 error) {
+	fake.appReschedulingWithContextMutex.Lock()
+	defer fake.appReschedulingWithContextMutex.Unlock()
+	fake.AppReschedulingWithContextStub = nil
+	fake.appReschedulingWithContextReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCcClient) AppReschedulingWithContextReturnsOnCall(i int, result1 error) {
+	fake.appReschedulingWithContextMutex.Lock()
+	defer fake.appReschedulingWithContextMutex.Unlock()
+	fake.AppReschedulingWithContextStub = nil
+	if fake.appReschedulingWithContextReturnsOnCall == nil {
+		fake.appReschedulingWithContextReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.appReschedulingWithContextReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeCcClient) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.appAvailabilityChangedMutex.RLock()
+	defer fake.appAvailabilityChangedMutex.RUnlock()
+	fake.appAvailabilityChangedWithContextMutex.RLock()
+	defer fake.appAvailabilityChangedWithContextMutex.RUnlock()
+	fake.appCrashLoopingMutex.RLock()
+	defer fake.appCrashLoopingMutex.RUnlock()
+	fake.appCrashLoopingWithContextMutex.RLock()
+	defer fake.appCrashLoopingWithContextMutex.RUnlock()
 	fake.appCrashedMutex.RLock()
 	defer fake.appCrashedMutex.RUnlock()
+	fake.appCrashedWithContextMutex.RLock()
+	defer fake.appCrashedWithContextMutex.RUnlock()
+	fake.appInstanceFailedToStartMutex.RLock()
+	defer fake.appInstanceFailedToStartMutex.RUnlock()
+	fake.appInstanceFailedToStartWithContextMutex.RLock()
+	defer fake.appInstanceFailedToStartWithContextMutex.RUnlock()
+	fake.appInstanceLostMutex.RLock()
+	defer fake.appInstanceLostMutex.RUnlock()
+	fake.appInstanceLostWithContextMutex.RLock()
+	defer fake.appInstanceLostWithContextMutex.RUnlock()
 	fake.appReadinessChangedMutex.RLock()
 	defer fake.appReadinessChangedMutex.RUnlock()
+	fake.appReadinessChangedWithContextMutex.RLock()
+	defer fake.appReadinessChangedWithContextMutex.RUnlock()
+	fake.appRescheduledMutex.RLock()
+	defer fake.appRescheduledMutex.RUnlock()
+	fake.appRescheduledWithContextMutex.RLock()
+	defer fake.appRescheduledWithContextMutex.RUnlock()
 	fake.appReschedulingMutex.RLock()
 	defer fake.appReschedulingMutex.RUnlock()
+	fake.appReschedulingWithContextMutex.RLock()
+	defer fake.appReschedulingWithContextMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -0,0 +1,144 @@
+package cc_client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/cloudfoundry/dropsonde/metrics"
+)
+
+// IdempotencyKeyHeader carries the idempotency key of a notification, which
+// lets CC recognize a notification it has already recorded.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const (
+	DefaultIdempotencyTTL = 5 * time.Minute
+
+	duplicateNotificationsCounter = "CCDuplicateNotificationsSkipped"
+)
+
+// IdempotencyKey returns the key of a notification about an event of an
+// instance. It depends only on the event, so a notification that is sent
+// again has the same key.
+func IdempotencyKey(instanceGuid, eventType string, crashCount int, since int64) string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{
+		instanceGuid,
+		eventType,
+		strconv.Itoa(crashCount),
+		strconv.FormatInt(since, 10),
+	}, "\x00")))
+	return hex.EncodeToString(hash[:])
+}
+
+// idempotency identifies a notification. Subject is what the notification is
+// about, such as the readiness of an instance, and key the event it reports.
+type idempotency struct {
+	subject string
+	key     string
+}
+
+func newIdempotency(subject, eventType, state string, crashCount int, since int64) idempotency {
+	notification := idempotency{subject: subject + "/" + eventType}
+	if state != "" {
+		eventType += "/" + state
+	}
+	notification.key = IdempotencyKey(subject, eventType, crashCount, since)
+	return notification
+}
+
+type delivery struct {
+	key string
+	at  time.Time
+}
+
+// Deduplicator skips notifications that were delivered within the TTL. Only
+// the last notification about a subject is remembered, so that a subject
+// that changes back, like an instance that becomes ready again, is still
+// reported. It is safe for concurrent use.
+type Deduplicator struct {
+	clock clock.Clock
+	ttl   time.Duration
+
+	mu        sync.Mutex
+	delivered map[string]delivery
+	swept     time.Time
+}
+
+func NewDeduplicator(clock clock.Clock, ttl time.Duration) *Deduplicator {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+
+	return &Deduplicator{
+		clock:     clock,
+		ttl:       ttl,
+		delivered: map[string]delivery{},
+		swept:     clock.Now(),
+	}
+}
+
+// claim returns false if the notification was the last one delivered about
+// its subject within the TTL. Otherwise it records the notification as
+// delivered, under the same lock, so that of the senders of a notification
+// only one delivers it. The returned release forgets the notification again
+// when it could not be delivered.
+func (d *Deduplicator) claim(logger lager.Logger, notification idempotency) (release func(), claimed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+	last, ok := d.delivered[notification.subject]
+	if ok && last.key == notification.key && now.Before(last.at.Add(d.ttl)) {
+		logger.Info("skipping-duplicate-notification", lager.Data{"idempotency-key": notification.key})
+		metrics.IncrementCounter(duplicateNotificationsCounter)
+		return nil, false
+	}
+
+	claim := delivery{key: notification.key, at: now}
+	d.delivered[notification.subject] = claim
+	d.sweep(now)
+
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		if d.delivered[notification.subject] != claim {
+			return
+		}
+		if ok {
+			d.delivered[notification.subject] = last
+		} else {
+			delete(d.delivered, notification.subject)
+		}
+	}, true
+}
+
+// sweep forgets deliveries older than the TTL, at most once per TTL.
+func (d *Deduplicator) sweep(now time.Time) {
+	if now.Sub(d.swept) < d.ttl {
+		return
+	}
+	for subject, last := range d.delivered {
+		if !now.Before(last.at.Add(d.ttl)) {
+			delete(d.delivered, subject)
+		}
+	}
+	d.swept = now
+}
+
+// batchIdempotencyKey returns the key of a batch, which depends only on the
+// keys of its notifications.
+func batchIdempotencyKey(items []*batchItem) string {
+	hash := sha256.New()
+	for _, item := range items {
+		hash.Write([]byte(item.notification.IdempotencyKey))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,180 @@
+package cc_client_test
+
+import (
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	"code.cloudfoundry.org/tps/cc_client"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("Idempotency", func() {
+	var (
+		fakeCC       *ghttp.Server
+		fakeClock    *fakeclock.FakeClock
+		logger       *lagertest.TestLogger
+		deduplicator *cc_client.Deduplicator
+		ccClient     cc_client.CcClient
+		status       int
+		keys         []string
+	)
+
+	crash := func(crashCount int, since int64) cc_client.AppCrashedRequest {
+		return cc_client.AppCrashedRequest{AppCrashedRequest: cc_messages.AppCrashedRequest{
+			Instance:       "instance-guid",
+			Index:          1,
+			CrashCount:     crashCount,
+			CrashTimestamp: since,
+		}}
+	}
+
+	readiness := func(ready bool, since int64) cc_client.AppReadinessChangedRequest {
+		return cc_client.AppReadinessChangedRequest{
+			AppReadinessChangedRequest: cc_messages.AppReadinessChangedRequest{
+				Instance: "instance-guid",
+				Index:    1,
+				Ready:    ready,
+			},
+			Since: since,
+		}
+	}
+
+	BeforeEach(func() {
+		fakeCC = ghttp.NewServer()
+		status = http.StatusOK
+		keys = nil
+		record := func(w http.ResponseWriter, r *http.Request) {
+			keys = append(keys, r.Header.Get(cc_client.IdempotencyKeyHeader))
+			w.WriteHeader(status)
+		}
+		fakeCC.RouteToHandler("POST", "/internal/v4/apps/a-guid/crashed", record)
+		fakeCC.RouteToHandler("POST", "/internal/v4/apps/a-guid/readiness_changed", record)
+
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		logger = lagertest.NewTestLogger("test")
+		deduplicator = nil
+	})
+
+	JustBeforeEach(func() {
+		pool, err := cc_client.NewEndpointPool(logger, fakeClock, []string{fakeCC.URL()}, nil, cc_client.EndpointPoolConfig{
+			Routing: cc_client.PriorityRouting,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		ccClient = cc_client.NewCcClientWithEndpoints(pool, nil, false, nil, nil, nil, deduplicator)
+	})
+
+	AfterEach(func() {
+		fakeCC.Close()
+	})
+
+	Describe("IdempotencyKey", func() {
+		It("depends only on the event", func() {
+			key := cc_client.IdempotencyKey("instance-guid", "app_crashed", 2, 1234)
+			Expect(cc_client.IdempotencyKey("instance-guid", "app_crashed", 2, 1234)).To(Equal(key))
+
+			Expect(cc_client.IdempotencyKey("other-guid", "app_crashed", 2, 1234)).NotTo(Equal(key))
+			Expect(cc_client.IdempotencyKey("instance-guid", "app_rescheduling", 2, 1234)).NotTo(Equal(key))
+			Expect(cc_client.IdempotencyKey("instance-guid", "app_crashed", 3, 1234)).NotTo(Equal(key))
+			Expect(cc_client.IdempotencyKey("instance-guid", "app_crashed", 2, 1235)).NotTo(Equal(key))
+		})
+	})
+
+	It("sends the idempotency key of the notification", func() {
+		Expect(ccClient.AppCrashed("a-guid", crash(2, 1234), logger)).To(Succeed())
+		Expect(ccClient.AppCrashed("a-guid", crash(2, 1234), logger)).To(Succeed())
+		Expect(ccClient.AppCrashed("a-guid", crash(3, 5678), logger)).To(Succeed())
+
+		Expect(keys).To(HaveLen(3))
+		Expect(keys[0]).To(Equal(cc_client.IdempotencyKey("instance-guid", "app_crashed", 2, 1234)))
+		Expect(keys[1]).To(Equal(keys[0]))
+		Expect(keys[2]).To(Equal(cc_client.IdempotencyKey("instance-guid", "app_crashed", 3, 5678)))
+	})
+
+	It("distinguishes the states an instance changes between", func() {
+		Expect(ccClient.AppReadinessChanged("a-guid", readiness(true, 1000), logger)).To(Succeed())
+		Expect(ccClient.AppReadinessChanged("a-guid", readiness(false, 1000), logger)).To(Succeed())
+
+		Expect(keys).To(HaveLen(2))
+		Expect(keys[0]).NotTo(Equal(keys[1]))
+	})
+
+	It("distinguishes separate changes to the same state", func() {
+		Expect(ccClient.AppReadinessChanged("a-guid", readiness(true, 1000), logger)).To(Succeed())
+		Expect(ccClient.AppReadinessChanged("a-guid", readiness(true, 2000), logger)).To(Succeed())
+
+		Expect(keys).To(HaveLen(2))
+		Expect(keys[0]).NotTo(Equal(keys[1]))
+	})
+
+	Context("with a deduplicator", func() {
+		BeforeEach(func() {
+			deduplicator = cc_client.NewDeduplicator(fakeClock, time.Minute)
+		})
+
+		It("skips a notification that was delivered within the TTL", func() {
+			Expect(ccClient.AppCrashed("a-guid", crash(2, 1234), logger)).To(Succeed())
+			Expect(ccClient.AppCrashed("a-guid", crash(2, 1234), logger)).To(Succeed())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+			Expect(logger).To(gbytes.Say("skipping-duplicate-notification"))
+
+			Expect(ccClient.AppCrashed("a-guid", crash(3, 5678), logger)).To(Succeed())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(2))
+		})
+
+		It("sends the notification again once the TTL has passed", func() {
+			Expect(ccClient.AppCrashed("a-guid", crash(2, 1234), logger)).To(Succeed())
+			fakeClock.Increment(time.Minute)
+			Expect(ccClient.AppCrashed("a-guid", crash(2, 1234), logger)).To(Succeed())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(2))
+		})
+
+		It("sends a notification again when it was not delivered", func() {
+			status = http.StatusServiceUnavailable
+			Expect(ccClient.AppCrashed("a-guid", crash(2, 1234), logger)).NotTo(Succeed())
+
+			status = http.StatusOK
+			Expect(ccClient.AppCrashed("a-guid", crash(2, 1234), logger)).To(Succeed())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(2))
+		})
+
+		It("delivers a notification that is sent concurrently only once", func() {
+			release := make(chan struct{})
+			fakeCC.RouteToHandler("POST", "/internal/v4/apps/a-guid/crashed", func(http.ResponseWriter, *http.Request) {
+				<-release
+			})
+
+			first := make(chan error, 1)
+			go func() {
+				first <- ccClient.AppCrashed("a-guid", crash(2, 1234), logger)
+			}()
+			Eventually(fakeCC.ReceivedRequests).Should(HaveLen(1))
+
+			Expect(ccClient.AppCrashed("a-guid", crash(2, 1234), logger)).To(Succeed())
+			close(release)
+			Eventually(first).Should(Receive(BeNil()))
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+		})
+
+		It("reports an instance that changes back to a previous state", func() {
+			Expect(ccClient.AppReadinessChanged("a-guid", readiness(true, 1000), logger)).To(Succeed())
+			Expect(ccClient.AppReadinessChanged("a-guid", readiness(false, 2000), logger)).To(Succeed())
+			Expect(ccClient.AppReadinessChanged("a-guid", readiness(true, 3000), logger)).To(Succeed())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(3))
+
+			Expect(ccClient.AppReadinessChanged("a-guid", readiness(true, 3000), logger)).To(Succeed())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(3))
+		})
+
+		It("reports a second change to the same state", func() {
+			Expect(ccClient.AppReadinessChanged("a-guid", readiness(true, 1000), logger)).To(Succeed())
+			Expect(ccClient.AppReadinessChanged("a-guid", readiness(true, 2000), logger)).To(Succeed())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(2))
+		})
+	})
+})
@@ -0,0 +1,99 @@
+package cc_client
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"code.cloudfoundry.org/tlsconfig"
+)
+
+const (
+	// InternalTLSProfile only allows RSA certificates and is the default.
+	InternalTLSProfile = "internal"
+	// ExternalTLSProfile also allows ECDSA certificates.
+	ExternalTLSProfile = "external"
+)
+
+// TLSPolicy restricts the TLS connections the client makes to the CC. Zero
+// values keep the settings of the profile.
+type TLSPolicy struct {
+	Profile          string
+	MinVersion       uint16
+	MaxVersion       uint16
+	CipherSuites     []uint16
+	CurvePreferences []tls.CurveID
+	ServerName       string
+}
+
+// NewClientTLSConfig builds the configuration of the TLS connections to the CC
+// from the profile of the policy, then applies the rest of the policy. Without
+// a certificate file no client certificate is presented, as when the client
+// authenticates with tokens, and without a CA file the system roots are used.
+func NewClientTLSConfig(certFile, keyFile, caCertFile string, policy TLSPolicy) (*tls.Config, error) {
+	profile, err := tlsProfile(policy.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []tlsconfig.TLSOption{profile}
+	if certFile != "" {
+		tlsCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load keypair: %s", err.Error())
+		}
+		options = append(options, withCertificate(tlsCert))
+	}
+	options = append(options, withPolicy(policy))
+
+	var clientOptions []tlsconfig.ClientOption
+	if caCertFile != "" {
+		clientOptions = append(clientOptions, tlsconfig.WithAuthorityFromFile(caCertFile))
+	}
+	if policy.ServerName != "" {
+		clientOptions = append(clientOptions, tlsconfig.WithServerName(policy.ServerName))
+	}
+
+	return tlsconfig.Build(options...).Client(clientOptions...)
+}
+
+func tlsProfile(name string) (tlsconfig.TLSOption, error) {
+	switch name {
+	case "", InternalTLSProfile:
+		return tlsconfig.WithInternalServiceDefaults(), nil
+	case ExternalTLSProfile:
+		return tlsconfig.WithExternalServiceDefaults(), nil
+	default:
+		return nil, fmt.Errorf("unknown TLS profile %q", name)
+	}
+}
+
+// withCertificate presents the certificate like NewTLSConfig does, without the
+// expiry check of tlsconfig.WithIdentity. The remaining validity is reported
+// by the certificate reloader instead.
+func withCertificate(cert tls.Certificate) tlsconfig.TLSOption {
+	return func(c *tls.Config) error {
+		c.Certificates = []tls.Certificate{cert}
+		return nil
+	}
+}
+
+func withPolicy(policy TLSPolicy) tlsconfig.TLSOption {
+	return func(c *tls.Config) error {
+		if policy.MinVersion != 0 {
+			c.MinVersion = policy.MinVersion
+		}
+		if policy.MaxVersion != 0 {
+			c.MaxVersion = policy.MaxVersion
+		}
+		if len(policy.CipherSuites) > 0 {
+			c.CipherSuites = policy.CipherSuites
+		}
+		if len(policy.CurvePreferences) > 0 {
+			c.CurvePreferences = policy.CurvePreferences
+		}
+		if c.MinVersion > c.MaxVersion {
+			return fmt.Errorf("minimum TLS version %s is above the maximum %s", tls.VersionName(c.MinVersion), tls.VersionName(c.MaxVersion))
+		}
+		return nil
+	}
+}
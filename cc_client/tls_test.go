@@ -0,0 +1,114 @@
+package cc_client_test
+
+import (
+	"crypto/tls"
+
+	"code.cloudfoundry.org/tps/cc_client"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NewClientTLSConfig", func() {
+	var policy cc_client.TLSPolicy
+
+	newConfig := func() (*tls.Config, error) {
+		return cc_client.NewClientTLSConfig(
+			"../fixtures/watcher_cc_client.crt",
+			"../fixtures/watcher_cc_client.key",
+			"../fixtures/watcher_cc_ca.crt",
+			policy,
+		)
+	}
+
+	BeforeEach(func() {
+		policy = cc_client.TLSPolicy{}
+	})
+
+	It("uses the internal service profile by default", func() {
+		tlsConfig, err := newConfig()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(tlsConfig.Certificates).To(HaveLen(1))
+		Expect(tlsConfig.RootCAs).NotTo(BeNil())
+		Expect(tlsConfig.MinVersion).To(BeEquivalentTo(tls.VersionTLS12))
+		Expect(tlsConfig.MaxVersion).To(BeEquivalentTo(tls.VersionTLS13))
+		Expect(tlsConfig.CipherSuites).To(ConsistOf(
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		))
+		Expect(tlsConfig.ServerName).To(BeEmpty())
+	})
+
+	Context("with the external service profile", func() {
+		BeforeEach(func() {
+			policy.Profile = cc_client.ExternalTLSProfile
+		})
+
+		It("allows ECDSA cipher suites", func() {
+			tlsConfig, err := newConfig()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tlsConfig.CipherSuites).To(ContainElement(tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256))
+		})
+	})
+
+	Context("with a policy", func() {
+		BeforeEach(func() {
+			policy = cc_client.TLSPolicy{
+				MinVersion:       tls.VersionTLS13,
+				MaxVersion:       tls.VersionTLS13,
+				CurvePreferences: []tls.CurveID{tls.X25519},
+				ServerName:       "cloud-controller-ng.service.cf.internal",
+			}
+		})
+
+		It("overrides the profile settings", func() {
+			tlsConfig, err := newConfig()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(tlsConfig.MinVersion).To(BeEquivalentTo(tls.VersionTLS13))
+			Expect(tlsConfig.MaxVersion).To(BeEquivalentTo(tls.VersionTLS13))
+			Expect(tlsConfig.CurvePreferences).To(Equal([]tls.CurveID{tls.X25519}))
+			Expect(tlsConfig.ServerName).To(Equal("cloud-controller-ng.service.cf.internal"))
+		})
+
+		It("replaces the profile cipher suites with the configured ones", func() {
+			policy.MinVersion = 0
+			policy.CipherSuites = []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}
+
+			tlsConfig, err := newConfig()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tlsConfig.CipherSuites).To(Equal([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}))
+		})
+
+		It("fails when the minimum version is above the maximum", func() {
+			policy.MaxVersion = tls.VersionTLS12
+
+			_, err := newConfig()
+			Expect(err).To(MatchError(ContainSubstring("minimum TLS version TLS 1.3 is above the maximum TLS 1.2")))
+		})
+	})
+
+	It("presents no client certificate without a certificate file", func() {
+		tlsConfig, err := cc_client.NewClientTLSConfig("", "", "../fixtures/watcher_cc_ca.crt", policy)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tlsConfig.Certificates).To(BeEmpty())
+		Expect(tlsConfig.RootCAs).NotTo(BeNil())
+	})
+
+	It("fails with an unknown profile", func() {
+		policy.Profile = "modern"
+
+		_, err := newConfig()
+		Expect(err).To(MatchError(`unknown TLS profile "modern"`))
+	})
+
+	It("fails when the CA certificate cannot be read", func() {
+		_, err := cc_client.NewClientTLSConfig(
+			"../fixtures/watcher_cc_client.crt",
+			"../fixtures/watcher_cc_client.key",
+			"../fixtures/missing.crt",
+			policy,
+		)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,147 @@
+package cc_client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+)
+
+const (
+	uaaTokenPath = "/oauth/token"
+
+	// tokenRefreshMargin is how long before its expiry a token is replaced, so
+	// that it does not expire while a request is in flight.
+	tokenRefreshMargin = 30 * time.Second
+)
+
+// TokenSource provides the bearer tokens that authenticate requests to CC.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+	// Invalidate discards the given token after CC rejected it, so that the
+	// next call to Token obtains a new one.
+	Invalidate(token string)
+}
+
+// UAAError is returned when UAA does not issue a token.
+type UAAError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *UAAError) Error() string {
+	return fmt.Sprintf("UAA token request failed with %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable returns whether the token request may succeed when it is made
+// again. Rejected client credentials are not retryable.
+func (e *UAAError) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+type uaaTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// UAATokenSource obtains tokens from UAA with the client credentials grant and
+// caches them until shortly before they expire. It is safe for concurrent use.
+type UAATokenSource struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	httpClient   *http.Client
+	clock        clock.Clock
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+}
+
+func NewUAATokenSource(uaaURL, clientID, clientSecret string, tlsConfig *tls.Config, clock clock.Clock) *UAATokenSource {
+	return &UAATokenSource{
+		tokenURL:     strings.TrimRight(uaaURL, "/") + uaaTokenPath,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		clock:        clock,
+		httpClient:   newHTTPClient(tlsConfig),
+	}
+}
+
+// Token returns the cached token, or obtains a new one when there is none or
+// it is about to expire. Concurrent callers wait for a single token request.
+func (s *UAATokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && s.clock.Now().Before(s.refreshAt) {
+		return s.token, nil
+	}
+
+	requestedAt := s.clock.Now()
+	token, err := s.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("UAA token response has no access token")
+	}
+
+	lifetime := time.Duration(token.ExpiresIn) * time.Second
+	margin := tokenRefreshMargin
+	if margin > lifetime/2 {
+		margin = lifetime / 2
+	}
+
+	s.token = token.AccessToken
+	s.refreshAt = requestedAt.Add(lifetime - margin)
+	return s.token, nil
+}
+
+func (s *UAATokenSource) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+func (s *UAATokenSource) fetch(ctx context.Context) (uaaTokenResponse, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	request, err := http.NewRequestWithContext(ctx, "POST", s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return uaaTokenResponse{}, err
+	}
+	request.Header.Set("content-type", "application/x-www-form-urlencoded")
+	request.Header.Set("accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(s.clientSecret))
+
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return uaaTokenResponse{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, maxErrorBodyDetail))
+		return uaaTokenResponse{}, &UAAError{StatusCode: response.StatusCode, Body: string(body)}
+	}
+
+	var token uaaTokenResponse
+	err = json.NewDecoder(response.Body).Decode(&token)
+	if err != nil {
+		return uaaTokenResponse{}, err
+	}
+	return token, nil
+}
@@ -0,0 +1,197 @@
+package cc_client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	"code.cloudfoundry.org/tps/cc_client"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("UAATokenSource", func() {
+	var (
+		fakeUAA   *ghttp.Server
+		fakeClock *fakeclock.FakeClock
+		tokens    *cc_client.UAATokenSource
+	)
+
+	respondWithToken := func(token string, expiresIn int) http.HandlerFunc {
+		return ghttp.CombineHandlers(
+			ghttp.VerifyRequest("POST", "/oauth/token"),
+			ghttp.VerifyBasicAuth("tps_watcher", "secret"),
+			ghttp.VerifyContentType("application/x-www-form-urlencoded"),
+			ghttp.VerifyForm(map[string][]string{"grant_type": {"client_credentials"}}),
+			ghttp.RespondWithJSONEncoded(http.StatusOK, map[string]interface{}{
+				"access_token": token,
+				"token_type":   "bearer",
+				"expires_in":   expiresIn,
+			}),
+		)
+	}
+
+	BeforeEach(func() {
+		fakeUAA = ghttp.NewServer()
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		tokens = cc_client.NewUAATokenSource(fakeUAA.URL(), "tps_watcher", "secret", nil, fakeClock)
+	})
+
+	AfterEach(func() {
+		fakeUAA.Close()
+	})
+
+	It("obtains a token with the client credentials and caches it", func() {
+		fakeUAA.AppendHandlers(respondWithToken("first-token", 600))
+
+		Expect(tokens.Token(context.Background())).To(Equal("first-token"))
+		Expect(tokens.Token(context.Background())).To(Equal("first-token"))
+		Expect(fakeUAA.ReceivedRequests()).To(HaveLen(1))
+	})
+
+	It("replaces the token shortly before it expires", func() {
+		fakeUAA.AppendHandlers(
+			respondWithToken("first-token", 600),
+			respondWithToken("second-token", 600),
+		)
+		Expect(tokens.Token(context.Background())).To(Equal("first-token"))
+
+		fakeClock.Increment(569 * time.Second)
+		Expect(tokens.Token(context.Background())).To(Equal("first-token"))
+
+		fakeClock.Increment(time.Second)
+		Expect(tokens.Token(context.Background())).To(Equal("second-token"))
+		Expect(fakeUAA.ReceivedRequests()).To(HaveLen(2))
+	})
+
+	It("obtains a new token once the current one is invalidated", func() {
+		fakeUAA.AppendHandlers(
+			respondWithToken("first-token", 600),
+			respondWithToken("second-token", 600),
+		)
+		Expect(tokens.Token(context.Background())).To(Equal("first-token"))
+
+		tokens.Invalidate("stale-token")
+		Expect(tokens.Token(context.Background())).To(Equal("first-token"))
+
+		tokens.Invalidate("first-token")
+		Expect(tokens.Token(context.Background())).To(Equal("second-token"))
+	})
+
+	Context("when UAA does not issue a token", func() {
+		BeforeEach(func() {
+			fakeUAA.AppendHandlers(ghttp.RespondWith(http.StatusUnauthorized, `{"error":"unauthorized"}`))
+		})
+
+		It("returns a UAAError that is not retryable", func() {
+			_, err := tokens.Token(context.Background())
+
+			var uaaErr *cc_client.UAAError
+			Expect(err).To(BeAssignableToTypeOf(uaaErr))
+			Expect(err).To(MatchError(`UAA token request failed with 401: {"error":"unauthorized"}`))
+			Expect(cc_client.IsRetryable(err)).To(BeFalse())
+		})
+	})
+
+	Context("when UAA is unavailable", func() {
+		BeforeEach(func() {
+			fakeUAA.AppendHandlers(ghttp.RespondWith(http.StatusServiceUnavailable, ""))
+		})
+
+		It("returns a retryable error", func() {
+			_, err := tokens.Token(context.Background())
+			Expect(cc_client.IsRetryable(err)).To(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("OAuth CC Client", func() {
+	var (
+		fakeCC, fakeUAA *ghttp.Server
+		ccClient        cc_client.CcClient
+		logger          *lagertest.TestLogger
+		request         cc_client.AppCrashedRequest
+	)
+
+	respondWithToken := func(token string) http.HandlerFunc {
+		return ghttp.RespondWithJSONEncoded(http.StatusOK, map[string]interface{}{
+			"access_token": token,
+			"expires_in":   600,
+		})
+	}
+
+	BeforeEach(func() {
+		fakeCC = ghttp.NewServer()
+		fakeUAA = ghttp.NewServer()
+		logger = lagertest.NewTestLogger("test")
+
+		tokens := cc_client.NewUAATokenSource(fakeUAA.URL(), "tps_watcher", "secret", nil, fakeclock.NewFakeClock(time.Now()))
+		ccClient = cc_client.NewOAuthCcClient(fakeCC.URL(), nil, false, tokens)
+
+		request = cc_client.AppCrashedRequest{AppCrashedRequest: cc_messages.AppCrashedRequest{Index: 1}}
+	})
+
+	AfterEach(func() {
+		fakeCC.Close()
+		fakeUAA.Close()
+	})
+
+	It("sends the token as a bearer token", func() {
+		fakeUAA.AppendHandlers(respondWithToken("first-token"))
+		fakeCC.AppendHandlers(ghttp.CombineHandlers(
+			ghttp.VerifyRequest("POST", "/internal/v4/apps/a-guid/crashed"),
+			ghttp.VerifyHeaderKV("Authorization", "bearer first-token"),
+			ghttp.RespondWith(http.StatusOK, `{}`),
+		))
+
+		Expect(ccClient.AppCrashed("a-guid", request, logger)).To(Succeed())
+	})
+
+	It("sends the request once more with a new token when CC rejects the token", func() {
+		fakeUAA.AppendHandlers(respondWithToken("first-token"), respondWithToken("second-token"))
+		fakeCC.AppendHandlers(
+			ghttp.CombineHandlers(
+				ghttp.VerifyHeaderKV("Authorization", "bearer first-token"),
+				ghttp.RespondWith(http.StatusUnauthorized, `{}`),
+			),
+			ghttp.CombineHandlers(
+				ghttp.VerifyHeaderKV("Authorization", "bearer second-token"),
+				ghttp.VerifyJSON(`{"instance":"","index":1,"cell_id":"","reason":"","crash_count":0,"crash_timestamp":0}`),
+				ghttp.RespondWith(http.StatusOK, `{}`),
+			),
+		)
+
+		Expect(ccClient.AppCrashed("a-guid", request, logger)).To(Succeed())
+		Expect(fakeCC.ReceivedRequests()).To(HaveLen(2))
+	})
+
+	It("gives up when CC rejects the new token as well", func() {
+		fakeUAA.AppendHandlers(respondWithToken("first-token"), respondWithToken("second-token"))
+		fakeCC.AppendHandlers(
+			ghttp.RespondWith(http.StatusUnauthorized, `{}`),
+			ghttp.RespondWith(http.StatusUnauthorized, `{}`),
+		)
+
+		err := ccClient.AppCrashed("a-guid", request, logger)
+
+		var badResponse *cc_client.BadResponseError
+		Expect(err).To(BeAssignableToTypeOf(badResponse))
+		Expect(err.(*cc_client.BadResponseError).StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(fakeCC.ReceivedRequests()).To(HaveLen(2))
+	})
+
+	It("does not call CC when no token can be obtained", func() {
+		fakeUAA.AppendHandlers(ghttp.RespondWith(http.StatusUnauthorized, ""))
+
+		err := ccClient.AppCrashed("a-guid", request, logger)
+
+		var uaaErr *cc_client.UAAError
+		Expect(errors.As(err, &uaaErr)).To(BeTrue())
+		Expect(fakeCC.ReceivedRequests()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,13 @@
+package certreload_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCertreload(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Certreload Suite")
+}
@@ -0,0 +1,262 @@
+package certreload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/tps/taggedmetrics"
+	"github.com/cloudfoundry/dropsonde/metrics"
+)
+
+const DefaultReloadInterval = time.Minute
+
+const (
+	certificateReloadsCounter        = "CertificateReloads"
+	certificateReloadFailuresCounter = "CertificateReloadFailures"
+	clientCertificateExpiryMetric    = "ClientCertificateExpiresIn"
+	caCertificateExpiryMetric        = "CACertificateExpiresIn"
+)
+
+var (
+	ErrNoCACertificates = errors.New("no CA certificates found")
+	ErrNoServerName     = errors.New("no server name to verify the server certificate against")
+)
+
+// Reloader holds a client certificate and the CA certificates that verify the
+// server, and reloads them whenever their files change so that credentials
+// can be rotated without a restart. It reports how long the certificates
+// remain valid on every check. It is safe for concurrent use.
+type Reloader struct {
+	logger   lager.Logger
+	clock    clock.Clock
+	interval time.Duration
+	name     string
+
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	rootCAs     *x509.CertPool
+	certExpiry  time.Time
+	caExpiry    time.Time
+	checksum    [sha256.Size]byte
+	onReload    []func()
+}
+
+// New loads the certificate, key and CA certificates. The name identifies the
+// certificates in logs and metrics.
+func New(logger lager.Logger, clock clock.Clock, interval time.Duration, name, certFile, keyFile, caFile string) (*Reloader, error) {
+	r := &Reloader{
+		logger:   logger.Session("cert-reloader", lager.Data{"certificate": name}),
+		clock:    clock,
+		interval: interval,
+		name:     name,
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+
+	_, err := r.reload()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// OnReload registers a function that is called after the certificates have
+// been reloaded. It must be called before the reloader is run.
+func (r *Reloader) OnReload(f func()) {
+	r.onReload = append(r.onReload, f)
+}
+
+// ClientTLSConfig returns a copy of base that presents the current client
+// certificate and verifies the server against the current CA certificates.
+// The server certificate must be valid for the ServerName of base or, without
+// it, for the host that was dialed. Go does not report hosts that are IP
+// addresses, so serverName, the host of the server if it is known, is
+// verified in that case.
+func (r *Reloader) ClientTLSConfig(base *tls.Config, serverName string) *tls.Config {
+	config := base.Clone()
+	config.Certificates = nil
+	config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return r.certificate, nil
+	}
+
+	// The default verification would use a fixed root pool, so it is replaced
+	// by one against the current pool.
+	config.RootCAs = nil
+	config.InsecureSkipVerify = true
+	configured := base.ServerName
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		name := configured
+		if name == "" {
+			name = state.ServerName
+		}
+		if name == "" {
+			name = serverName
+		}
+		return r.verifyConnection(state, name)
+	}
+	return config
+}
+
+func (r *Reloader) verifyConnection(state tls.ConnectionState, serverName string) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	if serverName == "" {
+		return ErrNoServerName
+	}
+
+	r.mu.RLock()
+	roots := r.rootCAs
+	r.mu.RUnlock()
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// Run checks the files for changes every interval until it is signalled.
+// Certificates that fail to load are reported and the previous ones are kept.
+func (r *Reloader) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	r.reportExpiry()
+
+	ticker := r.clock.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-ticker.C():
+			reloaded, err := r.reload()
+			if err != nil {
+				r.logger.Error("failed-reloading-certificates", err)
+				metrics.IncrementCounter(certificateReloadFailuresCounter)
+			} else if reloaded {
+				r.logger.Info("reloaded-certificates")
+				metrics.IncrementCounter(certificateReloadsCounter)
+				for _, f := range r.onReload {
+					f()
+				}
+			}
+			r.reportExpiry()
+
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+// reload loads the files if their contents changed since they were last
+// loaded.
+func (r *Reloader) reload() (bool, error) {
+	certPEM, err := os.ReadFile(r.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyPEM, err := os.ReadFile(r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	caPEM, err := os.ReadFile(r.caFile)
+	if err != nil {
+		return false, err
+	}
+
+	checksum := sha256.Sum256(bytes.Join([][]byte{certPEM, keyPEM, caPEM}, []byte{0}))
+	r.mu.RLock()
+	unchanged := r.certificate != nil && checksum == r.checksum
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, err
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return false, err
+	}
+	certificate.Leaf = leaf
+
+	rootCAs, caExpiry, err := parseCACertificates(caPEM)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	r.certificate = &certificate
+	r.rootCAs = rootCAs
+	r.certExpiry = leaf.NotAfter
+	r.caExpiry = caExpiry
+	r.checksum = checksum
+	r.mu.Unlock()
+	return true, nil
+}
+
+func (r *Reloader) reportExpiry() {
+	r.mu.RLock()
+	certExpiry, caExpiry := r.certExpiry, r.caExpiry
+	r.mu.RUnlock()
+
+	now := r.clock.Now()
+	taggedmetrics.SendValue(clientCertificateExpiryMetric, certExpiry.Sub(now).Seconds(), "s", "certificate", r.name)
+	taggedmetrics.SendValue(caCertificateExpiryMetric, caExpiry.Sub(now).Seconds(), "s", "certificate", r.name)
+}
+
+// parseCACertificates returns a pool of the PEM encoded certificates and the
+// time at which the first of them expires.
+func parseCACertificates(caPEM []byte) (*x509.CertPool, time.Time, error) {
+	pool := x509.NewCertPool()
+	var expiry time.Time
+
+	for rest := caPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		pool.AddCert(cert)
+		if expiry.IsZero() || cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+
+	if expiry.IsZero() {
+		return nil, time.Time{}, ErrNoCACertificates
+	}
+	return pool, expiry, nil
+}
@@ -0,0 +1,280 @@
+package certreload_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/tps/certreload"
+	"github.com/cloudfoundry/dropsonde/emitter/fake"
+	"github.com/cloudfoundry/dropsonde/metric_sender"
+	"github.com/cloudfoundry/dropsonde/metrics"
+	sonde_events "github.com/cloudfoundry/sonde-go/events"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newAuthority(notAfter time.Time) authority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+
+	return authority{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM encoded certificate and key for 127.0.0.1 signed by the
+// authority.
+func (a authority) issue(commonName string, notAfter time.Time) ([]byte, []byte) {
+	return a.issueFor(commonName, "127.0.0.1", notAfter)
+}
+
+// issueFor returns a PEM encoded certificate and key for the IP address
+// signed by the authority.
+func (a authority) issueFor(commonName, ip string, notAfter time.Time) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP(ip)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	Expect(err).NotTo(HaveOccurred())
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+var _ = Describe("Reloader", func() {
+	var (
+		dir                       string
+		certFile, keyFile, caFile string
+		fakeClock                 *fakeclock.FakeClock
+		fakeEmitter               *fake.FakeEventEmitter
+		logger                    *lagertest.TestLogger
+		ca                        authority
+		expiry                    time.Time
+		reloader                  *certreload.Reloader
+		process                   ifrit.Process
+	)
+
+	write := func(path string, contents []byte) {
+		Expect(os.WriteFile(path, contents, 0600)).To(Succeed())
+	}
+
+	writeClientCert := func(ca authority, commonName string) {
+		cert, key := ca.issue(commonName, expiry)
+		write(certFile, cert)
+		write(keyFile, key)
+		write(caFile, ca.pem)
+	}
+
+	expiryValues := func(name string) []float64 {
+		var values []float64
+		for _, envelope := range fakeEmitter.GetEnvelopes() {
+			if envelope.GetEventType() == sonde_events.Envelope_ValueMetric && envelope.ValueMetric.GetName() == name {
+				Expect(envelope.GetTags()).To(HaveKeyWithValue("certificate", "cc"))
+				values = append(values, envelope.ValueMetric.GetValue())
+			}
+		}
+		return values
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		certFile = filepath.Join(dir, "client.crt")
+		keyFile = filepath.Join(dir, "client.key")
+		caFile = filepath.Join(dir, "ca.crt")
+
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		fakeEmitter = fake.NewFakeEventEmitter("tps-watcher")
+		metrics.Initialize(metric_sender.NewMetricSender(fakeEmitter), nil)
+		logger = lagertest.NewTestLogger("test")
+
+		expiry = fakeClock.Now().Add(48 * time.Hour)
+		ca = newAuthority(fakeClock.Now().Add(72 * time.Hour))
+		writeClientCert(ca, "first")
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		reloader, err = certreload.New(logger, fakeClock, time.Minute, "cc", certFile, keyFile, caFile)
+		Expect(err).NotTo(HaveOccurred())
+		process = ifrit.Invoke(reloader)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+	})
+
+	clientCertificate := func() string {
+		cert, err := reloader.ClientTLSConfig(&tls.Config{}, "").GetClientCertificate(&tls.CertificateRequestInfo{})
+		Expect(err).NotTo(HaveOccurred())
+		return cert.Leaf.Subject.CommonName
+	}
+
+	It("presents the loaded client certificate", func() {
+		Expect(clientCertificate()).To(Equal("first"))
+	})
+
+	It("reports how long the certificates remain valid", func() {
+		Eventually(func() []float64 { return expiryValues("ClientCertificateExpiresIn") }).Should(HaveLen(1))
+		Expect(expiryValues("ClientCertificateExpiresIn")[0]).To(BeNumerically("~", (48 * time.Hour).Seconds(), 1))
+		Expect(expiryValues("CACertificateExpiresIn")[0]).To(BeNumerically("~", (72 * time.Hour).Seconds(), 1))
+
+		fakeClock.WaitForWatcherAndIncrement(time.Minute)
+		Eventually(func() []float64 { return expiryValues("ClientCertificateExpiresIn") }).Should(HaveLen(2))
+		Expect(expiryValues("ClientCertificateExpiresIn")[1]).To(BeNumerically("~", (48*time.Hour - time.Minute).Seconds(), 1))
+	})
+
+	Context("when the files change", func() {
+		var reloads int32
+
+		JustBeforeEach(func() {
+			atomic.StoreInt32(&reloads, 0)
+			reloader.OnReload(func() { atomic.AddInt32(&reloads, 1) })
+		})
+
+		It("reloads the certificates on the next check", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Consistently(func() int32 { return atomic.LoadInt32(&reloads) }).Should(BeZero())
+
+			writeClientCert(ca, "second")
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+
+			Eventually(clientCertificate).Should(Equal("second"))
+			Eventually(func() int32 { return atomic.LoadInt32(&reloads) }).Should(BeEquivalentTo(1))
+			Expect(logger).To(Say("reloaded-certificates"))
+		})
+
+		It("keeps the previous certificates when the new ones are invalid", func() {
+			write(keyFile, []byte("not a key"))
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+
+			Eventually(logger).Should(Say("failed-reloading-certificates"))
+			Expect(clientCertificate()).To(Equal("first"))
+			Expect(atomic.LoadInt32(&reloads)).To(BeZero())
+		})
+	})
+
+	Describe("verifying servers", func() {
+		var (
+			server     *httptest.Server
+			base       *tls.Config
+			serverName string
+		)
+
+		BeforeEach(func() {
+			base = &tls.Config{}
+			serverName = "127.0.0.1"
+		})
+
+		startServerFor := func(ca authority, ip string) {
+			cert, key := ca.issueFor("server", ip, expiry)
+			serverCert, err := tls.X509KeyPair(cert, key)
+			Expect(err).NotTo(HaveOccurred())
+
+			server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+			server.StartTLS()
+		}
+
+		startServer := func(ca authority) {
+			startServerFor(ca, "127.0.0.1")
+		}
+
+		get := func() error {
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: reloader.ClientTLSConfig(base, serverName)}}
+			response, err := client.Get(server.URL)
+			if err == nil {
+				response.Body.Close()
+			}
+			return err
+		}
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("verifies the server against the current CA certificates", func() {
+			startServer(ca)
+			Expect(get()).To(Succeed())
+
+			writeClientCert(newAuthority(expiry), "rotated")
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(clientCertificate).Should(Equal("rotated"))
+
+			Expect(get()).To(MatchError(ContainSubstring("certificate signed by unknown authority")))
+		})
+
+		It("rejects a server whose certificate is for another IP address", func() {
+			startServerFor(ca, "10.0.0.1")
+			Expect(get()).To(MatchError(ContainSubstring("certificate is valid for 10.0.0.1, not 127.0.0.1")))
+		})
+
+		It("verifies the server against the configured server name", func() {
+			startServer(ca)
+			base.ServerName = "cc.service.cf.internal"
+			Expect(get()).To(MatchError(ContainSubstring("wanted to match cc.service.cf.internal")))
+		})
+
+		It("rejects the server when there is no server name to verify", func() {
+			startServer(ca)
+			serverName = ""
+			Expect(get()).To(MatchError(ContainSubstring(certreload.ErrNoServerName.Error())))
+		})
+	})
+
+	It("fails to load missing or invalid CA certificates", func() {
+		_, err := certreload.New(logger, fakeClock, time.Minute, "cc", certFile, keyFile, filepath.Join(dir, "missing"))
+		Expect(err).To(HaveOccurred())
+
+		write(caFile, []byte("no certificates here"))
+		_, err = certreload.New(logger, fakeClock, time.Minute, "cc", certFile, keyFile, caFile)
+		Expect(err).To(MatchError(certreload.ErrNoCACertificates))
+	})
+})
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/bbs"
+	"code.cloudfoundry.org/bbs/events"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// reloadingBBSClient delegates to a BBS client that can be replaced, since a
+// BBS client only reads its certificates when it is created. Event streams
+// that are already open keep using the client they were opened with.
+type reloadingBBSClient struct {
+	mu     sync.RWMutex
+	client bbs.Client
+}
+
+func (c *reloadingBBSClient) set(client bbs.Client) {
+	c.mu.Lock()
+	c.client = client
+	c.mu.Unlock()
+}
+
+func (c *reloadingBBSClient) current() bbs.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+func (c *reloadingBBSClient) SubscribeToInstanceEvents(logger lager.Logger) (events.EventSource, error) {
+	return c.current().SubscribeToInstanceEvents(logger)
+}
+
+func (c *reloadingBBSClient) SubscribeToEvents(logger lager.Logger) (events.EventSource, error) {
+	return c.current().SubscribeToEvents(logger)
+}
+
+func (c *reloadingBBSClient) ActualLRPs(logger lager.Logger, traceID string, filter models.ActualLRPFilter) ([]*models.ActualLRP, error) {
+	return c.current().ActualLRPs(logger, traceID, filter)
+}
+
+func (c *reloadingBBSClient) DesiredLRPSchedulingInfos(logger lager.Logger, traceID string, filter models.DesiredLRPFilter) ([]*models.DesiredLRPSchedulingInfo, error) {
+	return c.current().DesiredLRPSchedulingInfos(logger, traceID, filter)
+}
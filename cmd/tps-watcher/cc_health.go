@@ -0,0 +1,24 @@
+package main
+
+import (
+	"code.cloudfoundry.org/tps/cc_client"
+	"code.cloudfoundry.org/tps/handler"
+)
+
+// ccHealth reports the health of CC as seen by the CC client.
+type ccHealth struct {
+	endpoints *cc_client.EndpointPool
+	breaker   *cc_client.CircuitBreaker
+}
+
+func (h ccHealth) CCHealth() handler.CCHealth {
+	state := "disabled"
+	if h.breaker != nil {
+		state = h.breaker.State()
+	}
+
+	return handler.CCHealth{
+		CircuitBreaker:   state,
+		HealthyEndpoints: h.endpoints.Healthy(),
+	}
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"crypto/tls"
+	"database/sql"
 	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
+	"time"
 
 	"code.cloudfoundry.org/bbs"
 	"code.cloudfoundry.org/clock"
@@ -15,12 +19,19 @@ import (
 	"code.cloudfoundry.org/locket"
 	"code.cloudfoundry.org/locket/lock"
 	locketmodels "code.cloudfoundry.org/locket/models"
+	"code.cloudfoundry.org/tlsconfig"
 	"code.cloudfoundry.org/tps/cc_client"
+	"code.cloudfoundry.org/tps/certreload"
 	"code.cloudfoundry.org/tps/config"
+	"code.cloudfoundry.org/tps/handler"
 	"code.cloudfoundry.org/tps/watcher"
+	"code.cloudfoundry.org/tps/webhook"
 	"github.com/cloudfoundry/dropsonde"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	"github.com/tedsuo/ifrit"
 	"github.com/tedsuo/ifrit/grouper"
+	"github.com/tedsuo/ifrit/http_server"
 	"github.com/tedsuo/ifrit/sigmon"
 )
 
@@ -46,40 +57,107 @@ func main() {
 
 	initializeDropsonde(logger, watcherConfig.DropsondePort)
 
-	locks := []grouper.Member{{"sql-lock", initializeLocketLockMaintainer(logger, watcherConfig)}}
+	locks := []grouper.Member{{Name: "sql-lock", Runner: initializeLocketLockMaintainer(logger, watcherConfig)}}
 
 	if watcherConfig.LocketAddress == "" {
 		logger.Fatal("no-locks-configured", errors.New("Lock configuration must be provided"))
 	}
 
-	tlsConfig, err := cc_client.NewTLSConfig(
+	ccTLSPolicy, err := watcherConfig.CCTLSPolicy()
+	if err != nil {
+		panic(err.Error())
+	}
+
+	tlsConfig, err := cc_client.NewClientTLSConfig(
 		watcherConfig.CCClientCert,
 		watcherConfig.CCClientKey,
 		watcherConfig.CCCACert,
+		ccTLSPolicy,
 	)
 	if err != nil {
 		panic(err.Error())
 	}
-	ccClient := cc_client.NewCcClient(watcherConfig.CCBaseUrl, tlsConfig)
 
-	watcher := ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
-		w, err := watcher.NewWatcher(logger,
-			watcherConfig.MaxEventHandlingWorkers,
-			watcher.DefaultRetryPauseInterval,
-			initializeBBSClient(logger, watcherConfig), ccClient)
+	tlsConfig, bbsClient, certReloaders := initializeCertReloaders(logger, watcherConfig, tlsConfig, initializeBBSClient(logger, watcherConfig))
+	ccClient, ccMembers, ccHealthSource := initializeCCClient(logger, watcherConfig, tlsConfig)
+
+	w, err := watcher.NewWatcher(logger, clock.NewClock(),
+		watcherConfig.MaxEventHandlingWorkers,
+		watcher.DefaultRetryPauseInterval,
+		bbsClient, ccClient,
+		watcher.Config{
+			CrashLoopThreshold: watcherConfig.CrashLoopThreshold,
+			CrashLoopWindow:    time.Duration(watcherConfig.CrashLoopWindow),
+
+			StuckInstanceThreshold: time.Duration(watcherConfig.StuckInstanceThreshold),
+
+			NotifyAppRescheduled:         watcherConfig.NotifyAppRescheduled,
+			NotifyAppInstanceLost:        watcherConfig.NotifyAppInstanceLost,
+			NotifyAppAvailabilityChanged: watcherConfig.NotifyAppAvailabilityChanged,
+
+			CellUnhealthyThreshold: watcherConfig.CellUnhealthyThreshold,
+			CellUnhealthyWindow:    time.Duration(watcherConfig.CellUnhealthyWindow),
+
+			ZoneDegradedThreshold: watcherConfig.ZoneDegradedThreshold,
+			ZoneDegradedWindow:    time.Duration(watcherConfig.ZoneDegradedWindow),
+
+			ScaleDownGracePeriod: time.Duration(watcherConfig.ScaleDownGracePeriod),
+
+			LifecycleEventBufferSize: watcherConfig.LifecycleEventBufferSize,
+		})
+	if err != nil {
+		logger.Fatal("failed-to-initialize-watcher", err)
+	}
+
+	// The certificate reloaders and the CC endpoint prober run ahead of the
+	// locks so that standby watchers report certificate expiry and know the
+	// healthy endpoints when they take over.
+	members := append(append(append(certReloaders, ccMembers...), locks...), grouper.Member{Name: "watcher", Runner: w})
+
+	var webhookRegistry handler.WebhookRegistry
+	if store := initializeWebhookStore(logger, watcherConfig); store != nil {
+		if watcherConfig.ListenAddress == "" || watcherConfig.ServerCert == "" {
+			logger.Fatal("webhook-subscriptions-require-mtls", errors.New("webhook subscriptions require listen_addr and server_cert to be configured"))
+		}
 
+		registry := webhook.NewRegistry(store, clock.NewClock())
+		dispatcher, err := webhook.NewDispatcher(logger, registry, w.LifecycleEvents(),
+			&http.Client{Timeout: webhook.DefaultDeliveryTimeout},
+			webhook.DefaultWorkPoolSize,
+		)
 		if err != nil {
-			return err
+			logger.Fatal("failed-to-initialize-webhook-dispatcher", err)
 		}
 
-		return w.Run(signals, ready)
-	})
+		webhookRegistry = registry
+		members = append(members, grouper.Member{Name: "webhook-dispatcher", Runner: dispatcher})
+	}
 
-	members := append(locks, grouper.Member{"watcher", watcher})
+	if listenAddr := watcherConfig.ListenAddress; listenAddr != "" {
+		if watcherConfig.ServerCert == "" || watcherConfig.ServerKey == "" || watcherConfig.ServerCACert == "" {
+			logger.Fatal("api-server-requires-mtls", errors.New("listen_addr requires server_cert, server_key and server_ca_cert to be configured"))
+		}
+
+		apiHandler, err := handler.New(logger, clock.NewClock(), w, w.LifecycleEvents(), ccHealthSource, webhookRegistry)
+		if err != nil {
+			logger.Fatal("failed-to-initialize-handler", err)
+		}
+
+		serverTLSConfig, err := cc_client.NewTLSConfig(
+			watcherConfig.ServerCert,
+			watcherConfig.ServerKey,
+			watcherConfig.ServerCACert,
+		)
+		if err != nil {
+			logger.Fatal("failed-to-load-server-tls-config", err)
+		}
+		apiServer := http_server.NewTLSServer(listenAddr, apiHandler, serverTLSConfig)
+		members = append(members, grouper.Member{Name: "api-server", Runner: apiServer})
+	}
 
 	if dbgAddr := watcherConfig.DebugServerConfig.DebugAddress; dbgAddr != "" {
 		members = append(grouper.Members{
-			{"debug-server", debugserver.Runner(dbgAddr, reconfigurableSink)},
+			{Name: "debug-server", Runner: debugserver.Runner(dbgAddr, reconfigurableSink)},
 		}, members...)
 	}
 
@@ -131,6 +209,38 @@ func initializeLocketLockMaintainer(logger lager.Logger, watcherConfig config.Wa
 	)
 }
 
+// initializeWebhookStore returns the store of the webhook subscriptions, or
+// nil when webhook subscriptions are disabled. The database is shared by the
+// watchers, so it takes precedence over the local file.
+func initializeWebhookStore(logger lager.Logger, watcherConfig config.WatcherConfig) webhook.Store {
+	if connectionString := watcherConfig.WebhookDatabaseConnectionString; connectionString != "" {
+		db, err := sql.Open(watcherConfig.WebhookDatabaseDriver, connectionString)
+		if err != nil {
+			logger.Fatal("failed-to-open-webhook-subscriptions-database", err)
+		}
+
+		store, err := webhook.NewSQLStore(db, watcherConfig.WebhookDatabaseDriver)
+		if err != nil {
+			logger.Fatal("failed-to-initialize-webhook-subscriptions-store", err)
+		}
+
+		err = store.CreateTable()
+		if err != nil {
+			logger.Fatal("failed-to-create-webhook-subscriptions-table", err)
+		}
+		return store
+	}
+
+	if path := watcherConfig.WebhookSubscriptionsPath; path != "" {
+		// The subscriptions are only kept on this VM, so they do not follow
+		// the lock to another watcher.
+		logger.Info("webhook-subscriptions-not-replicated", lager.Data{"path": path})
+		return webhook.NewFileStore(path)
+	}
+
+	return nil
+}
+
 func initializeBBSClient(logger lager.Logger, watcherConfig config.WatcherConfig) bbs.Client {
 	bbsURL, err := url.Parse(watcherConfig.BBSAddress)
 	if err != nil {
@@ -151,7 +261,15 @@ func initializeBBSClient(logger lager.Logger, watcherConfig config.WatcherConfig
 		return bbsClient
 	}
 
-	bbsClient, err = bbs.NewClient(
+	bbsClient, err = newSecureBBSClient(watcherConfig)
+	if err != nil {
+		logger.Fatal("Failed to configure secure BBS client", err)
+	}
+	return bbsClient
+}
+
+func newSecureBBSClient(watcherConfig config.WatcherConfig) (bbs.InternalClient, error) {
+	return bbs.NewClient(
 		watcherConfig.BBSAddress,
 		watcherConfig.BBSCACert,
 		watcherConfig.BBSClientCert,
@@ -159,8 +277,141 @@ func initializeBBSClient(logger lager.Logger, watcherConfig config.WatcherConfig
 		watcherConfig.BBSClientSessionCacheSize,
 		watcherConfig.BBSMaxIdleConnsPerHost,
 	)
+}
+
+// initializeCertReloaders reloads the CC client certificates in place and
+// replaces the BBS client whenever the BBS client certificates change.
+func initializeCertReloaders(logger lager.Logger, watcherConfig config.WatcherConfig, ccTLSConfig *tls.Config, bbsClient bbs.Client) (*tls.Config, watcher.BBSClient, grouper.Members) {
+	interval := time.Duration(watcherConfig.CertReloadInterval)
+	if interval <= 0 {
+		return ccTLSConfig, bbsClient, nil
+	}
+
+	var members grouper.Members
+
+	// Without a client certificate, as when authenticating with UAA tokens,
+	// there is nothing to reload for CC.
+	if watcherConfig.CCClientCert != "" {
+		ccCerts, err := certreload.New(logger, clock.NewClock(), interval, "cc",
+			watcherConfig.CCClientCert,
+			watcherConfig.CCClientKey,
+			watcherConfig.CCCACert,
+		)
+		if err != nil {
+			logger.Fatal("failed-to-load-cc-certificates", err)
+		}
+		ccTLSConfig = ccCerts.ClientTLSConfig(ccTLSConfig, ccServerName(watcherConfig))
+		members = append(members, grouper.Member{Name: "cc-cert-reloader", Runner: ccCerts})
+	}
+
+	bbsURL, err := url.Parse(watcherConfig.BBSAddress)
+	if err != nil || bbsURL.Scheme != "https" {
+		return ccTLSConfig, bbsClient, members
+	}
+
+	bbsCerts, err := certreload.New(logger, clock.NewClock(), interval, "bbs",
+		watcherConfig.BBSClientCert,
+		watcherConfig.BBSClientKey,
+		watcherConfig.BBSCACert,
+	)
 	if err != nil {
-		logger.Fatal("Failed to configure secure BBS client", err)
+		logger.Fatal("failed-to-load-bbs-certificates", err)
 	}
-	return bbsClient
+
+	reloadingClient := &reloadingBBSClient{client: bbsClient}
+	bbsCerts.OnReload(func() {
+		client, err := newSecureBBSClient(watcherConfig)
+		if err != nil {
+			logger.Error("failed-to-reconfigure-bbs-client", err)
+			return
+		}
+		reloadingClient.set(client)
+	})
+	members = append(members, grouper.Member{Name: "bbs-cert-reloader", Runner: bbsCerts})
+
+	return ccTLSConfig, reloadingClient, members
+}
+
+// ccServerName returns the host of the CC endpoint, which the certificate of
+// CC is verified against when no server name is configured. With several
+// endpoints there is no single host, and each is verified against the host it
+// was dialed with instead.
+func ccServerName(watcherConfig config.WatcherConfig) string {
+	endpoints := watcherConfig.CCEndpoints()
+	if len(endpoints) != 1 {
+		return ""
+	}
+	endpoint, err := url.Parse(endpoints[0])
+	if err != nil {
+		return ""
+	}
+	return endpoint.Hostname()
+}
+
+// initializeCCClient authenticates to CC with the client certificate of the
+// TLS config, or with UAA client credentials tokens in the uaa auth mode. With
+// more than one CC endpoint, their health is probed by the returned member.
+// A circuit breaker stops requests while CC keeps failing, unless its failure
+// threshold is 0. With a batch window, notifications are delivered to CC in
+// batches by another returned member. Notifications delivered within the
+// idempotency TTL are not sent again.
+func initializeCCClient(logger lager.Logger, watcherConfig config.WatcherConfig, tlsConfig *tls.Config) (cc_client.CcClient, grouper.Members, handler.CCHealthSource) {
+	endpoints, err := cc_client.NewEndpointPool(logger, clock.NewClock(), watcherConfig.CCEndpoints(), tlsConfig, cc_client.EndpointPoolConfig{
+		Routing:          watcherConfig.CCRouting,
+		FailureThreshold: watcherConfig.CCEndpointFailureThreshold,
+		ProbeInterval:    time.Duration(watcherConfig.CCEndpointProbeInterval),
+	})
+	if err != nil {
+		logger.Fatal("failed-to-initialize-cc-endpoints", err)
+	}
+
+	var members grouper.Members
+	if len(watcherConfig.CCEndpoints()) > 1 {
+		members = grouper.Members{{Name: "cc-endpoint-prober", Runner: endpoints}}
+	}
+
+	var breaker *cc_client.CircuitBreaker
+	if watcherConfig.CCCircuitBreakerFailureThreshold > 0 {
+		breaker = cc_client.NewCircuitBreaker(clock.NewClock(), cc_client.CircuitBreakerConfig{
+			FailureThreshold: watcherConfig.CCCircuitBreakerFailureThreshold,
+			OpenTimeout:      time.Duration(watcherConfig.CCCircuitBreakerOpenTimeout),
+		})
+	}
+	health := ccHealth{endpoints: endpoints, breaker: breaker}
+
+	var deduplicator *cc_client.Deduplicator
+	if watcherConfig.CCIdempotencyTTL > 0 {
+		deduplicator = cc_client.NewDeduplicator(clock.NewClock(), time.Duration(watcherConfig.CCIdempotencyTTL))
+	}
+
+	var batcher *cc_client.Batcher
+	if watcherConfig.CCBatchWindow > 0 {
+		batcher = cc_client.NewBatcher(logger, clock.NewClock(), cc_client.BatchConfig{
+			Window:  time.Duration(watcherConfig.CCBatchWindow),
+			MaxSize: watcherConfig.CCBatchMaxSize,
+		})
+		members = append(members, grouper.Member{Name: "cc-batcher", Runner: batcher})
+	}
+
+	if watcherConfig.CCAuthMode != config.CCAuthModeUAA {
+		return cc_client.NewCcClientWithEndpoints(endpoints, tlsConfig, watcherConfig.CCIncludeInstanceDetails, nil, breaker, batcher, deduplicator), members, health
+	}
+
+	var uaaOptions []tlsconfig.ClientOption
+	if watcherConfig.CCUAACACert != "" {
+		uaaOptions = append(uaaOptions, tlsconfig.WithAuthorityFromFile(watcherConfig.CCUAACACert))
+	}
+	uaaTLSConfig, err := tlsconfig.Build(tlsconfig.WithExternalServiceDefaults()).Client(uaaOptions...)
+	if err != nil {
+		logger.Fatal("failed-to-load-uaa-tls-config", err)
+	}
+
+	tokens := cc_client.NewUAATokenSource(
+		watcherConfig.CCUAAURL,
+		watcherConfig.CCUAAClientID,
+		watcherConfig.CCUAAClientSecret,
+		uaaTLSConfig,
+		clock.NewClock(),
+	)
+	return cc_client.NewCcClientWithEndpoints(endpoints, tlsConfig, watcherConfig.CCIncludeInstanceDetails, tokens, breaker, batcher, deduplicator), members, health
 }
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"code.cloudfoundry.org/tps/cc_client"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"X25519":    tls.X25519,
+	"CurveP256": tls.CurveP256,
+	"CurveP384": tls.CurveP384,
+	"CurveP521": tls.CurveP521,
+}
+
+// CCTLSPolicy parses the TLS settings of the CC client. Cipher suites are
+// named as in the crypto/tls package and only the secure suites of TLS 1.2 can
+// be configured; TLS 1.3 suites are not configurable.
+func (c WatcherConfig) CCTLSPolicy() (cc_client.TLSPolicy, error) {
+	policy := cc_client.TLSPolicy{
+		Profile:    c.CCTLSProfile,
+		ServerName: c.CCTLSServerName,
+	}
+
+	switch c.CCTLSProfile {
+	case "", cc_client.InternalTLSProfile, cc_client.ExternalTLSProfile:
+	default:
+		return cc_client.TLSPolicy{}, fmt.Errorf("invalid cc_tls_profile %q: must be %q or %q", c.CCTLSProfile, cc_client.InternalTLSProfile, cc_client.ExternalTLSProfile)
+	}
+
+	var err error
+	policy.MinVersion, err = parseTLSVersion("cc_tls_min_version", c.CCTLSMinVersion)
+	if err != nil {
+		return cc_client.TLSPolicy{}, err
+	}
+	policy.MaxVersion, err = parseTLSVersion("cc_tls_max_version", c.CCTLSMaxVersion)
+	if err != nil {
+		return cc_client.TLSPolicy{}, err
+	}
+	if policy.MinVersion != 0 && policy.MaxVersion != 0 && policy.MinVersion > policy.MaxVersion {
+		return cc_client.TLSPolicy{}, fmt.Errorf("cc_tls_min_version %s is above cc_tls_max_version %s", c.CCTLSMinVersion, c.CCTLSMaxVersion)
+	}
+
+	suites := map[string]*tls.CipherSuite{}
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite
+	}
+	for _, name := range c.CCTLSCipherSuites {
+		suite, ok := suites[name]
+		if !ok || !supportsTLS12(suite) {
+			return cc_client.TLSPolicy{}, fmt.Errorf("invalid cc_tls_cipher_suites entry %q: not a secure TLS 1.2 cipher suite", name)
+		}
+		policy.CipherSuites = append(policy.CipherSuites, suite.ID)
+	}
+	if len(policy.CipherSuites) > 0 && policy.MinVersion == tls.VersionTLS13 {
+		return cc_client.TLSPolicy{}, fmt.Errorf("cc_tls_cipher_suites cannot be configured when cc_tls_min_version is 1.3")
+	}
+
+	for _, name := range c.CCTLSCurves {
+		curve, ok := tlsCurves[name]
+		if !ok {
+			return cc_client.TLSPolicy{}, fmt.Errorf("invalid cc_tls_curves entry %q", name)
+		}
+		policy.CurvePreferences = append(policy.CurvePreferences, curve)
+	}
+
+	return policy, nil
+}
+
+func parseTLSVersion(field, version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("invalid %s %q: must be 1.2 or 1.3", field, version)
+	}
+	return v, nil
+}
+
+func supportsTLS12(suite *tls.CipherSuite) bool {
+	for _, v := range suite.SupportedVersions {
+		if v == tls.VersionTLS12 {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"time"
@@ -9,6 +10,15 @@ import (
 	"code.cloudfoundry.org/debugserver"
 	"code.cloudfoundry.org/lager/v3/lagerflags"
 	"code.cloudfoundry.org/locket"
+	"code.cloudfoundry.org/tps/cc_client"
+	"code.cloudfoundry.org/tps/webhook"
+)
+
+// The ways the watcher can authenticate to CC: with a client certificate or
+// with UAA client credentials tokens.
+const (
+	CCAuthModeMTLS = "mtls"
+	CCAuthModeUAA  = "uaa"
 )
 
 type Duration time.Duration
@@ -35,36 +45,93 @@ func (d Duration) MarshalJSON() ([]byte, error) {
 }
 
 type WatcherConfig struct {
-	BBSAddress                string                        `json:"bbs_api_url"`
-	BBSCACert                 string                        `json:"bbs_ca_cert"`
-	BBSClientCert             string                        `json:"bbs_client_cert"`
-	BBSClientKey              string                        `json:"bbs_client_key"`
-	BBSClientSessionCacheSize int                           `json:"bbs_client_cache_size"`
-	BBSMaxIdleConnsPerHost    int                           `json:"bbs_max_idle_conns_per_host"`
-	CCBaseUrl                 string                        `json:"cc_base_url"`
-	DebugServerConfig         debugserver.DebugServerConfig `json:"debug_server_config"`
-	DropsondePort             int                           `json:"dropsonde_port"`
-	LagerConfig               lagerflags.LagerConfig        `json:"lager_config"`
-	LockRetryInterval         Duration                      `json:"lock_retry_interval"`
-	LockTTL                   Duration                      `json:"lock_ttl"`
-	MaxEventHandlingWorkers   int                           `json:"max_event_handling_workers"`
-	CCClientCert              string                        `json:"cc_client_cert"`
-	CCClientKey               string                        `json:"cc_client_key"`
-	CCCACert                  string                        `json:"cc_ca_cert"`
-	InstanceID                string                        `json:"instance_id"`
+	BBSAddress                       string                        `json:"bbs_api_url"`
+	BBSCACert                        string                        `json:"bbs_ca_cert"`
+	BBSClientCert                    string                        `json:"bbs_client_cert"`
+	BBSClientKey                     string                        `json:"bbs_client_key"`
+	BBSClientSessionCacheSize        int                           `json:"bbs_client_cache_size"`
+	BBSMaxIdleConnsPerHost           int                           `json:"bbs_max_idle_conns_per_host"`
+	CCBaseUrl                        string                        `json:"cc_base_url"`
+	CCBaseUrls                       []string                      `json:"cc_base_urls"`
+	CCRouting                        string                        `json:"cc_routing"`
+	CCEndpointFailureThreshold       int                           `json:"cc_endpoint_failure_threshold"`
+	CCEndpointProbeInterval          Duration                      `json:"cc_endpoint_probe_interval"`
+	CCCircuitBreakerFailureThreshold int                           `json:"cc_circuit_breaker_failure_threshold"`
+	CCCircuitBreakerOpenTimeout      Duration                      `json:"cc_circuit_breaker_open_timeout"`
+	CCBatchWindow                    Duration                      `json:"cc_batch_window"`
+	CCBatchMaxSize                   int                           `json:"cc_batch_max_size"`
+	CCIdempotencyTTL                 Duration                      `json:"cc_idempotency_ttl"`
+	DebugServerConfig                debugserver.DebugServerConfig `json:"debug_server_config"`
+	DropsondePort                    int                           `json:"dropsonde_port"`
+	LagerConfig                      lagerflags.LagerConfig        `json:"lager_config"`
+	LockRetryInterval                Duration                      `json:"lock_retry_interval"`
+	LockTTL                          Duration                      `json:"lock_ttl"`
+	MaxEventHandlingWorkers          int                           `json:"max_event_handling_workers"`
+	CCClientCert                     string                        `json:"cc_client_cert"`
+	CCClientKey                      string                        `json:"cc_client_key"`
+	CCCACert                         string                        `json:"cc_ca_cert"`
+	CCIncludeInstanceDetails         bool                          `json:"cc_include_instance_details"`
+	CCTLSProfile                     string                        `json:"cc_tls_profile"`
+	CCTLSMinVersion                  string                        `json:"cc_tls_min_version"`
+	CCTLSMaxVersion                  string                        `json:"cc_tls_max_version"`
+	CCTLSCipherSuites                []string                      `json:"cc_tls_cipher_suites"`
+	CCTLSCurves                      []string                      `json:"cc_tls_curves"`
+	CCTLSServerName                  string                        `json:"cc_tls_server_name"`
+	CCAuthMode                       string                        `json:"cc_auth_mode"`
+	CCUAAURL                         string                        `json:"cc_uaa_url"`
+	CCUAAClientID                    string                        `json:"cc_uaa_client_id"`
+	CCUAAClientSecret                string                        `json:"cc_uaa_client_secret"`
+	CCUAACACert                      string                        `json:"cc_uaa_ca_cert"`
+	CrashLoopThreshold               int                           `json:"crash_loop_threshold"`
+	CrashLoopWindow                  Duration                      `json:"crash_loop_window"`
+	StuckInstanceThreshold           Duration                      `json:"stuck_instance_threshold"`
+	NotifyAppRescheduled             bool                          `json:"notify_app_rescheduled"`
+	NotifyAppInstanceLost            bool                          `json:"notify_app_instance_lost"`
+	NotifyAppAvailabilityChanged     bool                          `json:"notify_app_availability_changed"`
+	CellUnhealthyThreshold           int                           `json:"cell_unhealthy_threshold"`
+	CellUnhealthyWindow              Duration                      `json:"cell_unhealthy_window"`
+	ZoneDegradedThreshold            int                           `json:"zone_degraded_threshold"`
+	ZoneDegradedWindow               Duration                      `json:"zone_degraded_window"`
+	ScaleDownGracePeriod             Duration                      `json:"scale_down_grace_period"`
+	ListenAddress                    string                        `json:"listen_addr"`
+	ServerCert                       string                        `json:"server_cert"`
+	ServerKey                        string                        `json:"server_key"`
+	ServerCACert                     string                        `json:"server_ca_cert"`
+	LifecycleEventBufferSize         int                           `json:"lifecycle_event_buffer_size"`
+	WebhookSubscriptionsPath         string                        `json:"webhook_subscriptions_path"`
+	WebhookDatabaseDriver            string                        `json:"webhook_subscriptions_database_driver"`
+	WebhookDatabaseConnectionString  string                        `json:"webhook_subscriptions_database_connection_string"`
+	CertReloadInterval               Duration                      `json:"cert_reload_interval"`
+	InstanceID                       string                        `json:"instance_id"`
 
 	locket.ClientLocketConfig
 }
 
 func DefaultWatcherConfig() WatcherConfig {
 	return WatcherConfig{
-		BBSClientSessionCacheSize: 0,
-		BBSMaxIdleConnsPerHost:    0,
-		DropsondePort:             3457,
-		LagerConfig:               lagerflags.DefaultLagerConfig(),
-		MaxEventHandlingWorkers:   500,
-		LockRetryInterval:         Duration(locket.RetryInterval),
-		LockTTL:                   Duration(locket.DefaultSessionTTL),
+		BBSClientSessionCacheSize:        0,
+		BBSMaxIdleConnsPerHost:           0,
+		DropsondePort:                    3457,
+		LagerConfig:                      lagerflags.DefaultLagerConfig(),
+		MaxEventHandlingWorkers:          500,
+		CCAuthMode:                       CCAuthModeMTLS,
+		CCRouting:                        cc_client.PriorityRouting,
+		CCEndpointFailureThreshold:       cc_client.DefaultEndpointFailureThreshold,
+		CCEndpointProbeInterval:          Duration(cc_client.DefaultEndpointProbeInterval),
+		CCCircuitBreakerFailureThreshold: cc_client.DefaultCircuitFailureThreshold,
+		CCCircuitBreakerOpenTimeout:      Duration(cc_client.DefaultCircuitOpenTimeout),
+		CCBatchMaxSize:                   cc_client.DefaultBatchMaxSize,
+		CCIdempotencyTTL:                 Duration(cc_client.DefaultIdempotencyTTL),
+		CrashLoopWindow:                  Duration(5 * time.Minute),
+		CellUnhealthyThreshold:           10,
+		CellUnhealthyWindow:              Duration(time.Minute),
+		ZoneDegradedThreshold:            50,
+		ZoneDegradedWindow:               Duration(2 * time.Minute),
+		ScaleDownGracePeriod:             Duration(2 * time.Minute),
+		LifecycleEventBufferSize:         1000,
+		CertReloadInterval:               Duration(time.Minute),
+		LockRetryInterval:                Duration(locket.RetryInterval),
+		LockTTL:                          Duration(locket.DefaultSessionTTL),
 	}
 }
 
@@ -80,5 +147,66 @@ func NewWatcherConfig(configPath string) (WatcherConfig, error) {
 		return WatcherConfig{}, err
 	}
 
+	err = watcherConfig.validate()
+	if err != nil {
+		return WatcherConfig{}, err
+	}
+
 	return watcherConfig, nil
 }
+
+// CCEndpoints returns the base URLs of the CC endpoints, which are given by
+// cc_base_urls or, for a single endpoint, by cc_base_url.
+func (c WatcherConfig) CCEndpoints() []string {
+	if len(c.CCBaseUrls) > 0 {
+		return c.CCBaseUrls
+	}
+	return []string{c.CCBaseUrl}
+}
+
+func (c WatcherConfig) validate() error {
+	_, err := c.CCTLSPolicy()
+	if err != nil {
+		return err
+	}
+
+	switch c.CCRouting {
+	case cc_client.RoundRobinRouting, cc_client.PriorityRouting:
+	default:
+		return fmt.Errorf("invalid cc_routing %q: must be %q or %q", c.CCRouting, cc_client.RoundRobinRouting, cc_client.PriorityRouting)
+	}
+	if c.CCEndpointFailureThreshold <= 0 {
+		return errors.New("cc_endpoint_failure_threshold must be positive")
+	}
+	if c.CCCircuitBreakerFailureThreshold < 0 {
+		return errors.New("cc_circuit_breaker_failure_threshold must not be negative")
+	}
+	if c.CCBatchWindow < 0 {
+		return errors.New("cc_batch_window must not be negative")
+	}
+	if c.CCBatchWindow > 0 && c.CCBatchMaxSize <= 0 {
+		return errors.New("cc_batch_max_size must be positive when batching is enabled")
+	}
+	if c.CCIdempotencyTTL < 0 {
+		return errors.New("cc_idempotency_ttl must not be negative")
+	}
+	if c.WebhookDatabaseConnectionString != "" {
+		switch c.WebhookDatabaseDriver {
+		case webhook.MySQLDriver, webhook.PostgresDriver:
+		default:
+			return fmt.Errorf("invalid webhook_subscriptions_database_driver %q: must be %q or %q", c.WebhookDatabaseDriver, webhook.MySQLDriver, webhook.PostgresDriver)
+		}
+	}
+
+	switch c.CCAuthMode {
+	case CCAuthModeMTLS:
+	case CCAuthModeUAA:
+		if c.CCUAAURL == "" || c.CCUAAClientID == "" {
+			return errors.New("cc_auth_mode uaa requires cc_uaa_url and cc_uaa_client_id")
+		}
+	default:
+		return fmt.Errorf("invalid cc_auth_mode %q: must be %q or %q", c.CCAuthMode, CCAuthModeMTLS, CCAuthModeUAA)
+	}
+
+	return nil
+}
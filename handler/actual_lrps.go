@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+)
+
+type actualLRPsHandler struct {
+	logger lager.Logger
+	clock  clock.Clock
+	source ActualLRPSource
+}
+
+func NewActualLRPsHandler(logger lager.Logger, clock clock.Clock, source ActualLRPSource) http.Handler {
+	return &actualLRPsHandler{
+		logger: logger.Session("actual-lrps-handler"),
+		clock:  clock,
+		source: source,
+	}
+}
+
+func (h *actualLRPsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	processGuid := r.FormValue(":process_guid")
+	logger := h.logger.WithData(lager.Data{"process-guid": processGuid})
+
+	instances := LRPInstances(h.source.ActualLRPs(processGuid), h.clock)
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(instances)
+	if err != nil {
+		logger.Error("failed-to-encode-response", err)
+	}
+}
+
+// LRPInstances converts actual LRPs into the instances reported to CC,
+// resolving the ordinary, evacuating and suspect instances of each index into
+// one.
+func LRPInstances(actualLRPs []*models.ActualLRP, clk clock.Clock) []cc_messages.LRPInstance {
+	groups := models.ResolveActualLRPGroups(actualLRPs)
+
+	instances := make([]cc_messages.LRPInstance, 0, len(groups))
+	for _, group := range groups {
+		actual, _, err := group.Resolve()
+		if err != nil {
+			continue
+		}
+
+		instance := cc_messages.LRPInstance{
+			ProcessGuid:  actual.ProcessGuid,
+			InstanceGuid: actual.InstanceGuid,
+			Index:        uint(actual.Index),
+			State:        stateFor(actual.State, actual.PlacementError),
+			Details:      actual.PlacementError,
+			Host:         actual.Address,
+			NetInfo:      actual.ActualLRPNetInfo,
+			Since:        actual.Since / 1e9,
+		}
+		if actual.State == models.ActualLRPStateCrashed {
+			instance.Details = actual.CrashReason
+		}
+		if len(actual.Ports) > 0 {
+			instance.Port = uint16(actual.Ports[0].HostPort)
+		}
+		if actual.State == models.ActualLRPStateRunning {
+			instance.Uptime = (clk.Now().UnixNano() - actual.Since) / 1e9
+		}
+
+		instances = append(instances, instance)
+	}
+	return instances
+}
+
+func stateFor(state, placementError string) cc_messages.LRPInstanceState {
+	switch state {
+	case models.ActualLRPStateUnclaimed:
+		if placementError == "" {
+			return cc_messages.LRPInstanceStateStarting
+		}
+		return cc_messages.LRPInstanceStateDown
+	case models.ActualLRPStateClaimed:
+		return cc_messages.LRPInstanceStateStarting
+	case models.ActualLRPStateRunning:
+		return cc_messages.LRPInstanceStateRunning
+	case models.ActualLRPStateCrashed:
+		return cc_messages.LRPInstanceStateCrashed
+	default:
+		return cc_messages.LRPInstanceStateUnknown
+	}
+}
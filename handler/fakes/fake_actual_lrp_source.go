@@ -0,0 +1,112 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/tps/handler"
+)
+
+type FakeActualLRPSource struct {
+	ActualLRPsStub        func(string) []*models.ActualLRP
+	actualLRPsMutex       sync.RWMutex
+	actualLRPsArgsForCall []struct {
+		arg1 string
+	}
+	actualLRPsReturns struct {
+		result1 []*models.ActualLRP
+	}
+	actualLRPsReturnsOnCall map[int]struct {
+		result1 []*models.ActualLRP
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeActualLRPSource) ActualLRPs(arg1 string) []*models.ActualLRP {
+	fake.actualLRPsMutex.Lock()
+	ret, specificReturn := fake.actualLRPsReturnsOnCall[len(fake.actualLRPsArgsForCall)]
+	fake.actualLRPsArgsForCall = append(fake.actualLRPsArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.ActualLRPsStub
+	fakeReturns := fake.actualLRPsReturns
+	fake.recordInvocation("ActualLRPs", []interface{}{arg1})
+	fake.actualLRPsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeActualLRPSource) ActualLRPsCallCount() int {
+	fake.actualLRPsMutex.RLock()
+	defer fake.actualLRPsMutex.RUnlock()
+	return len(fake.actualLRPsArgsForCall)
+}
+
+func (fake *FakeActualLRPSource) ActualLRPsCalls(stub func(string) []*models.ActualLRP) {
+	fake.actualLRPsMutex.Lock()
+	defer fake.actualLRPsMutex.Unlock()
+	fake.ActualLRPsStub = stub
+}
+
+func (fake *FakeActualLRPSource) ActualLRPsArgsForCall(i int) string {
+	fake.actualLRPsMutex.RLock()
+	defer fake.actualLRPsMutex.RUnlock()
+	argsForCall := fake.actualLRPsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeActualLRPSource) ActualLRPsReturns(result1 []*models.ActualLRP) {
+	fake.actualLRPsMutex.Lock()
+	defer fake.actualLRPsMutex.Unlock()
+	fake.ActualLRPsStub = nil
+	fake.actualLRPsReturns = struct {
+		result1 []*models.ActualLRP
+	}{result1}
+}
+
+func (fake *FakeActualLRPSource) ActualLRPsReturnsOnCall(i int, result1 []*models.ActualLRP) {
+	fake.actualLRPsMutex.Lock()
+	defer fake.actualLRPsMutex.Unlock()
+	fake.ActualLRPsStub = nil
+	if fake.actualLRPsReturnsOnCall == nil {
+		fake.actualLRPsReturnsOnCall = make(map[int]struct {
+			result1 []*models.ActualLRP
+		})
+	}
+	fake.actualLRPsReturnsOnCall[i] = struct {
+		result1 []*models.ActualLRP
+	}{result1}
+}
+
+func (fake *FakeActualLRPSource) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.actualLRPsMutex.RLock()
+	defer fake.actualLRPsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeActualLRPSource) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ handler.ActualLRPSource = new(FakeActualLRPSource)
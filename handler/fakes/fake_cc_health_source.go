@@ -0,0 +1,102 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/tps/handler"
+)
+
+type FakeCCHealthSource struct {
+	CCHealthStub        func() handler.CCHealth
+	cCHealthMutex       sync.RWMutex
+	cCHealthArgsForCall []struct {
+	}
+	cCHealthReturns struct {
+		result1 handler.CCHealth
+	}
+	cCHealthReturnsOnCall map[int]struct {
+		result1 handler.CCHealth
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeCCHealthSource) CCHealth() handler.CCHealth {
+	fake.cCHealthMutex.Lock()
+	ret, specificReturn := fake.cCHealthReturnsOnCall[len(fake.cCHealthArgsForCall)]
+	fake.cCHealthArgsForCall = append(fake.cCHealthArgsForCall, struct {
+	}{})
+	stub := fake.CCHealthStub
+	fakeReturns := fake.cCHealthReturns
+	fake.recordInvocation("CCHealth", []interface{}{})
+	fake.cCHealthMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCCHealthSource) CCHealthCallCount() int {
+	fake.cCHealthMutex.RLock()
+	defer fake.cCHealthMutex.RUnlock()
+	return len(fake.cCHealthArgsForCall)
+}
+
+func (fake *FakeCCHealthSource) CCHealthCalls(stub func() handler.CCHealth) {
+	fake.cCHealthMutex.Lock()
+	defer fake.cCHealthMutex.Unlock()
+	fake.CCHealthStub = stub
+}
+
+func (fake *FakeCCHealthSource) CCHealthReturns(result1 handler.CCHealth) {
+	fake.cCHealthMutex.Lock()
+	defer fake.cCHealthMutex.Unlock()
+	fake.CCHealthStub = nil
+	fake.cCHealthReturns = struct {
+		result1 handler.CCHealth
+	}{result1}
+}
+
+func (fake *FakeCCHealthSource) CCHealthReturnsOnCall(i int, result1 handler.CCHealth) {
+	fake.cCHealthMutex.Lock()
+	defer fake.cCHealthMutex.Unlock()
+	fake.CCHealthStub = nil
+	if fake.cCHealthReturnsOnCall == nil {
+		fake.cCHealthReturnsOnCall = make(map[int]struct {
+			result1 handler.CCHealth
+		})
+	}
+	fake.cCHealthReturnsOnCall[i] = struct {
+		result1 handler.CCHealth
+	}{result1}
+}
+
+func (fake *FakeCCHealthSource) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.cCHealthMutex.RLock()
+	defer fake.cCHealthMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeCCHealthSource) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ handler.CCHealthSource = new(FakeCCHealthSource)
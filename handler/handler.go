@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/tps/lifecycle"
+	"github.com/tedsuo/rata"
+)
+
+const (
+	ActualLRPsRoute      = "ActualLRPs"
+	LifecycleEventsRoute = "LifecycleEvents"
+	HealthRoute          = "Health"
+
+	CreateWebhookSubscriptionRoute = "CreateWebhookSubscription"
+	ListWebhookSubscriptionsRoute  = "ListWebhookSubscriptions"
+	DeleteWebhookSubscriptionRoute = "DeleteWebhookSubscription"
+)
+
+var Routes = rata.Routes{
+	{Path: "/v1/actual_lrps/:process_guid", Method: "GET", Name: ActualLRPsRoute},
+	{Path: "/v1/events", Method: "GET", Name: LifecycleEventsRoute},
+	{Path: "/v1/health", Method: "GET", Name: HealthRoute},
+}
+
+var WebhookRoutes = rata.Routes{
+	{Path: "/v1/webhook_subscriptions", Method: "POST", Name: CreateWebhookSubscriptionRoute},
+	{Path: "/v1/webhook_subscriptions", Method: "GET", Name: ListWebhookSubscriptionsRoute},
+	{Path: "/v1/webhook_subscriptions/:guid", Method: "DELETE", Name: DeleteWebhookSubscriptionRoute},
+}
+
+//go:generate counterfeiter -o fakes/fake_actual_lrp_source.go . ActualLRPSource
+type ActualLRPSource interface {
+	ActualLRPs(processGuid string) []*models.ActualLRP
+}
+
+// New returns the handler of the watcher API, which serves the app instances
+// known to the watcher without going through CC or BBS and streams the app
+// lifecycle events it reports, along with the health of its view of CC. If a
+// webhook registry is given, it also serves the webhook subscription API. All
+// routes are only served to clients with a verified certificate.
+func New(logger lager.Logger, clock clock.Clock, source ActualLRPSource, broadcaster *lifecycle.Broadcaster, ccHealth CCHealthSource, registry WebhookRegistry) (http.Handler, error) {
+	routes := Routes
+	handlers := rata.Handlers{
+		ActualLRPsRoute:      NewActualLRPsHandler(logger, clock, source),
+		LifecycleEventsRoute: NewLifecycleEventsHandler(logger, broadcaster),
+		HealthRoute:          NewHealthHandler(logger, ccHealth),
+	}
+
+	if registry != nil {
+		routes = append(append(rata.Routes{}, Routes...), WebhookRoutes...)
+		handlers[CreateWebhookSubscriptionRoute] = NewCreateWebhookSubscriptionHandler(logger, registry)
+		handlers[ListWebhookSubscriptionsRoute] = NewListWebhookSubscriptionsHandler(logger, registry)
+		handlers[DeleteWebhookSubscriptionRoute] = NewDeleteWebhookSubscriptionHandler(logger, registry)
+	}
+
+	router, err := rata.NewRouter(routes, handlers)
+	if err != nil {
+		return nil, err
+	}
+	return requireClientCertificate(logger, router), nil
+}
+
+// requireClientCertificate only lets requests through that were made over TLS
+// with a verified client certificate.
+func requireClientCertificate(logger lager.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			logger.Info("unauthenticated-request", lager.Data{"method": r.Method, "path": r.URL.Path})
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
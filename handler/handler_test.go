@@ -0,0 +1,413 @@
+package handler_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/bbs/models/test/model_helpers"
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	"code.cloudfoundry.org/tps/handler"
+	"code.cloudfoundry.org/tps/handler/fakes"
+	"code.cloudfoundry.org/tps/lifecycle"
+	"code.cloudfoundry.org/tps/webhook"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vito/go-sse/sse"
+)
+
+// authenticated marks the request as made with a verified client certificate.
+func authenticated(request *http.Request) *http.Request {
+	request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	return request
+}
+
+var _ = Describe("Actual LRPs API", func() {
+	var (
+		source    *fakes.FakeActualLRPSource
+		fakeClock *fakeclock.FakeClock
+		server    http.Handler
+		response  *httptest.ResponseRecorder
+		since     time.Time
+	)
+
+	BeforeEach(func() {
+		source = new(fakes.FakeActualLRPSource)
+		fakeClock = fakeclock.NewFakeClock(time.Unix(1000, 0))
+		since = time.Unix(900, 0)
+
+		var err error
+		server, err = handler.New(lagertest.NewTestLogger("test"), fakeClock, source, lifecycle.NewBroadcaster(fakeClock, 10), new(fakes.FakeCCHealthSource), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		response = httptest.NewRecorder()
+	})
+
+	get := func(path string) []cc_messages.LRPInstance {
+		request := httptest.NewRequest("GET", path, nil)
+		server.ServeHTTP(response, authenticated(request))
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		var instances []cc_messages.LRPInstance
+		Expect(json.Unmarshal(response.Body.Bytes(), &instances)).To(Succeed())
+		return instances
+	}
+
+	actualLRP := func(index int32, state string) *models.ActualLRP {
+		lrp := model_helpers.NewValidActualLRP("process-guid", index)
+		lrp.InstanceGuid = "instance-guid"
+		lrp.State = state
+		lrp.Since = since.UnixNano()
+		lrp.Ports = []*models.PortMapping{models.NewPortMapping(61001, 8080)}
+		return lrp
+	}
+
+	It("returns the instances of the process guid", func() {
+		running := actualLRP(0, models.ActualLRPStateRunning)
+		source.ActualLRPsReturns([]*models.ActualLRP{running})
+
+		instances := get("/v1/actual_lrps/process-guid")
+
+		Expect(source.ActualLRPsCallCount()).To(Equal(1))
+		Expect(source.ActualLRPsArgsForCall(0)).To(Equal("process-guid"))
+		Expect(instances).To(Equal([]cc_messages.LRPInstance{{
+			ProcessGuid:  "process-guid",
+			InstanceGuid: "instance-guid",
+			Index:        0,
+			State:        cc_messages.LRPInstanceStateRunning,
+			Host:         running.Address,
+			Port:         61001,
+			NetInfo:      running.ActualLRPNetInfo,
+			Uptime:       100,
+			Since:        900,
+		}}))
+	})
+
+	It("maps the state and details of instances that are not running", func() {
+		unclaimed := actualLRP(0, models.ActualLRPStateUnclaimed)
+		unclaimed.PlacementError = "insufficient resources"
+		claimed := actualLRP(1, models.ActualLRPStateClaimed)
+		crashed := actualLRP(2, models.ActualLRPStateCrashed)
+		crashed.CrashReason = "exited"
+		source.ActualLRPsReturns([]*models.ActualLRP{unclaimed, claimed, crashed})
+
+		instances := get("/v1/actual_lrps/process-guid")
+
+		Expect(instances).To(HaveLen(3))
+		Expect(instances[0].State).To(Equal(cc_messages.LRPInstanceStateDown))
+		Expect(instances[0].Details).To(Equal("insufficient resources"))
+		Expect(instances[1].State).To(Equal(cc_messages.LRPInstanceStateStarting))
+		Expect(instances[2].State).To(Equal(cc_messages.LRPInstanceStateCrashed))
+		Expect(instances[2].Details).To(Equal("exited"))
+		for _, instance := range instances {
+			Expect(instance.Uptime).To(BeZero())
+		}
+	})
+
+	It("resolves an evacuating instance and its replacement into one", func() {
+		evacuating := actualLRP(0, models.ActualLRPStateRunning)
+		evacuating.Presence = models.ActualLRP_Evacuating
+		replacement := actualLRP(0, models.ActualLRPStateClaimed)
+		replacement.InstanceGuid = "new-instance-guid"
+		source.ActualLRPsReturns([]*models.ActualLRP{replacement, evacuating})
+
+		instances := get("/v1/actual_lrps/process-guid")
+
+		Expect(instances).To(HaveLen(1))
+		Expect(instances[0].InstanceGuid).To(Equal("instance-guid"))
+		Expect(instances[0].State).To(Equal(cc_messages.LRPInstanceStateRunning))
+	})
+
+	It("returns an empty list for an unknown process guid", func() {
+		instances := get("/v1/actual_lrps/unknown-guid")
+		Expect(instances).NotTo(BeNil())
+		Expect(instances).To(BeEmpty())
+	})
+
+	It("only serves GET requests", func() {
+		request := httptest.NewRequest("POST", "/v1/actual_lrps/process-guid", nil)
+		server.ServeHTTP(response, authenticated(request))
+		Expect(response.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("rejects requests without a verified client certificate", func() {
+		server.ServeHTTP(response, httptest.NewRequest("GET", "/v1/actual_lrps/process-guid", nil))
+		Expect(response.Code).To(Equal(http.StatusUnauthorized))
+		Expect(source.ActualLRPsCallCount()).To(BeZero())
+	})
+})
+
+var _ = Describe("Lifecycle events API", func() {
+	var (
+		broadcaster *lifecycle.Broadcaster
+		server      *httptest.Server
+	)
+
+	BeforeEach(func() {
+		fakeClock := fakeclock.NewFakeClock(time.Unix(1000, 0))
+		broadcaster = lifecycle.NewBroadcaster(fakeClock, 10)
+
+		apiHandler, err := handler.New(lagertest.NewTestLogger("test"), fakeClock, new(fakes.FakeActualLRPSource), broadcaster, new(fakes.FakeCCHealthSource), nil)
+		Expect(err).NotTo(HaveOccurred())
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiHandler.ServeHTTP(w, authenticated(r))
+		}))
+	})
+
+	AfterEach(func() {
+		server.CloseClientConnections()
+		server.Close()
+	})
+
+	stream := func(query, lastEventID string) (*http.Response, *sse.ReadCloser) {
+		request, err := http.NewRequest("GET", server.URL+"/v1/events"+query, nil)
+		Expect(err).NotTo(HaveOccurred())
+		if lastEventID != "" {
+			request.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		response, err := http.DefaultClient.Do(request)
+		Expect(err).NotTo(HaveOccurred())
+		return response, sse.NewReadCloser(response.Body)
+	}
+
+	publish := func(processGuid string) {
+		Expect(broadcaster.Publish(lifecycle.AppCrashed, processGuid, map[string]string{"guid": processGuid})).To(Succeed())
+	}
+
+	It("streams published events", func() {
+		response, events := stream("", "")
+		defer events.Close()
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		Expect(response.Header.Get("Content-Type")).To(HavePrefix("text/event-stream"))
+
+		publish("process-guid")
+
+		event, err := events.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.ID).To(Equal(broadcaster.Epoch() + "-1"))
+		Expect(event.Name).To(Equal(lifecycle.AppCrashed))
+
+		var decoded lifecycle.Event
+		Expect(json.Unmarshal(event.Data, &decoded)).To(Succeed())
+		Expect(decoded.ProcessGuid).To(Equal("process-guid"))
+		Expect(decoded.Timestamp).To(Equal(time.Unix(1000, 0).UnixNano()))
+		Expect(decoded.Data).To(MatchJSON(`{"guid":"process-guid"}`))
+	})
+
+	It("filters events by process guid", func() {
+		_, events := stream("?process_guid=guid-b&process_guid=guid-c", "")
+		defer events.Close()
+
+		publish("guid-a")
+		publish("guid-b")
+
+		event, err := events.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.ID).To(Equal(broadcaster.Epoch() + "-2"))
+	})
+
+	It("resumes after the last event id", func() {
+		for i := 0; i < 3; i++ {
+			publish(fmt.Sprintf("guid-%d", i))
+		}
+
+		_, events := stream("", broadcaster.Epoch()+"-1")
+		defer events.Close()
+
+		event, err := events.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.ID).To(Equal(broadcaster.Epoch() + "-2"))
+		event, err = events.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.ID).To(Equal(broadcaster.Epoch() + "-3"))
+	})
+
+	It("replays every buffered event after an event id of an earlier run", func() {
+		for i := 0; i < 2; i++ {
+			publish(fmt.Sprintf("guid-%d", i))
+		}
+
+		_, events := stream("", "earlier-epoch-5")
+		defer events.Close()
+
+		event, err := events.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.ID).To(Equal(broadcaster.Epoch() + "-1"))
+		event, err = events.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.ID).To(Equal(broadcaster.Epoch() + "-2"))
+	})
+
+	It("rejects an invalid last event id", func() {
+		response, events := stream("", "not-a-number")
+		defer events.Close()
+		Expect(response.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+})
+
+var _ = Describe("Webhook subscriptions API", func() {
+	var (
+		registry *fakes.FakeWebhookRegistry
+		server   http.Handler
+		response *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		registry = new(fakes.FakeWebhookRegistry)
+		fakeClock := fakeclock.NewFakeClock(time.Unix(1000, 0))
+
+		var err error
+		server, err = handler.New(lagertest.NewTestLogger("test"), fakeClock, new(fakes.FakeActualLRPSource), lifecycle.NewBroadcaster(fakeClock, 10), new(fakes.FakeCCHealthSource), registry)
+		Expect(err).NotTo(HaveOccurred())
+
+		response = httptest.NewRecorder()
+	})
+
+	It("creates subscriptions", func() {
+		created := webhook.Subscription{Guid: "subscription-guid", URL: "https://example.com/hook", EventTypes: []string{lifecycle.AppCrashed}}
+		registry.CreateReturns(created, nil)
+
+		body := `{"url":"https://example.com/hook","event_types":["app_crashed"],"process_guids":["process-guid"]}`
+		server.ServeHTTP(response, authenticated(httptest.NewRequest("POST", "/v1/webhook_subscriptions", strings.NewReader(body))))
+
+		Expect(response.Code).To(Equal(http.StatusCreated))
+		Expect(registry.CreateCallCount()).To(Equal(1))
+		Expect(registry.CreateArgsForCall(0)).To(Equal(webhook.Subscription{
+			URL:          "https://example.com/hook",
+			EventTypes:   []string{lifecycle.AppCrashed},
+			ProcessGuids: []string{"process-guid"},
+		}))
+
+		var subscription webhook.Subscription
+		Expect(json.Unmarshal(response.Body.Bytes(), &subscription)).To(Succeed())
+		Expect(subscription).To(Equal(created))
+	})
+
+	It("rejects invalid subscriptions", func() {
+		registry.CreateReturns(webhook.Subscription{}, webhook.ErrInvalidURL)
+		server.ServeHTTP(response, authenticated(httptest.NewRequest("POST", "/v1/webhook_subscriptions", strings.NewReader(`{"url":"nope"}`))))
+
+		Expect(response.Code).To(Equal(http.StatusBadRequest))
+		Expect(response.Body.String()).To(MatchJSON(`{"error":"target url must be an absolute http or https url"}`))
+	})
+
+	It("rejects malformed requests", func() {
+		server.ServeHTTP(response, authenticated(httptest.NewRequest("POST", "/v1/webhook_subscriptions", strings.NewReader(`{`))))
+		Expect(response.Code).To(Equal(http.StatusBadRequest))
+		Expect(registry.CreateCallCount()).To(BeZero())
+	})
+
+	It("fails when the subscription cannot be persisted", func() {
+		registry.CreateReturns(webhook.Subscription{}, errors.New("disk full"))
+		server.ServeHTTP(response, authenticated(httptest.NewRequest("POST", "/v1/webhook_subscriptions", strings.NewReader(`{"url":"https://example.com"}`))))
+		Expect(response.Code).To(Equal(http.StatusInternalServerError))
+	})
+
+	It("lists subscriptions", func() {
+		registry.ListReturns([]webhook.Subscription{{Guid: "a", URL: "https://example.com"}})
+		server.ServeHTTP(response, authenticated(httptest.NewRequest("GET", "/v1/webhook_subscriptions", nil)))
+
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Body.String()).To(MatchJSON(`[{"guid":"a","url":"https://example.com","created_at":0}]`))
+	})
+
+	It("lists no subscriptions as an empty list", func() {
+		server.ServeHTTP(response, authenticated(httptest.NewRequest("GET", "/v1/webhook_subscriptions", nil)))
+		Expect(response.Body.String()).To(MatchJSON(`[]`))
+	})
+
+	It("deletes subscriptions", func() {
+		server.ServeHTTP(response, authenticated(httptest.NewRequest("DELETE", "/v1/webhook_subscriptions/subscription-guid", nil)))
+
+		Expect(response.Code).To(Equal(http.StatusNoContent))
+		Expect(registry.DeleteCallCount()).To(Equal(1))
+		Expect(registry.DeleteArgsForCall(0)).To(Equal("subscription-guid"))
+	})
+
+	It("responds with not found when deleting an unknown subscription", func() {
+		registry.DeleteReturns(webhook.ErrSubscriptionNotFound)
+		server.ServeHTTP(response, authenticated(httptest.NewRequest("DELETE", "/v1/webhook_subscriptions/unknown", nil)))
+		Expect(response.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("rejects requests without a verified client certificate", func() {
+		server.ServeHTTP(response, httptest.NewRequest("GET", "/v1/webhook_subscriptions", nil))
+		Expect(response.Code).To(Equal(http.StatusUnauthorized))
+		Expect(registry.ListCallCount()).To(BeZero())
+	})
+
+	Context("when no registry is configured", func() {
+		BeforeEach(func() {
+			fakeClock := fakeclock.NewFakeClock(time.Unix(1000, 0))
+
+			var err error
+			server, err = handler.New(lagertest.NewTestLogger("test"), fakeClock, new(fakes.FakeActualLRPSource), lifecycle.NewBroadcaster(fakeClock, 10), new(fakes.FakeCCHealthSource), nil)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("does not serve the webhook subscription API", func() {
+			server.ServeHTTP(response, authenticated(httptest.NewRequest("GET", "/v1/webhook_subscriptions", nil)))
+			Expect(response.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+})
+
+var _ = Describe("Health API", func() {
+	var (
+		ccHealth *fakes.FakeCCHealthSource
+		server   http.Handler
+		response *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		fakeClock := fakeclock.NewFakeClock(time.Unix(1000, 0))
+		ccHealth = new(fakes.FakeCCHealthSource)
+
+		var err error
+		server, err = handler.New(lagertest.NewTestLogger("test"), fakeClock, new(fakes.FakeActualLRPSource), lifecycle.NewBroadcaster(fakeClock, 10), ccHealth, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		response = httptest.NewRecorder()
+	})
+
+	It("reports the circuit breaker state and the healthy CC endpoints", func() {
+		ccHealth.CCHealthReturns(handler.CCHealth{
+			CircuitBreaker:   "half-open",
+			HealthyEndpoints: []string{"https://cc-1.service.cf.internal:9023"},
+		})
+
+		server.ServeHTTP(response, authenticated(httptest.NewRequest("GET", "/v1/health", nil)))
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(response.Body.String()).To(MatchJSON(`{
+			"cc": {
+				"circuit_breaker": "half-open",
+				"healthy_endpoints": ["https://cc-1.service.cf.internal:9023"]
+			}
+		}`))
+	})
+
+	It("reports an empty list when no CC endpoint is healthy", func() {
+		ccHealth.CCHealthReturns(handler.CCHealth{CircuitBreaker: "open"})
+
+		server.ServeHTTP(response, authenticated(httptest.NewRequest("GET", "/v1/health", nil)))
+		Expect(response.Body.String()).To(MatchJSON(`{"cc": {"circuit_breaker": "open", "healthy_endpoints": []}}`))
+	})
+
+	It("rejects requests without a verified client certificate", func() {
+		server.ServeHTTP(response, httptest.NewRequest("GET", "/v1/health", nil))
+		Expect(response.Code).To(Equal(http.StatusUnauthorized))
+		Expect(ccHealth.CCHealthCallCount()).To(BeZero())
+	})
+})
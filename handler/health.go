@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+//go:generate counterfeiter -o fakes/fake_cc_health_source.go . CCHealthSource
+type CCHealthSource interface {
+	CCHealth() CCHealth
+}
+
+// CCHealth is how the watcher sees CC: the state of the circuit breaker in
+// front of it and the CC endpoints that are considered healthy.
+type CCHealth struct {
+	CircuitBreaker   string   `json:"circuit_breaker"`
+	HealthyEndpoints []string `json:"healthy_endpoints"`
+}
+
+type HealthResponse struct {
+	CC CCHealth `json:"cc"`
+}
+
+type healthHandler struct {
+	logger lager.Logger
+	source CCHealthSource
+}
+
+func NewHealthHandler(logger lager.Logger, source CCHealthSource) http.Handler {
+	return &healthHandler{
+		logger: logger.Session("health-handler"),
+		source: source,
+	}
+}
+
+func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	health := h.source.CCHealth()
+	if health.HealthyEndpoints == nil {
+		health.HealthyEndpoints = []string{}
+	}
+	writeJSON(h.logger, w, http.StatusOK, HealthResponse{CC: health})
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/tps/lifecycle"
+	"github.com/vito/go-sse/sse"
+)
+
+type lifecycleEventsHandler struct {
+	logger      lager.Logger
+	broadcaster *lifecycle.Broadcaster
+}
+
+func NewLifecycleEventsHandler(logger lager.Logger, broadcaster *lifecycle.Broadcaster) http.Handler {
+	return &lifecycleEventsHandler{
+		logger:      logger.Session("lifecycle-events-handler"),
+		broadcaster: broadcaster,
+	}
+}
+
+// ServeHTTP streams app lifecycle events as server-sent events, optionally
+// filtered by one or more process_guid parameters. A client that reconnects
+// with a Last-Event-ID header first receives the buffered events it missed,
+// or every buffered event if the watcher restarted since.
+func (h *lifecycleEventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := h.logger.Session("stream")
+
+	var lastEventID uint64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		var err error
+		lastEventID, err = h.broadcaster.ResumeAfter(header)
+		if err != nil {
+			logger.Error("invalid-last-event-id", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		logger.Info("streaming-unsupported")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	filter := lifecycle.Filter{ProcessGuids: r.URL.Query()["process_guid"]}
+	subscription, replay := h.broadcaster.Subscribe(lastEventID, filter)
+	defer subscription.Close()
+
+	logger.Info("subscribed", lager.Data{"last-event-id": lastEventID, "process-guids": filter.ProcessGuids})
+	defer logger.Info("unsubscribed")
+
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for _, event := range replay {
+		if err := writeEvent(w, event); err != nil {
+			logger.Error("failed-to-write-event", err)
+			return
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case event, ok := <-subscription.Events():
+			if !ok {
+				logger.Info("subscriber-fell-behind")
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				logger.Error("failed-to-write-event", err)
+				return
+			}
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event lifecycle.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return sse.Event{
+		ID:   event.StreamID(),
+		Name: event.Type,
+		Data: payload,
+	}.Write(w)
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/tps/webhook"
+)
+
+//go:generate counterfeiter -o fakes/fake_webhook_registry.go . WebhookRegistry
+type WebhookRegistry interface {
+	Create(subscription webhook.Subscription) (webhook.Subscription, error)
+	List() []webhook.Subscription
+	Delete(guid string) error
+}
+
+type CreateWebhookSubscriptionRequest struct {
+	URL          string   `json:"url"`
+	EventTypes   []string `json:"event_types,omitempty"`
+	ProcessGuids []string `json:"process_guids,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+type createWebhookSubscriptionHandler struct {
+	logger   lager.Logger
+	registry WebhookRegistry
+}
+
+func NewCreateWebhookSubscriptionHandler(logger lager.Logger, registry WebhookRegistry) http.Handler {
+	return &createWebhookSubscriptionHandler{
+		logger:   logger.Session("create-webhook-subscription-handler"),
+		registry: registry,
+	}
+}
+
+func (h *createWebhookSubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request CreateWebhookSubscriptionRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		h.logger.Error("invalid-request", err)
+		writeJSON(h.logger, w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	subscription, err := h.registry.Create(webhook.Subscription{
+		URL:          request.URL,
+		EventTypes:   request.EventTypes,
+		ProcessGuids: request.ProcessGuids,
+	})
+	switch {
+	case errors.Is(err, webhook.ErrInvalidURL), errors.Is(err, webhook.ErrUnknownEventType):
+		h.logger.Error("invalid-subscription", err)
+		writeJSON(h.logger, w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case err != nil:
+		h.logger.Error("failed-creating-subscription", err)
+		writeJSON(h.logger, w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	default:
+		h.logger.Info("created-subscription", lager.Data{"subscription-guid": subscription.Guid, "url": subscription.URL})
+		writeJSON(h.logger, w, http.StatusCreated, subscription)
+	}
+}
+
+type listWebhookSubscriptionsHandler struct {
+	logger   lager.Logger
+	registry WebhookRegistry
+}
+
+func NewListWebhookSubscriptionsHandler(logger lager.Logger, registry WebhookRegistry) http.Handler {
+	return &listWebhookSubscriptionsHandler{
+		logger:   logger.Session("list-webhook-subscriptions-handler"),
+		registry: registry,
+	}
+}
+
+func (h *listWebhookSubscriptionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	subscriptions := h.registry.List()
+	if subscriptions == nil {
+		subscriptions = []webhook.Subscription{}
+	}
+	writeJSON(h.logger, w, http.StatusOK, subscriptions)
+}
+
+type deleteWebhookSubscriptionHandler struct {
+	logger   lager.Logger
+	registry WebhookRegistry
+}
+
+func NewDeleteWebhookSubscriptionHandler(logger lager.Logger, registry WebhookRegistry) http.Handler {
+	return &deleteWebhookSubscriptionHandler{
+		logger:   logger.Session("delete-webhook-subscription-handler"),
+		registry: registry,
+	}
+}
+
+func (h *deleteWebhookSubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	guid := r.FormValue(":guid")
+	logger := h.logger.WithData(lager.Data{"subscription-guid": guid})
+
+	err := h.registry.Delete(guid)
+	switch {
+	case errors.Is(err, webhook.ErrSubscriptionNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case err != nil:
+		logger.Error("failed-deleting-subscription", err)
+		writeJSON(logger, w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	default:
+		logger.Info("deleted-subscription")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeJSON(logger lager.Logger, w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(body)
+	if err != nil {
+		logger.Error("failed-to-encode-response", err)
+	}
+}
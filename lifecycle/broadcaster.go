@@ -0,0 +1,230 @@
+package lifecycle
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/clock"
+)
+
+// The types of the app lifecycle events published by the watcher. The data of
+// each event is the body of the corresponding notification sent to CC.
+const (
+	AppCrashed               = "app_crashed"
+	AppCrashLooping          = "app_crash_looping"
+	AppRescheduling          = "app_rescheduling"
+	AppRescheduled           = "app_rescheduled"
+	AppReadinessChanged      = "app_readiness_changed"
+	AppAvailabilityChanged   = "app_availability_changed"
+	AppInstanceFailedToStart = "app_instance_failed_to_start"
+	AppInstanceLost          = "app_instance_lost"
+)
+
+// The types of the alerts published by the watcher along with the app
+// lifecycle events. An alert is not about a single app, so its process guid
+// is empty and subscribers that filter by process guid do not receive it.
+const (
+	CellUnhealthy            = "cell_unhealthy"
+	AvailabilityZoneDegraded = "availability_zone_degraded"
+)
+
+// EventTypes lists every type of event published by the watcher.
+var EventTypes = []string{
+	AppCrashed,
+	AppCrashLooping,
+	AppRescheduling,
+	AppRescheduled,
+	AppReadinessChanged,
+	AppAvailabilityChanged,
+	AppInstanceFailedToStart,
+	AppInstanceLost,
+	CellUnhealthy,
+	AvailabilityZoneDegraded,
+}
+
+// subscriberBufferSize is the number of events a subscriber may fall behind
+// before it is disconnected.
+const subscriberBufferSize = 256
+
+// Event is an app lifecycle event. IDs increase by one with every published
+// event, so a subscriber can resume after the last event it received. They
+// start over when the watcher restarts, so they are only meaningful within
+// the epoch of the broadcaster that published the event.
+type Event struct {
+	ID          uint64          `json:"id"`
+	Epoch       string          `json:"epoch"`
+	Type        string          `json:"type"`
+	ProcessGuid string          `json:"process_guid"`
+	Timestamp   int64           `json:"timestamp"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// Filter selects the events a subscriber receives. An empty filter selects
+// every event.
+type Filter struct {
+	ProcessGuids []string
+}
+
+// StreamID returns the ID that identifies the event across restarts of the
+// watcher, which is its ID prefixed with its epoch.
+func (e Event) StreamID() string {
+	return e.Epoch + "-" + strconv.FormatUint(e.ID, 10)
+}
+
+func (f Filter) matches(event Event) bool {
+	if len(f.ProcessGuids) == 0 {
+		return true
+	}
+	for _, guid := range f.ProcessGuids {
+		if guid == event.ProcessGuid {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription receives the events published after it was created that match
+// its filter.
+type Subscription struct {
+	broadcaster *Broadcaster
+	filter      Filter
+	events      chan Event
+}
+
+// Events returns the events of the subscription. The channel is closed when
+// the subscription is closed or when the subscriber falls too far behind; a
+// subscriber that was disconnected can resume from the replay buffer.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.broadcaster.unsubscribe(s)
+}
+
+// Broadcaster fans app lifecycle events out to subscribers and keeps the most
+// recent ones in a bounded replay buffer. It is safe for concurrent use.
+type Broadcaster struct {
+	clock      clock.Clock
+	bufferSize int
+	epoch      string
+
+	mu          sync.Mutex
+	lastID      uint64
+	buffer      []Event
+	subscribers map[*Subscription]struct{}
+}
+
+// NewBroadcaster returns a broadcaster that keeps the last bufferSize events
+// for replay. Its epoch is the time it was created.
+func NewBroadcaster(clock clock.Clock, bufferSize int) *Broadcaster {
+	return &Broadcaster{
+		clock:       clock,
+		bufferSize:  bufferSize,
+		epoch:       strconv.FormatInt(clock.Now().UnixNano(), 36),
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// Epoch returns the epoch of the events published by the broadcaster.
+func (b *Broadcaster) Epoch() string {
+	return b.epoch
+}
+
+// ResumeAfter returns the ID of the last event received by a subscriber that
+// resumes after the event with the given stream ID. A stream ID from another
+// epoch, such as one published before the watcher restarted, resumes from the
+// start of the replay buffer.
+func (b *Broadcaster) ResumeAfter(streamID string) (uint64, error) {
+	epoch, id := "", streamID
+	if i := strings.LastIndex(streamID, "-"); i >= 0 {
+		epoch, id = streamID[:i], streamID[i+1:]
+	}
+
+	lastEventID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if epoch != b.epoch {
+		return 0, nil
+	}
+	return lastEventID, nil
+}
+
+// Publish sends an event with the JSON encoding of data to every matching
+// subscriber.
+func (b *Broadcaster) Publish(eventType, processGuid string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event := Event{
+		ID:          b.lastID,
+		Epoch:       b.epoch,
+		Type:        eventType,
+		ProcessGuid: processGuid,
+		Timestamp:   b.clock.Now().UnixNano(),
+		Data:        payload,
+	}
+
+	if b.bufferSize > 0 {
+		if len(b.buffer) == b.bufferSize {
+			b.buffer = append(b.buffer[:0], b.buffer[1:]...)
+		}
+		b.buffer = append(b.buffer, event)
+	}
+
+	for s := range b.subscribers {
+		if !s.filter.matches(event) {
+			continue
+		}
+		select {
+		case s.events <- event:
+		default:
+			delete(b.subscribers, s)
+			close(s.events)
+		}
+	}
+	return nil
+}
+
+// Subscribe registers a subscriber for the events matching filter. It returns
+// the buffered events after lastEventID, which the subscriber should process
+// before the events of the subscription. Events that have already left the
+// buffer cannot be replayed.
+func (b *Broadcaster) Subscribe(lastEventID uint64, filter Filter) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var replay []Event
+	for _, event := range b.buffer {
+		if event.ID > lastEventID && filter.matches(event) {
+			replay = append(replay, event)
+		}
+	}
+
+	s := &Subscription{
+		broadcaster: b,
+		filter:      filter,
+		events:      make(chan Event, subscriberBufferSize),
+	}
+	b.subscribers[s] = struct{}{}
+	return s, replay
+}
+
+func (b *Broadcaster) unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.events)
+	}
+}
@@ -0,0 +1,139 @@
+package lifecycle_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/tps/lifecycle"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Broadcaster", func() {
+	var (
+		fakeClock   *fakeclock.FakeClock
+		broadcaster *lifecycle.Broadcaster
+	)
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Unix(100, 0))
+		broadcaster = lifecycle.NewBroadcaster(fakeClock, 3)
+	})
+
+	publish := func(processGuid string) {
+		Expect(broadcaster.Publish(lifecycle.AppCrashed, processGuid, map[string]string{"guid": processGuid})).To(Succeed())
+	}
+
+	It("sends published events to subscribers", func() {
+		subscription, replay := broadcaster.Subscribe(0, lifecycle.Filter{})
+		Expect(replay).To(BeEmpty())
+
+		publish("process-guid")
+
+		var event lifecycle.Event
+		Eventually(subscription.Events()).Should(Receive(&event))
+		Expect(event).To(Equal(lifecycle.Event{
+			ID:          1,
+			Epoch:       broadcaster.Epoch(),
+			Type:        lifecycle.AppCrashed,
+			ProcessGuid: "process-guid",
+			Timestamp:   fakeClock.Now().UnixNano(),
+			Data:        json.RawMessage(`{"guid":"process-guid"}`),
+		}))
+	})
+
+	It("only sends the events of the process guids in the filter", func() {
+		subscription, _ := broadcaster.Subscribe(0, lifecycle.Filter{ProcessGuids: []string{"guid-a", "guid-c"}})
+
+		publish("guid-a")
+		publish("guid-b")
+		publish("guid-c")
+
+		var event lifecycle.Event
+		Expect(subscription.Events()).To(Receive(&event))
+		Expect(event.ProcessGuid).To(Equal("guid-a"))
+		Expect(subscription.Events()).To(Receive(&event))
+		Expect(event.ProcessGuid).To(Equal("guid-c"))
+		Expect(subscription.Events()).NotTo(Receive())
+	})
+
+	It("replays the buffered events after the last event id", func() {
+		for _, guid := range []string{"guid-a", "guid-b", "guid-a", "guid-a"} {
+			publish(guid)
+		}
+
+		_, replay := broadcaster.Subscribe(0, lifecycle.Filter{})
+		Expect(replay).To(HaveLen(3))
+		Expect(replay[0].ID).To(BeEquivalentTo(2))
+
+		_, replay = broadcaster.Subscribe(2, lifecycle.Filter{ProcessGuids: []string{"guid-a"}})
+		Expect(replay).To(HaveLen(2))
+		Expect(replay[0].ID).To(BeEquivalentTo(3))
+		Expect(replay[1].ID).To(BeEquivalentTo(4))
+	})
+
+	Describe("ResumeAfter", func() {
+		BeforeEach(func() {
+			publish("process-guid")
+			publish("process-guid")
+		})
+
+		It("resumes after an event of the same epoch", func() {
+			var event lifecycle.Event
+			subscription, _ := broadcaster.Subscribe(0, lifecycle.Filter{})
+			publish("process-guid")
+			Expect(subscription.Events()).To(Receive(&event))
+			Expect(event.StreamID()).To(Equal(broadcaster.Epoch() + "-3"))
+
+			lastEventID, err := broadcaster.ResumeAfter(event.StreamID())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lastEventID).To(BeEquivalentTo(3))
+		})
+
+		It("replays every buffered event after an event of another epoch", func() {
+			fakeClock.Increment(time.Second)
+			restarted := lifecycle.NewBroadcaster(fakeClock, 3)
+			Expect(restarted.Epoch()).NotTo(Equal(broadcaster.Epoch()))
+
+			lastEventID, err := restarted.ResumeAfter(broadcaster.Epoch() + "-2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lastEventID).To(BeZero())
+
+			lastEventID, err = restarted.ResumeAfter("2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lastEventID).To(BeZero())
+		})
+
+		It("rejects an invalid event id", func() {
+			_, err := broadcaster.ResumeAfter(broadcaster.Epoch() + "-nope")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	It("closes the events of a closed subscription", func() {
+		subscription, _ := broadcaster.Subscribe(0, lifecycle.Filter{})
+		subscription.Close()
+		Expect(subscription.Events()).To(BeClosed())
+
+		subscription.Close()
+		publish("process-guid")
+	})
+
+	It("disconnects subscribers that fall behind", func() {
+		subscription, _ := broadcaster.Subscribe(0, lifecycle.Filter{})
+		for i := 0; i < 300; i++ {
+			publish("process-guid")
+		}
+
+		received := 0
+		for range subscription.Events() {
+			received++
+		}
+		Expect(received).To(BeNumerically("<", 300))
+	})
+
+	It("fails to publish data that cannot be encoded", func() {
+		Expect(broadcaster.Publish(lifecycle.AppCrashed, "process-guid", func() {})).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,17 @@
+// Package taggedmetrics sends dropsonde value metrics with tags.
+package taggedmetrics
+
+import "github.com/cloudfoundry/dropsonde/metrics"
+
+// SendValue sends a value metric with the given tag key/value pairs. It does
+// nothing until metrics have been initialized.
+func SendValue(name string, value float64, unit string, tags ...string) {
+	chainer := metrics.Value(name, value, unit)
+	if chainer == nil {
+		return
+	}
+	for i := 0; i+1 < len(tags); i += 2 {
+		chainer = chainer.SetTag(tags[i], tags[i+1])
+	}
+	_ = chainer.Send()
+}
@@ -0,0 +1,13 @@
+package taggedmetrics_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestTaggedmetrics(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Taggedmetrics Suite")
+}
@@ -0,0 +1,36 @@
+package taggedmetrics_test
+
+import (
+	"code.cloudfoundry.org/tps/taggedmetrics"
+	"github.com/cloudfoundry/dropsonde/emitter/fake"
+	"github.com/cloudfoundry/dropsonde/metric_sender"
+	"github.com/cloudfoundry/dropsonde/metrics"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SendValue", func() {
+	var fakeEmitter *fake.FakeEventEmitter
+
+	BeforeEach(func() {
+		fakeEmitter = fake.NewFakeEventEmitter("tps")
+		metrics.Initialize(metric_sender.NewMetricSender(fakeEmitter), nil)
+	})
+
+	It("sends the value with its tags", func() {
+		taggedmetrics.SendValue("SomeMetric", 1.5, "s", "first", "one", "second", "two")
+
+		envelopes := fakeEmitter.GetEnvelopes()
+		Expect(envelopes).To(HaveLen(1))
+		Expect(envelopes[0].GetValueMetric().GetName()).To(Equal("SomeMetric"))
+		Expect(envelopes[0].GetValueMetric().GetValue()).To(Equal(1.5))
+		Expect(envelopes[0].GetValueMetric().GetUnit()).To(Equal("s"))
+		Expect(envelopes[0].GetTags()).To(Equal(map[string]string{"first": "one", "second": "two"}))
+	})
+
+	It("ignores a key without a value", func() {
+		taggedmetrics.SendValue("SomeMetric", 1, "s", "first", "one", "dangling")
+
+		Expect(fakeEmitter.GetEnvelopes()[0].GetTags()).To(Equal(map[string]string{"first": "one"}))
+	})
+})
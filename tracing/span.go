@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/bbs/trace"
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/openzipkin/zipkin-go/idgenerator"
+	"github.com/openzipkin/zipkin-go/model"
+)
+
+// TraceparentHeader carries the trace context of a request in the W3C Trace
+// Context format.
+const TraceparentHeader = "traceparent"
+
+var spanIDs = idgenerator.NewRandom128()
+
+// Span identifies the handling of a single event. TraceID is shared with BBS
+// when the event carries a trace id, so that the event can be followed from
+// BBS to the CC requests it triggered.
+type Span struct {
+	TraceID string
+	SpanID  string
+}
+
+// NewSpan returns a span of the trace with the given id, which may be
+// formatted as a UUID. A new trace is started when the id is empty or
+// invalid.
+func NewSpan(traceID string) Span {
+	id, err := model.TraceIDFromHex(strings.Replace(traceID, "-", "", -1))
+	if traceID == "" || err != nil || id.Empty() {
+		id, _ = model.TraceIDFromHex(trace.GenerateTraceID())
+	}
+
+	return Span{
+		TraceID: fmt.Sprintf("%016x%016x", id.High, id.Low),
+		SpanID:  spanIDs.SpanID(model.TraceID{}).String(),
+	}
+}
+
+// Logger returns a logger that includes the trace id in every log line.
+func (s Span) Logger(logger lager.Logger) lager.Logger {
+	return trace.LoggerWithTraceInfo(logger, s.TraceID)
+}
+
+// Traceparent returns the span as the value of a W3C traceparent header.
+func (s Span) Traceparent() string {
+	return "00-" + s.TraceID + "-" + s.SpanID + "-01"
+}
+
+// SetHeaders propagates the span in the W3C traceparent header and in the
+// request id header of Diego.
+func (s Span) SetHeaders(header http.Header) {
+	header.Set(TraceparentHeader, s.Traceparent())
+	header.Set(trace.RequestIdHeader, s.TraceID)
+}
+
+type spanKey struct{}
+
+// NewContext returns a copy of ctx that carries the span.
+func NewContext(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// FromContext returns the span carried by ctx, if any.
+func FromContext(ctx context.Context) (Span, bool) {
+	span, ok := ctx.Value(spanKey{}).(Span)
+	return span, ok
+}
@@ -0,0 +1,65 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/tps/tracing"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Span", func() {
+	It("continues the trace of the event", func() {
+		span := tracing.NewSpan("4bf92f35-77b3-4da6-a3ce-929d0e0e4736")
+		Expect(span.TraceID).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+		Expect(span.SpanID).To(MatchRegexp("^[0-9a-f]{16}$"))
+	})
+
+	It("starts a new trace when the event has none", func() {
+		span := tracing.NewSpan("")
+		Expect(span.TraceID).To(MatchRegexp("^[0-9a-f]{32}$"))
+		Expect(span.TraceID).NotTo(Equal(tracing.NewSpan("").TraceID))
+	})
+
+	It("starts a new trace when the trace id is invalid", func() {
+		Expect(tracing.NewSpan("not-a-trace-id").TraceID).To(MatchRegexp("^[0-9a-f]{32}$"))
+	})
+
+	It("gives every span of a trace its own id", func() {
+		Expect(tracing.NewSpan("4bf92f3577b34da6a3ce929d0e0e4736").SpanID).NotTo(Equal(tracing.NewSpan("4bf92f3577b34da6a3ce929d0e0e4736").SpanID))
+	})
+
+	It("pads short trace ids to 128 bits", func() {
+		Expect(tracing.NewSpan("a3ce929d0e0e4736").TraceID).To(Equal("0000000000000000a3ce929d0e0e4736"))
+	})
+
+	It("includes the trace in log lines", func() {
+		logger := lagertest.NewTestLogger("test")
+		span := tracing.NewSpan("4bf92f3577b34da6a3ce929d0e0e4736")
+
+		span.Logger(logger).Info("handling-event")
+		Expect(logger).To(gbytes.Say(`"span-id":"[0-9a-f]{16}","trace-id":"4bf92f3577b34da6a3ce929d0e0e4736"`))
+	})
+
+	It("propagates the span in request headers", func() {
+		span := tracing.Span{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+		header := http.Header{}
+		span.SetHeaders(header)
+
+		Expect(header.Get("traceparent")).To(Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"))
+		Expect(header.Get("X-Vcap-Request-Id")).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+	})
+
+	It("is carried by a context", func() {
+		_, ok := tracing.FromContext(context.Background())
+		Expect(ok).To(BeFalse())
+
+		span := tracing.NewSpan("")
+		carried, ok := tracing.FromContext(tracing.NewContext(context.Background(), span))
+		Expect(ok).To(BeTrue())
+		Expect(carried).To(Equal(span))
+	})
+})
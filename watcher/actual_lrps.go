@@ -0,0 +1,133 @@
+package watcher
+
+import (
+	"sort"
+	"sync"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+)
+
+// lrpID identifies an actual LRP of a process guid. An index can have an
+// ordinary instance as well as an evacuating or a suspect one.
+type lrpID struct {
+	index    int32
+	presence models.ActualLRP_Presence
+}
+
+// actualLRPMirror holds the app actual LRPs known from BBS, seeded on every
+// subscription and kept up to date from instance events. It is updated from
+// the Run loop and read concurrently by the API.
+type actualLRPMirror struct {
+	mu   sync.RWMutex
+	lrps map[string]map[lrpID]*models.ActualLRP
+}
+
+func newActualLRPMirror() *actualLRPMirror {
+	return &actualLRPMirror{lrps: map[string]map[lrpID]*models.ActualLRP{}}
+}
+
+// get returns copies of the actual LRPs of the process guid ordered by index.
+func (m *actualLRPMirror) get(processGuid string) []*models.ActualLRP {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	lrps := make([]*models.ActualLRP, 0, len(m.lrps[processGuid]))
+	for _, lrp := range m.lrps[processGuid] {
+		lrp := *lrp
+		lrps = append(lrps, &lrp)
+	}
+	sort.Slice(lrps, func(i, j int) bool {
+		if lrps[i].Index != lrps[j].Index {
+			return lrps[i].Index < lrps[j].Index
+		}
+		return lrps[i].Presence < lrps[j].Presence
+	})
+	return lrps
+}
+
+func (m *actualLRPMirror) seed(lrps []*models.ActualLRP) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lrps = map[string]map[lrpID]*models.ActualLRP{}
+	for _, lrp := range lrps {
+		if lrp.Domain == cc_messages.AppLRPDomain {
+			m.put(lrp)
+		}
+	}
+}
+
+func (m *actualLRPMirror) handleEvent(event models.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch event := event.(type) {
+	case *models.ActualLRPInstanceCreatedEvent:
+		if event.ActualLrp.Domain == cc_messages.AppLRPDomain {
+			m.put(event.ActualLrp)
+		}
+
+	case *models.ActualLRPInstanceChangedEvent:
+		before, after := event.Before, event.After
+		if event.Domain != cc_messages.AppLRPDomain || before == nil || after == nil {
+			return
+		}
+
+		previous := m.lrps[event.ProcessGuid][lrpID{event.Index, before.Presence}]
+		m.remove(event.ActualLRPKey, before.Presence)
+		m.put(actualLRPFromInfo(event.ActualLRPKey, event.ActualLRPInstanceKey, after, previous))
+
+	case *models.ActualLRPInstanceRemovedEvent:
+		if event.ActualLrp.Domain == cc_messages.AppLRPDomain {
+			m.remove(event.ActualLrp.ActualLRPKey, event.ActualLrp.Presence)
+		}
+	}
+}
+
+func (m *actualLRPMirror) put(lrp *models.ActualLRP) {
+	lrps, ok := m.lrps[lrp.ProcessGuid]
+	if !ok {
+		lrps = map[lrpID]*models.ActualLRP{}
+		m.lrps[lrp.ProcessGuid] = lrps
+	}
+	lrps[lrpID{lrp.Index, lrp.Presence}] = lrp
+}
+
+func (m *actualLRPMirror) remove(key models.ActualLRPKey, presence models.ActualLRP_Presence) {
+	lrps := m.lrps[key.ProcessGuid]
+	delete(lrps, lrpID{key.Index, presence})
+	if len(lrps) == 0 {
+		delete(m.lrps, key.ProcessGuid)
+	}
+}
+
+// actualLRPFromInfo builds the actual LRP described by a change event. Change
+// events do not carry metric tags or internal routes, so they are kept from the
+// previous actual LRP, if any.
+func actualLRPFromInfo(key models.ActualLRPKey, instanceKey models.ActualLRPInstanceKey, info *models.ActualLRPInfo, previous *models.ActualLRP) *models.ActualLRP {
+	lrp := &models.ActualLRP{
+		ActualLRPKey:         key,
+		ActualLRPInstanceKey: instanceKey,
+		ActualLRPNetInfo:     info.ActualLRPNetInfo,
+		CrashCount:           info.CrashCount,
+		CrashReason:          info.CrashReason,
+		State:                info.State,
+		PlacementError:       info.PlacementError,
+		Since:                info.Since,
+		ModificationTag:      info.ModificationTag,
+		Presence:             info.Presence,
+		AvailabilityZone:     info.AvailabilityZone,
+	}
+	if previous != nil {
+		lrp.MetricTags = previous.MetricTags
+		lrp.ActualLrpInternalRoutes = previous.ActualLrpInternalRoutes
+	}
+	if info.State == models.ActualLRPStateUnclaimed {
+		lrp.ActualLRPInstanceKey = models.ActualLRPInstanceKey{}
+	}
+	if info.RoutableExists() {
+		lrp.SetRoutable(info.GetRoutable())
+	}
+	return lrp
+}
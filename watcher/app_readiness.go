@@ -0,0 +1,109 @@
+package watcher
+
+import (
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/tps/cc_client"
+)
+
+// appReadiness holds the ready instances of an app, by index and instance
+// guid, and the last availability state derived from them.
+type appReadiness struct {
+	ready map[int32]map[string]bool
+	state string
+}
+
+// readyInstances returns the number of desired indexes that have at least one
+// ready instance.
+func (a *appReadiness) readyInstances(desired int32) int {
+	count := 0
+	for index, instances := range a.ready {
+		if index < desired && len(instances) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// appReadinessTracker tallies the ready instances of every app so that changes
+// to the availability of the app as a whole can be reported. It is only
+// accessed from the Run loop.
+type appReadinessTracker struct {
+	apps map[string]*appReadiness
+}
+
+func newAppReadinessTracker() *appReadinessTracker {
+	return &appReadinessTracker{apps: map[string]*appReadiness{}}
+}
+
+// seed replaces the tallies with the given actual LRPs.
+func (t *appReadinessTracker) seed(lrps []*models.ActualLRP) {
+	t.apps = map[string]*appReadiness{}
+	for _, lrp := range lrps {
+		t.set(lrp.ActualLRPKey, lrp.InstanceGuid, instanceReady(lrp.ToActualLRPInfo()))
+	}
+}
+
+func (t *appReadinessTracker) app(processGuid string) *appReadiness {
+	app, ok := t.apps[processGuid]
+	if !ok {
+		app = &appReadiness{ready: map[int32]map[string]bool{}}
+		t.apps[processGuid] = app
+	}
+	return app
+}
+
+// set records whether an instance is ready.
+func (t *appReadinessTracker) set(key models.ActualLRPKey, instanceGuid string, ready bool) {
+	if ready {
+		app := t.app(key.ProcessGuid)
+		if app.ready[key.Index] == nil {
+			app.ready[key.Index] = map[string]bool{}
+		}
+		app.ready[key.Index][instanceGuid] = true
+		return
+	}
+
+	app, ok := t.apps[key.ProcessGuid]
+	if !ok {
+		return
+	}
+	delete(app.ready[key.Index], instanceGuid)
+	if len(app.ready[key.Index]) == 0 {
+		delete(app.ready, key.Index)
+	}
+	if len(app.ready) == 0 {
+		delete(t.apps, key.ProcessGuid)
+	}
+}
+
+// update records whether an instance is ready and returns the previous and
+// current availability of its app, given its desired instance count. The
+// previous state of an app that has not been evaluated yet is derived from the
+// tallies before the update.
+func (t *appReadinessTracker) update(key models.ActualLRPKey, instanceGuid string, ready bool, desired int32) (previous, current string, readyInstances int) {
+	app := t.app(key.ProcessGuid)
+	previous = app.state
+	if previous == "" {
+		previous = availability(app.readyInstances(desired), desired)
+	}
+
+	t.set(key, instanceGuid, ready)
+
+	readyInstances = app.readyInstances(desired)
+	current = availability(readyInstances, desired)
+	if _, ok := t.apps[key.ProcessGuid]; ok {
+		app.state = current
+	}
+	return previous, current, readyInstances
+}
+
+func availability(readyInstances int, desired int32) string {
+	switch {
+	case readyInstances >= int(desired):
+		return cc_client.AppAvailabilityReady
+	case readyInstances == 0:
+		return cc_client.AppAvailabilityUnavailable
+	default:
+		return cc_client.AppAvailabilityDegraded
+	}
+}
@@ -0,0 +1,88 @@
+package watcher
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/tps/cc_client"
+)
+
+const (
+	CrashLoopReasonThresholdExceeded = "CRASH_THRESHOLD_EXCEEDED"
+	CrashLoopReasonBackoff           = "CRASH_BACKOFF"
+)
+
+// crashLoopDetector keeps the recent crash history of every app instance index
+// and decides when an index has started crash looping. It is only accessed
+// from the Run loop.
+type crashLoopDetector struct {
+	threshold int
+	window    time.Duration
+
+	crashes  map[models.ActualLRPKey][]cc_client.CrashRecord
+	reported map[models.ActualLRPKey]bool
+}
+
+func newCrashLoopDetector(threshold int, window time.Duration) *crashLoopDetector {
+	return &crashLoopDetector{
+		threshold: threshold,
+		window:    window,
+		crashes:   map[models.ActualLRPKey][]cc_client.CrashRecord{},
+		reported:  map[models.ActualLRPKey]bool{},
+	}
+}
+
+func (d *crashLoopDetector) enabled() bool {
+	return d.threshold > 0
+}
+
+// recordCrash adds a crash to the history of the instance index. It returns
+// the reason and the crash timeline the first time the index is found to be
+// crash looping; further crashes of the same episode are not reported again.
+func (d *crashLoopDetector) recordCrash(key models.ActualLRPKey, crash cc_client.CrashRecord) (string, []cc_client.CrashRecord, bool) {
+	history := d.crashes[key]
+
+	// Diego resets the crash count once an instance has been running stably,
+	// so a count that did not increase starts a new episode.
+	if n := len(history); n > 0 && crash.CrashCount <= history[n-1].CrashCount {
+		history = nil
+	}
+
+	cutoff := crash.CrashTimestamp - int64(d.window)
+	for len(history) > 0 && history[0].CrashTimestamp < cutoff {
+		history = history[1:]
+	}
+
+	if len(history) == 0 && crash.CrashCount <= models.DefaultImmediateRestarts {
+		delete(d.reported, key)
+	}
+
+	history = append(history, crash)
+	d.crashes[key] = history
+
+	if d.reported[key] {
+		return "", nil, false
+	}
+
+	var reason string
+	switch {
+	case len(history) >= d.threshold:
+		reason = CrashLoopReasonThresholdExceeded
+	case crash.CrashCount > models.DefaultImmediateRestarts:
+		reason = CrashLoopReasonBackoff
+	default:
+		return "", nil, false
+	}
+
+	d.reported[key] = true
+
+	timeline := make([]cc_client.CrashRecord, len(history))
+	copy(timeline, history)
+	return reason, timeline, true
+}
+
+// forget drops the history of an instance index that no longer exists.
+func (d *crashLoopDetector) forget(key models.ActualLRPKey) {
+	delete(d.crashes, key)
+	delete(d.reported, key)
+}
@@ -0,0 +1,282 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/bbs/events"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+)
+
+// desiredLRPCache holds the scheduling info of every desired app LRP. It is
+// seeded from BBS on every subscription and kept up to date from desired LRP
+// events, so event handlers can look up an app's instance count, memory limit
+// and annotation without a round trip to BBS. It also tracks the current
+// version of every app, which is the one most recently desired by CC, and the
+// instances that are being stopped because their app was scaled down or
+// stopped. It is safe for concurrent use.
+type desiredLRPCache struct {
+	bbsClient          BBSClient
+	clock              clock.Clock
+	retryPauseInterval time.Duration
+	retireGracePeriod  time.Duration
+
+	mu          sync.RWMutex
+	synced      bool
+	desiredLRPs map[string]models.DesiredLRPSchedulingInfo
+	versions    map[string]string
+	retirements map[string]retirement
+}
+
+// retirement records that the instances of a process guid from fromIndex up
+// are expected to stop until the grace period ends.
+type retirement struct {
+	fromIndex int32
+	until     time.Time
+}
+
+func newDesiredLRPCache(bbsClient BBSClient, clock clock.Clock, retryPauseInterval, retireGracePeriod time.Duration) *desiredLRPCache {
+	return &desiredLRPCache{
+		bbsClient:          bbsClient,
+		clock:              clock,
+		retryPauseInterval: retryPauseInterval,
+		retireGracePeriod:  retireGracePeriod,
+		desiredLRPs:        map[string]models.DesiredLRPSchedulingInfo{},
+		versions:           map[string]string{},
+		retirements:        map[string]retirement{},
+	}
+}
+
+// get returns the scheduling info of the desired LRP with the given process
+// guid.
+func (c *desiredLRPCache) get(processGuid string) (models.DesiredLRPSchedulingInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	info, ok := c.desiredLRPs[processGuid]
+	return info, ok
+}
+
+// seeded returns whether the cache has been seeded from BBS, after which a
+// process guid that is not cached is not desired.
+func (c *desiredLRPCache) seeded() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.synced
+}
+
+// superseded returns whether the process guid belongs to an app version that
+// has been replaced by a newer one.
+func (c *desiredLRPCache) superseded(guid string) bool {
+	parsed, ok := parseProcessGuid(guid)
+	if !ok {
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	current, ok := c.versions[parsed.appGuid]
+	return ok && current != parsed.version
+}
+
+// retiring returns whether the instance is expected to stop because its app
+// was recently scaled down or stopped.
+func (c *desiredLRPCache) retiring(key models.ActualLRPKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, ok := c.retirements[key.ProcessGuid]
+	if !ok {
+		return false
+	}
+	if !c.clock.Now().Before(r.until) {
+		delete(c.retirements, key.ProcessGuid)
+		return false
+	}
+	return key.Index >= r.fromIndex
+}
+
+// run keeps the cache in sync until stop is closed, re-subscribing and
+// re-seeding the cache whenever the event stream fails.
+func (c *desiredLRPCache) run(logger lager.Logger, stop <-chan struct{}) {
+	logger = logger.Session("desired-lrp-cache")
+
+	for {
+		eventSource, err := c.subscribe(logger)
+		if err == nil {
+			done := make(chan struct{})
+			go func() {
+				select {
+				case <-stop:
+					eventSource.Close()
+				case <-done:
+				}
+			}()
+			c.consume(logger, eventSource)
+			close(done)
+		}
+
+		timer := c.clock.NewTimer(c.retryPauseInterval)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+	}
+}
+
+func (c *desiredLRPCache) subscribe(logger lager.Logger) (events.EventSource, error) {
+	logger.Info("subscribing-to-events")
+	eventSource, err := c.bbsClient.SubscribeToEvents(logger)
+	if err != nil {
+		logger.Error("failed-subscribing-to-events", err)
+		return nil, err
+	}
+
+	// Seed the cache after subscribing so that no change is missed between
+	// the two.
+	err = c.sync(logger)
+	if err != nil {
+		eventSource.Close()
+		return nil, err
+	}
+
+	logger.Info("subscribed-to-events")
+	return eventSource, nil
+}
+
+func (c *desiredLRPCache) sync(logger lager.Logger) error {
+	schedulingInfos, err := c.bbsClient.DesiredLRPSchedulingInfos(logger, "", models.DesiredLRPFilter{Domain: cc_messages.AppLRPDomain})
+	if err != nil {
+		logger.Error("failed-fetching-desired-lrps", err)
+		return err
+	}
+
+	desiredLRPs := make(map[string]models.DesiredLRPSchedulingInfo, len(schedulingInfos))
+	appVersions := map[string][]string{}
+	for _, info := range schedulingInfos {
+		desiredLRPs[info.ProcessGuid] = *info
+		if parsed, ok := parseProcessGuid(info.ProcessGuid); ok {
+			appVersions[parsed.appGuid] = append(appVersions[parsed.appGuid], parsed.version)
+		}
+	}
+
+	// The order in which the versions of an app were desired is not known, so
+	// an app only has a current version if there is exactly one.
+	versions := map[string]string{}
+	for appGuid, vs := range appVersions {
+		if len(vs) == 1 {
+			versions[appGuid] = vs[0]
+		}
+	}
+
+	c.mu.Lock()
+	c.synced = true
+	c.desiredLRPs = desiredLRPs
+	c.versions = versions
+	c.mu.Unlock()
+
+	logger.Info("synced-desired-lrps", lager.Data{"count": len(desiredLRPs)})
+	return nil
+}
+
+func (c *desiredLRPCache) consume(logger lager.Logger, eventSource events.EventSource) {
+	for {
+		event, err := eventSource.Next()
+		switch err {
+		case nil:
+			c.handleEvent(event)
+
+		case events.ErrUnrecognizedEventType:
+			logger.Debug("received-unexpected-event-type")
+
+		default:
+			logger.Error("failed-getting-next-event", err)
+			eventSource.Close()
+			return
+		}
+	}
+}
+
+func (c *desiredLRPCache) handleEvent(event models.Event) {
+	switch event := event.(type) {
+	case *models.DesiredLRPCreatedEvent:
+		c.put(event.DesiredLrp)
+		if event.DesiredLrp != nil && event.DesiredLrp.Domain == cc_messages.AppLRPDomain {
+			c.mu.Lock()
+			delete(c.retirements, event.DesiredLrp.ProcessGuid)
+			if parsed, ok := parseProcessGuid(event.DesiredLrp.ProcessGuid); ok {
+				c.versions[parsed.appGuid] = parsed.version
+			}
+			c.mu.Unlock()
+		}
+
+	case *models.DesiredLRPChangedEvent:
+		c.put(event.After)
+		if event.Before != nil && event.After != nil && event.After.Domain == cc_messages.AppLRPDomain {
+			c.retire(event.After.ProcessGuid, event.Before.Instances, event.After.Instances)
+		}
+
+	case *models.DesiredLRPRemovedEvent:
+		if event.DesiredLrp != nil {
+			c.remove(event.DesiredLrp.ProcessGuid)
+			if event.DesiredLrp.Domain == cc_messages.AppLRPDomain {
+				c.retire(event.DesiredLrp.ProcessGuid, event.DesiredLrp.Instances, 0)
+			}
+		}
+	}
+}
+
+func (c *desiredLRPCache) put(desiredLRP *models.DesiredLRP) {
+	if desiredLRP == nil || desiredLRP.Domain != cc_messages.AppLRPDomain {
+		return
+	}
+
+	c.mu.Lock()
+	c.desiredLRPs[desiredLRP.ProcessGuid] = desiredLRP.DesiredLRPSchedulingInfo()
+	c.mu.Unlock()
+}
+
+func (c *desiredLRPCache) remove(guid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.desiredLRPs, guid)
+	if parsed, ok := parseProcessGuid(guid); ok && c.versions[parsed.appGuid] == parsed.version {
+		delete(c.versions, parsed.appGuid)
+	}
+}
+
+// retire records that the instances of the process guid from index after up
+// are expected to stop when its instance count goes from before to after.
+func (c *desiredLRPCache) retire(guid string, before, after int32) {
+	if c.retireGracePeriod <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	r, pending := c.retirements[guid]
+	if pending && !now.Before(r.until) {
+		pending = false
+	}
+
+	switch {
+	case after < before:
+		if !pending || after < r.fromIndex {
+			r.fromIndex = after
+		}
+		r.until = now.Add(c.retireGracePeriod)
+		c.retirements[guid] = r
+
+	case pending && after > r.fromIndex:
+		// Instances that are desired again are no longer expected to stop.
+		r.fromIndex = after
+		c.retirements[guid] = r
+	}
+}
@@ -0,0 +1,65 @@
+package watcher
+
+import (
+	"code.cloudfoundry.org/bbs/models"
+)
+
+// evacuation is an app instance that is being moved off an evacuating cell.
+// Times are in nanoseconds since the epoch.
+type evacuation struct {
+	instanceKey models.ActualLRPInstanceKey
+	startedAt   int64
+	removedAt   int64
+}
+
+// evacuationTracker correlates evacuating app instances with the ordinary
+// instance that replaces them on another cell. It is only accessed from the
+// Run loop.
+type evacuationTracker struct {
+	evacuations map[models.ActualLRPKey]*evacuation
+}
+
+func newEvacuationTracker() *evacuationTracker {
+	return &evacuationTracker{
+		evacuations: map[models.ActualLRPKey]*evacuation{},
+	}
+}
+
+// evacuating records that the instance is being evacuated.
+func (t *evacuationTracker) evacuating(key models.ActualLRPKey, instanceKey models.ActualLRPInstanceKey, now int64) {
+	if e, ok := t.evacuations[key]; ok && e.instanceKey == instanceKey {
+		return
+	}
+	t.evacuations[key] = &evacuation{instanceKey: instanceKey, startedAt: now}
+}
+
+// evacuated records that the evacuating instance has stopped. An evacuation
+// that is not tracked, because its replacement was already reported, is
+// ignored.
+func (t *evacuationTracker) evacuated(key models.ActualLRPKey, instanceKey models.ActualLRPInstanceKey, now int64) {
+	e, ok := t.evacuations[key]
+	if !ok || e.instanceKey != instanceKey {
+		return
+	}
+	e.removedAt = now
+}
+
+// replaced returns the evacuation completed by a ready replacement instance
+// and how long the index had no ready instance while moving.
+func (t *evacuationTracker) replaced(key models.ActualLRPKey, instanceKey models.ActualLRPInstanceKey, now int64) (evacuation, int64, bool) {
+	e, ok := t.evacuations[key]
+	if !ok || e.instanceKey.InstanceGuid == instanceKey.InstanceGuid {
+		return evacuation{}, 0, false
+	}
+	delete(t.evacuations, key)
+
+	var downtime int64
+	if e.removedAt != 0 && now > e.removedAt {
+		downtime = now - e.removedAt
+	}
+	return *e, downtime, true
+}
+
+func (t *evacuationTracker) forget(key models.ActualLRPKey) {
+	delete(t.evacuations, key)
+}
@@ -0,0 +1,157 @@
+package watcher
+
+import (
+	"sort"
+	"time"
+)
+
+const incidentCheckInterval = 10 * time.Second
+
+type incidentKind int
+
+const (
+	incidentCrash incidentKind = iota
+	incidentRemoval
+	incidentReadinessDrop
+	incidentLoss
+)
+
+// incident is a failure of a single app instance. at is in nanoseconds since
+// the epoch.
+type incident struct {
+	at          int64
+	kind        incidentKind
+	processGuid string
+}
+
+// CellUnhealthyAlert is the data of the lifecycle event published when a cell
+// is reported as unhealthy.
+type CellUnhealthyAlert struct {
+	CellID         string   `json:"cell_id"`
+	Crashes        int      `json:"crashes"`
+	Removals       int      `json:"removals"`
+	ReadinessDrops int      `json:"readiness_drops"`
+	ProcessGuids   []string `json:"process_guids"`
+	Window         string   `json:"window"`
+}
+
+// ZoneDegradedAlert is the data of the lifecycle event published when an
+// availability zone is reported as degraded.
+type ZoneDegradedAlert struct {
+	AvailabilityZone string   `json:"availability_zone"`
+	Crashes          int      `json:"crashes"`
+	LostInstances    int      `json:"lost_instances"`
+	AffectedApps     int      `json:"affected_apps"`
+	ProcessGuids     []string `json:"process_guids"`
+	Window           string   `json:"window"`
+}
+
+type incidentSummary struct {
+	crashes        int
+	removals       int
+	readinessDrops int
+	losses         int
+	processGuids   []string
+}
+
+func (s incidentSummary) total() int {
+	return s.crashes + s.removals + s.readinessDrops + s.losses
+}
+
+// incidentAggregator groups instance failures by a shared attribute, such as
+// the cell or the availability zone, over a sliding window and decides when a
+// group is failing as a whole. It is only accessed from the Run loop.
+type incidentAggregator struct {
+	threshold int
+	window    time.Duration
+
+	incidents map[string][]incident
+	alerting  map[string]bool
+}
+
+func newIncidentAggregator(threshold int, window time.Duration) *incidentAggregator {
+	return &incidentAggregator{
+		threshold: threshold,
+		window:    window,
+		incidents: map[string][]incident{},
+		alerting:  map[string]bool{},
+	}
+}
+
+func (a *incidentAggregator) enabled() bool {
+	return a.threshold > 0
+}
+
+// record adds an incident to the group. It returns a summary of the window
+// when the group crosses the threshold; a group is not reported again until
+// it has recovered.
+func (a *incidentAggregator) record(group string, i incident) (incidentSummary, bool) {
+	if !a.enabled() || group == "" {
+		return incidentSummary{}, false
+	}
+
+	incidents := a.prune(group, i.at)
+	incidents = append(incidents, i)
+	a.incidents[group] = incidents
+
+	if a.alerting[group] || len(incidents) < a.threshold {
+		return incidentSummary{}, false
+	}
+
+	a.alerting[group] = true
+	return summarize(incidents), true
+}
+
+// recovered forgets incidents that fell out of the window and returns the
+// groups that were alerting and are now below the threshold.
+func (a *incidentAggregator) recovered(now time.Time) []string {
+	var groups []string
+	for group := range a.incidents {
+		incidents := a.prune(group, now.UnixNano())
+		if len(incidents) == 0 {
+			delete(a.incidents, group)
+		} else {
+			a.incidents[group] = incidents
+		}
+
+		if a.alerting[group] && len(incidents) < a.threshold {
+			delete(a.alerting, group)
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+func (a *incidentAggregator) prune(group string, now int64) []incident {
+	incidents := a.incidents[group]
+	cutoff := now - int64(a.window)
+	for len(incidents) > 0 && incidents[0].at < cutoff {
+		incidents = incidents[1:]
+	}
+	return incidents
+}
+
+func summarize(incidents []incident) incidentSummary {
+	var summary incidentSummary
+	guids := map[string]bool{}
+	for _, i := range incidents {
+		switch i.kind {
+		case incidentCrash:
+			summary.crashes++
+		case incidentRemoval:
+			summary.removals++
+		case incidentReadinessDrop:
+			summary.readinessDrops++
+		case incidentLoss:
+			summary.losses++
+		}
+
+		if !guids[i.processGuid] {
+			guids[i.processGuid] = true
+			summary.processGuids = append(summary.processGuids, i.processGuid)
+		}
+	}
+	sort.Strings(summary.processGuids)
+	return summary
+}
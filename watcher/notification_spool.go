@@ -0,0 +1,54 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/cloudfoundry/dropsonde/metrics"
+)
+
+const (
+	spoolRetryInterval      = 5 * time.Second
+	maxSpooledNotifications = 10000
+	spooledDroppedCounter   = "CCSpooledNotificationsDropped"
+)
+
+// notification is a CC notification that can be sent again.
+type notification struct {
+	logger lager.Logger
+	action string
+	send   func(lager.Logger) error
+}
+
+// notificationSpool holds the notifications that were refused because the
+// CC circuit breaker was open, until they are sent again. Once it is full,
+// the oldest notification is dropped for every new one. It is safe for
+// concurrent use.
+type notificationSpool struct {
+	mu            sync.Mutex
+	notifications []notification
+}
+
+func (s *notificationSpool) add(n notification) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.notifications) >= maxSpooledNotifications {
+		dropped := s.notifications[0]
+		s.notifications = s.notifications[1:]
+		dropped.logger.Info("dropped-spooled-" + dropped.action)
+		metrics.IncrementCounter(spooledDroppedCounter)
+	}
+	s.notifications = append(s.notifications, n)
+}
+
+// drain removes and returns the spooled notifications, oldest first.
+func (s *notificationSpool) drain() []notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notifications := s.notifications
+	s.notifications = nil
+	return notifications
+}
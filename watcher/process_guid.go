@@ -0,0 +1,19 @@
+package watcher
+
+const guidLength = 36
+
+// processGuid is a CC process guid, which is made up of the guid of the app
+// and the guid of the app version: <app-guid>-<version-guid>.
+type processGuid struct {
+	appGuid string
+	version string
+}
+
+// parseProcessGuid splits a CC process guid into its app guid and version. It
+// returns false for process guids that were not generated by CC.
+func parseProcessGuid(guid string) (processGuid, bool) {
+	if len(guid) != 2*guidLength+1 || guid[guidLength] != '-' {
+		return processGuid{}, false
+	}
+	return processGuid{appGuid: guid[:guidLength], version: guid[guidLength+1:]}, true
+}
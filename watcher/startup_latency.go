@@ -0,0 +1,257 @@
+package watcher
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	"code.cloudfoundry.org/tps/taggedmetrics"
+)
+
+const (
+	timeToRunningMetric  = "AppInstanceTimeToRunning"
+	timeToRoutableMetric = "AppInstanceTimeToRoutable"
+
+	startupSummaryInterval = time.Minute
+)
+
+// startupLatencyBuckets are the upper bounds of the startup latency histograms.
+var startupLatencyBuckets = []time.Duration{
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	2 * time.Minute,
+	5 * time.Minute,
+	10 * time.Minute,
+}
+
+type latencyHistogram struct {
+	// counts holds one cumulative count per bucket plus a final +Inf bucket.
+	counts []uint64
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{counts: make([]uint64, len(startupLatencyBuckets)+1)}
+}
+
+func (h *latencyHistogram) observe(latency time.Duration) {
+	for i, bound := range startupLatencyBuckets {
+		if latency <= bound {
+			h.counts[i]++
+		}
+	}
+	h.counts[len(startupLatencyBuckets)]++
+}
+
+func (h *latencyHistogram) emit(name string) {
+	for i, count := range h.counts {
+		le := "+Inf"
+		if i < len(startupLatencyBuckets) {
+			le = strconv.FormatFloat(startupLatencyBuckets[i].Seconds(), 'f', -1, 64)
+		}
+		taggedmetrics.SendValue(name+"Bucket", float64(count), "Metric", "le", le)
+	}
+}
+
+type latencySummary struct {
+	count int
+	total time.Duration
+	max   time.Duration
+}
+
+func (s *latencySummary) observe(latency time.Duration) {
+	s.count++
+	s.total += latency
+	if latency > s.max {
+		s.max = latency
+	}
+}
+
+func (s latencySummary) mean() time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	return s.total / time.Duration(s.count)
+}
+
+// startupSummary summarizes the startup latencies of the instances of an app
+// or on a cell.
+type startupSummary struct {
+	toRunning  latencySummary
+	toRoutable latencySummary
+}
+
+// startingInstance is an app instance on its way to becoming routable. Times
+// are in nanoseconds since the epoch.
+type startingInstance struct {
+	startedAt int64
+	runningAt int64
+}
+
+// startupLatencyTracker measures how long app instances take to go from being
+// created, or restarted, to RUNNING and then to routable. Each measurement is
+// sent as an untagged metric, so that the number of series does not grow with
+// the number of instances; histograms and per-app and per-cell summaries are
+// sent periodically. It is only accessed from the Run loop.
+type startupLatencyTracker struct {
+	starting   map[models.ActualLRPKey]*startingInstance
+	toRunning  *latencyHistogram
+	toRoutable *latencyHistogram
+	apps       map[string]*startupSummary
+	cells      map[string]*startupSummary
+}
+
+func newStartupLatencyTracker() *startupLatencyTracker {
+	return &startupLatencyTracker{
+		starting:   map[models.ActualLRPKey]*startingInstance{},
+		toRunning:  newLatencyHistogram(),
+		toRoutable: newLatencyHistogram(),
+		apps:       map[string]*startupSummary{},
+		cells:      map[string]*startupSummary{},
+	}
+}
+
+func (t *startupLatencyTracker) handleEvent(event models.Event, now time.Time) {
+	switch event := event.(type) {
+	case *models.ActualLRPInstanceCreatedEvent:
+		lrp := event.ActualLrp
+		if lrp.Domain == cc_messages.AppLRPDomain && lrp.Presence == models.ActualLRP_Ordinary {
+			t.starting[lrp.ActualLRPKey] = &startingInstance{startedAt: lrp.Since}
+		}
+
+	case *models.ActualLRPInstanceChangedEvent:
+		before, after := event.Before, event.After
+		if event.Domain != cc_messages.AppLRPDomain || before == nil || after == nil || after.Presence != models.ActualLRP_Ordinary {
+			return
+		}
+		key := event.ActualLRPKey
+
+		switch after.State {
+		case models.ActualLRPStateUnclaimed:
+			if before.State != models.ActualLRPStateUnclaimed {
+				t.starting[key] = &startingInstance{startedAt: after.Since}
+			}
+			return
+
+		case models.ActualLRPStateClaimed:
+			return
+
+		case models.ActualLRPStateRunning:
+		default:
+			delete(t.starting, key)
+			return
+		}
+
+		instance, ok := t.starting[key]
+		if !ok {
+			return
+		}
+
+		justStarted := before.State != models.ActualLRPStateRunning
+		if justStarted {
+			instance.runningAt = after.Since
+			t.record(key.ProcessGuid, event.CellId, timeToRunningMetric, time.Duration(instance.runningAt-instance.startedAt))
+		}
+
+		if after.GetRoutable() && !before.GetRoutable() {
+			routableAt := now.UnixNano()
+			if justStarted {
+				routableAt = instance.runningAt
+			}
+			t.record(key.ProcessGuid, event.CellId, timeToRoutableMetric, time.Duration(routableAt-instance.startedAt))
+			delete(t.starting, key)
+		}
+
+	case *models.ActualLRPInstanceRemovedEvent:
+		if event.ActualLrp.Presence == models.ActualLRP_Ordinary {
+			delete(t.starting, event.ActualLrp.ActualLRPKey)
+		}
+	}
+}
+
+func (t *startupLatencyTracker) record(processGuid, cellID, metric string, latency time.Duration) {
+	if latency < 0 {
+		latency = 0
+	}
+
+	switch metric {
+	case timeToRunningMetric:
+		t.toRunning.observe(latency)
+	case timeToRoutableMetric:
+		t.toRoutable.observe(latency)
+	}
+	observeStartup(t.apps, processGuid, metric, latency)
+	if cellID != "" {
+		observeStartup(t.cells, cellID, metric, latency)
+	}
+
+	taggedmetrics.SendValue(metric, float64(latency/time.Millisecond), "ms")
+}
+
+func observeStartup(summaries map[string]*startupSummary, key, metric string, latency time.Duration) {
+	summary, ok := summaries[key]
+	if !ok {
+		summary = &startupSummary{}
+		summaries[key] = summary
+	}
+
+	switch metric {
+	case timeToRunningMetric:
+		summary.toRunning.observe(latency)
+	case timeToRoutableMetric:
+		summary.toRoutable.observe(latency)
+	}
+}
+
+// report sends the histograms and a summary for every app that started
+// instances, and for every cell that instances started on, since the last
+// report.
+func (t *startupLatencyTracker) report(logger lager.Logger) {
+	t.toRunning.emit(timeToRunningMetric)
+	t.toRoutable.emit(timeToRoutableMetric)
+
+	reportStartupSummaries(logger, "app-startup-latency-summary", "process-guid", "", "process_guid", t.apps)
+	reportStartupSummaries(logger, "cell-startup-latency-summary", "cell-id", "Cell", "cell_id", t.cells)
+
+	t.apps = map[string]*startupSummary{}
+	t.cells = map[string]*startupSummary{}
+}
+
+// reportStartupSummaries logs the summaries and sends their mean and max as
+// metrics with the given infix, tagged with the key of each summary.
+func reportStartupSummaries(logger lager.Logger, message, dataKey, infix, tag string, summaries map[string]*startupSummary) {
+	keys := make([]string, 0, len(summaries))
+	for key := range summaries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		summary := summaries[key]
+		logger.Info(message, lager.Data{
+			dataKey:                 key,
+			"instances-running":     summary.toRunning.count,
+			"mean-time-to-running":  summary.toRunning.mean().String(),
+			"max-time-to-running":   summary.toRunning.max.String(),
+			"instances-routable":    summary.toRoutable.count,
+			"mean-time-to-routable": summary.toRoutable.mean().String(),
+			"max-time-to-routable":  summary.toRoutable.max.String(),
+		})
+
+		for metric, s := range map[string]latencySummary{
+			timeToRunningMetric:  summary.toRunning,
+			timeToRoutableMetric: summary.toRoutable,
+		} {
+			if s.count == 0 {
+				continue
+			}
+			taggedmetrics.SendValue(metric+infix+"Mean", float64(s.mean()/time.Millisecond), "ms", tag, key)
+			taggedmetrics.SendValue(metric+infix+"Max", float64(s.max/time.Millisecond), "ms", tag, key)
+		}
+	}
+}
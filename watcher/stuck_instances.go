@@ -0,0 +1,87 @@
+package watcher
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+)
+
+const stuckInstanceCheckInterval = 10 * time.Second
+
+// pendingInstance is an app instance that has not reached RUNNING yet.
+type pendingInstance struct {
+	key            models.ActualLRPKey
+	instanceKey    models.ActualLRPInstanceKey
+	state          string
+	since          int64
+	placementError string
+	reported       bool
+}
+
+// stuckInstanceDetector remembers when each ordinary app instance entered the
+// UNCLAIMED or CLAIMED state and finds the ones that have stayed there for
+// longer than the threshold. It is only accessed from the Run loop.
+type stuckInstanceDetector struct {
+	threshold time.Duration
+	pending   map[models.ActualLRPKey]*pendingInstance
+}
+
+func newStuckInstanceDetector(threshold time.Duration) *stuckInstanceDetector {
+	return &stuckInstanceDetector{
+		threshold: threshold,
+		pending:   map[models.ActualLRPKey]*pendingInstance{},
+	}
+}
+
+func (d *stuckInstanceDetector) enabled() bool {
+	return d.threshold > 0
+}
+
+// observe records the current state of an instance index. Instances that are
+// neither UNCLAIMED nor CLAIMED are no longer tracked.
+func (d *stuckInstanceDetector) observe(key models.ActualLRPKey, instanceKey models.ActualLRPInstanceKey, state string, since int64, placementError string) {
+	if state != models.ActualLRPStateUnclaimed && state != models.ActualLRPStateClaimed {
+		delete(d.pending, key)
+		return
+	}
+
+	// An unclaimed instance is not on a cell; the key of the previous
+	// instance may still be attached to the event.
+	if state == models.ActualLRPStateUnclaimed {
+		instanceKey = models.ActualLRPInstanceKey{}
+	}
+
+	if pending, ok := d.pending[key]; ok && pending.state == state {
+		pending.instanceKey = instanceKey
+		pending.placementError = placementError
+		return
+	}
+
+	d.pending[key] = &pendingInstance{
+		key:            key,
+		instanceKey:    instanceKey,
+		state:          state,
+		since:          since,
+		placementError: placementError,
+	}
+}
+
+func (d *stuckInstanceDetector) forget(key models.ActualLRPKey) {
+	delete(d.pending, key)
+}
+
+// stuck returns the instances that have been in the same state for longer
+// than the threshold and have not been returned before.
+func (d *stuckInstanceDetector) stuck(now time.Time) []pendingInstance {
+	cutoff := now.Add(-d.threshold).UnixNano()
+
+	var stuck []pendingInstance
+	for _, pending := range d.pending {
+		if pending.reported || pending.since > cutoff {
+			continue
+		}
+		pending.reported = true
+		stuck = append(stuck, *pending)
+	}
+	return stuck
+}
@@ -1,35 +1,145 @@
 package watcher
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"time"
 
-	"code.cloudfoundry.org/bbs"
 	"code.cloudfoundry.org/bbs/events"
 	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/runtimeschema/cc_messages"
 	"code.cloudfoundry.org/tps/cc_client"
+	"code.cloudfoundry.org/tps/lifecycle"
+	"code.cloudfoundry.org/tps/taggedmetrics"
+	"code.cloudfoundry.org/tps/tracing"
 	"code.cloudfoundry.org/workpool"
+	"github.com/cloudfoundry/dropsonde/metrics"
 )
 
 const DefaultRetryPauseInterval = time.Second
 
+const (
+	crashLoopsDetectedCounter     = "AppCrashLoopsDetected"
+	instancesFailedToStartCounter = "AppInstancesFailedToStart"
+	instancesRescheduledCounter   = "AppInstancesRescheduled"
+	instancesLostCounter          = "AppInstancesLost"
+	supersededEventsCounter       = "AppSupersededVersionEventsIgnored"
+	retiringEventsCounter         = "AppRetiringInstanceEventsIgnored"
+	appAvailabilityChangesCounter = "AppAvailabilityChanges"
+	cellUnhealthyAlertsCounter    = "CellUnhealthyAlerts"
+	cellUnhealthyMetric           = "CellUnhealthy"
+	zoneDegradedAlertsCounter     = "AvailabilityZoneDegradedAlerts"
+	zoneDegradedMetric            = "AvailabilityZoneDegraded"
+	zoneAffectedAppsMetric        = "AvailabilityZoneAffectedApps"
+)
+
+const (
+	// InstanceLostReasonCellLost is reported when a running instance is removed
+	// after BBS lost contact with its cell.
+	InstanceLostReasonCellLost = "CELL_LOST"
+	// InstanceLostReasonRemoved is reported when a running instance is removed
+	// while its index is still desired.
+	InstanceLostReasonRemoved = "UNEXPECTEDLY_REMOVED"
+)
+
+// Config holds the tuning parameters of the watcher's event detectors.
+type Config struct {
+	// CrashLoopThreshold is the number of crashes of an instance index within
+	// CrashLoopWindow after which it is reported as crash looping. Zero
+	// disables crash loop detection.
+	CrashLoopThreshold int
+	CrashLoopWindow    time.Duration
+
+	// StuckInstanceThreshold is how long an instance may stay UNCLAIMED or
+	// CLAIMED before it is reported as having failed to start. Zero disables
+	// the check.
+	StuckInstanceThreshold time.Duration
+
+	// NotifyAppRescheduled enables notifying CC when an evacuated instance
+	// has been replaced on another cell. CCs that do not know the
+	// notification reject it, so it is off by default.
+	NotifyAppRescheduled bool
+
+	// NotifyAppInstanceLost enables notifying CC when a running instance
+	// disappears without crashing, being evacuated or being stopped. It is off
+	// by default for the same reason.
+	NotifyAppInstanceLost bool
+
+	// NotifyAppAvailabilityChanged enables notifying CC when an app becomes
+	// READY, DEGRADED or UNAVAILABLE. It is off by default for the same
+	// reason.
+	NotifyAppAvailabilityChanged bool
+
+	// CellUnhealthyThreshold is the number of crashes, suspect instance
+	// removals and readiness drops on a single cell within CellUnhealthyWindow
+	// after which the cell is reported as unhealthy. Zero disables the check.
+	CellUnhealthyThreshold int
+	CellUnhealthyWindow    time.Duration
+
+	// ZoneDegradedThreshold is the number of crashes and lost instances in a
+	// single availability zone within ZoneDegradedWindow after which the zone
+	// is reported as degraded. Zero disables the check.
+	ZoneDegradedThreshold int
+	ZoneDegradedWindow    time.Duration
+
+	// ScaleDownGracePeriod is how long after an app is scaled down or stopped
+	// the crashes, readiness drops and removals of its stopping instances are
+	// treated as expected rather than reported. Zero disables the check.
+	ScaleDownGracePeriod time.Duration
+
+	// LifecycleEventBufferSize is the number of recent lifecycle events kept
+	// for subscribers that resume their stream. Zero disables replay.
+	LifecycleEventBufferSize int
+}
+
+// BBSClient is the part of the BBS API used by the watcher.
+type BBSClient interface {
+	SubscribeToInstanceEvents(logger lager.Logger) (events.EventSource, error)
+	SubscribeToEvents(logger lager.Logger) (events.EventSource, error)
+	ActualLRPs(logger lager.Logger, traceID string, filter models.ActualLRPFilter) ([]*models.ActualLRP, error)
+	DesiredLRPSchedulingInfos(logger lager.Logger, traceID string, filter models.DesiredLRPFilter) ([]*models.DesiredLRPSchedulingInfo, error)
+}
+
 type Watcher struct {
-	bbsClient          bbs.Client
+	bbsClient          BBSClient
 	ccClient           cc_client.CcClient
 	logger             lager.Logger
+	clock              clock.Clock
 	retryPauseInterval time.Duration
+	config             Config
+
+	// instanceDetails holds the last known placement of each ordinary app
+	// instance. It is only accessed from the Run loop.
+	instanceDetails map[models.ActualLRPKey]cc_client.InstanceDetails
+	crashLoops      *crashLoopDetector
+	stuckInstances  *stuckInstanceDetector
+	startupLatency  *startupLatencyTracker
+	evacuations     *evacuationTracker
+	cellHealth      *incidentAggregator
+	zoneHealth      *incidentAggregator
+	appReadiness    *appReadinessTracker
+
+	desiredLRPs *desiredLRPCache
+	actualLRPs  *actualLRPMirror
 
-	pool *workpool.WorkPool
+	lifecycleEvents *lifecycle.Broadcaster
+
+	pool  *workpool.WorkPool
+	spool *notificationSpool
 }
 
 func NewWatcher(
 	logger lager.Logger,
+	clock clock.Clock,
 	workPoolSize int,
 	retryPauseInterval time.Duration,
-	bbsClient bbs.Client,
+	bbsClient BBSClient,
 	ccClient cc_client.CcClient,
+	config Config,
 ) (*Watcher, error) {
 	workPool, err := workpool.NewWorkPool(workPoolSize)
 	if err != nil {
@@ -40,8 +150,22 @@ func NewWatcher(
 		bbsClient:          bbsClient,
 		ccClient:           ccClient,
 		logger:             logger,
+		clock:              clock,
 		retryPauseInterval: retryPauseInterval,
+		config:             config,
+		instanceDetails:    map[models.ActualLRPKey]cc_client.InstanceDetails{},
+		crashLoops:         newCrashLoopDetector(config.CrashLoopThreshold, config.CrashLoopWindow),
+		stuckInstances:     newStuckInstanceDetector(config.StuckInstanceThreshold),
+		startupLatency:     newStartupLatencyTracker(),
+		evacuations:        newEvacuationTracker(),
+		cellHealth:         newIncidentAggregator(config.CellUnhealthyThreshold, config.CellUnhealthyWindow),
+		zoneHealth:         newIncidentAggregator(config.ZoneDegradedThreshold, config.ZoneDegradedWindow),
+		appReadiness:       newAppReadinessTracker(),
+		actualLRPs:         newActualLRPMirror(),
+		desiredLRPs:        newDesiredLRPCache(bbsClient, clock, retryPauseInterval, config.ScaleDownGracePeriod),
+		lifecycleEvents:    lifecycle.NewBroadcaster(clock, config.LifecycleEventBufferSize),
 		pool:               workPool,
+		spool:              &notificationSpool{},
 	}, nil
 }
 
@@ -50,10 +174,39 @@ func (watcher *Watcher) Run(signals <-chan os.Signal, ready chan<- struct{}) err
 	logger.Info("starting")
 	defer logger.Info("finished")
 
+	// Canceling the context on return aborts the CC requests that are still
+	// in flight when the watcher stops.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	var subscription events.EventSource
 	subscriptionChan := make(chan events.EventSource, 1)
 	go subscribeToEvents(logger, watcher.bbsClient, subscriptionChan)
 
+	stopDesiredLRPs := make(chan struct{})
+	defer close(stopDesiredLRPs)
+	go watcher.desiredLRPs.run(logger, stopDesiredLRPs)
+
+	var stuckInstanceTicks <-chan time.Time
+	if watcher.stuckInstances.enabled() {
+		ticker := watcher.clock.NewTicker(stuckInstanceCheckInterval)
+		defer ticker.Stop()
+		stuckInstanceTicks = ticker.C()
+	}
+
+	var incidentTicks <-chan time.Time
+	if watcher.cellHealth.enabled() || watcher.zoneHealth.enabled() {
+		ticker := watcher.clock.NewTicker(incidentCheckInterval)
+		defer ticker.Stop()
+		incidentTicks = ticker.C()
+	}
+
+	startupSummaryTicker := watcher.clock.NewTicker(startupSummaryInterval)
+	defer startupSummaryTicker.Stop()
+
+	spoolRetryTicker := watcher.clock.NewTicker(spoolRetryInterval)
+	defer spoolRetryTicker.Stop()
+
 	eventChan := make(chan models.Event, 1)
 	errorChan := make(chan error, 1)
 	nextErrCount := 0
@@ -65,6 +218,7 @@ func (watcher *Watcher) Run(signals <-chan os.Signal, ready chan<- struct{}) err
 		select {
 		case subscription = <-subscriptionChan:
 			if subscription != nil {
+				watcher.seedInstances(logger)
 				go nextEvent(logger, subscription, eventChan, errorChan, watcher.retryPauseInterval)
 			} else {
 				go subscribeToEvents(logger, watcher.bbsClient, subscriptionChan)
@@ -72,7 +226,7 @@ func (watcher *Watcher) Run(signals <-chan os.Signal, ready chan<- struct{}) err
 
 		case event := <-eventChan:
 			if event != nil {
-				watcher.handleEvent(logger, event)
+				watcher.handleEvent(ctx, logger, event)
 			} else {
 				nextErrCount += 1
 				if nextErrCount > 2 {
@@ -94,6 +248,19 @@ func (watcher *Watcher) Run(signals <-chan os.Signal, ready chan<- struct{}) err
 				go nextEvent(logger, subscription, eventChan, errorChan, watcher.retryPauseInterval)
 			}
 
+		case <-stuckInstanceTicks:
+			watcher.reportStuckInstances(ctx, logger)
+
+		case <-incidentTicks:
+			watcher.reportRecoveredCells(logger)
+			watcher.reportRecoveredZones(logger)
+
+		case <-startupSummaryTicker.C():
+			watcher.startupLatency.report(logger)
+
+		case <-spoolRetryTicker.C():
+			watcher.retrySpooled(logger)
+
 		case <-signals:
 			logger.Info("stopping")
 			if subscription != nil {
@@ -107,7 +274,64 @@ func (watcher *Watcher) Run(signals <-chan os.Signal, ready chan<- struct{}) err
 	}
 }
 
-func (watcher *Watcher) handleEvent(logger lager.Logger, event models.Event) {
+// DesiredLRP returns the cached scheduling info of the desired app LRP with
+// the given process guid.
+func (watcher *Watcher) DesiredLRP(processGuid string) (models.DesiredLRPSchedulingInfo, bool) {
+	return watcher.desiredLRPs.get(processGuid)
+}
+
+// ActualLRPs returns the known actual LRPs of the app with the given process
+// guid, ordered by index.
+func (watcher *Watcher) ActualLRPs(processGuid string) []*models.ActualLRP {
+	return watcher.actualLRPs.get(processGuid)
+}
+
+// LifecycleEvents returns the broadcaster of the app lifecycle events reported
+// by the watcher.
+func (watcher *Watcher) LifecycleEvents() *lifecycle.Broadcaster {
+	return watcher.lifecycleEvents
+}
+
+func (watcher *Watcher) handleEvent(ctx context.Context, logger lager.Logger, event models.Event) {
+	// Each event is handled in a span of its own, which continues the BBS
+	// trace of the event if it has one and is propagated to CC.
+	span := tracing.NewSpan(eventTraceID(event))
+	logger = span.Logger(logger)
+	ctx = tracing.NewContext(ctx, span)
+
+	watcher.actualLRPs.handleEvent(event)
+	watcher.trackInstances(event)
+	watcher.startupLatency.handleEvent(event, watcher.clock.Now())
+	watcher.trackAppReadiness(ctx, logger, event)
+
+	// Instances of an app version that has been replaced are torn down during
+	// a deploy; their crashes and readiness drops are expected.
+	key := eventActualLRPKey(event)
+	if watcher.desiredLRPs.superseded(key.ProcessGuid) {
+		logger.Debug("ignoring-event-for-superseded-version", lager.Data{
+			"process-guid": key.ProcessGuid,
+			"event-type":   event.EventType(),
+		})
+		metrics.IncrementCounter(supersededEventsCounter)
+		return
+	}
+
+	// Instances of an app that was just scaled down or stopped may crash or
+	// become unready while they are being stopped.
+	if watcher.desiredLRPs.retiring(key) {
+		logger.Info("ignoring-event-for-retiring-instance", lager.Data{
+			"process-guid": key.ProcessGuid,
+			"index":        key.Index,
+			"event-type":   event.EventType(),
+		})
+		metrics.IncrementCounter(retiringEventsCounter)
+		return
+	}
+
+	watcher.trackEvacuations(ctx, logger, event)
+	watcher.trackIncidents(logger, event)
+	watcher.detectLostInstance(ctx, logger, event)
+
 	if crashed, ok := event.(*models.ActualLRPCrashedEvent); ok {
 		if crashed.ActualLRPKey.Domain == cc_messages.AppLRPDomain {
 			logger.Info("app-crashed", lager.Data{
@@ -117,27 +341,28 @@ func (watcher *Watcher) handleEvent(logger lager.Logger, event models.Event) {
 
 			guid := crashed.ActualLRPKey.ProcessGuid
 			cellId := crashed.ActualLRPInstanceKey.CellId
-			appCrashed := cc_messages.AppCrashedRequest{
-				Instance:        crashed.ActualLRPInstanceKey.InstanceGuid,
-				Index:           int(crashed.ActualLRPKey.Index),
-				CellID:          cellId,
-				Reason:          "CRASHED",
-				ExitDescription: crashed.CrashReason,
-				CrashCount:      int(crashed.CrashCount),
-				CrashTimestamp:  crashed.Since,
+			appCrashed := cc_client.AppCrashedRequest{
+				AppCrashedRequest: cc_messages.AppCrashedRequest{
+					Instance:        crashed.ActualLRPInstanceKey.InstanceGuid,
+					Index:           int(crashed.ActualLRPKey.Index),
+					CellID:          cellId,
+					Reason:          "CRASHED",
+					ExitDescription: crashed.CrashReason,
+					CrashCount:      int(crashed.CrashCount),
+					CrashTimestamp:  crashed.Since,
+				},
+				InstanceDetails: watcher.lookupInstanceDetails(crashed.ActualLRPKey),
 			}
+			watcher.publish(logger, lifecycle.AppCrashed, guid, appCrashed)
 
-			watcher.pool.Submit(func() {
-				logger := logger.WithData(lager.Data{
-					"process-guid": guid,
-					"index":        appCrashed.Index,
-				})
-				logger.Info("recording-app-crashed")
-				err := watcher.ccClient.AppCrashed(guid, appCrashed, logger)
-				if err != nil {
-					logger.Error("failed-recording-app-crashed", err)
-				}
+			watcher.notify(logger.WithData(lager.Data{
+				"process-guid": guid,
+				"index":        appCrashed.Index,
+			}), "app-crashed", func(logger lager.Logger) error {
+				return watcher.ccClient.AppCrashedWithContext(ctx, guid, appCrashed, logger)
 			})
+
+			watcher.detectCrashLoop(ctx, logger, crashed, appCrashed.InstanceDetails)
 		}
 	}
 
@@ -151,23 +376,24 @@ func (watcher *Watcher) handleEvent(logger lager.Logger, event models.Event) {
 				"index":        key.Index,
 			})
 
-			appRescheduling := cc_messages.AppReschedulingRequest{
-				Instance: instanceKey.InstanceGuid,
-				Index:    int(key.Index),
-				CellID:   instanceKey.CellId,
-				Reason:   "Cell is being evacuated",
+			details := newInstanceDetails(removed.ActualLrp)
+			appRescheduling := cc_client.AppReschedulingRequest{
+				AppReschedulingRequest: cc_messages.AppReschedulingRequest{
+					Instance: instanceKey.InstanceGuid,
+					Index:    int(key.Index),
+					CellID:   instanceKey.CellId,
+					Reason:   "Cell is being evacuated",
+				},
+				Since:           removed.ActualLrp.Since,
+				InstanceDetails: &details,
 			}
+			watcher.publish(logger, lifecycle.AppRescheduling, key.ProcessGuid, appRescheduling)
 
-			watcher.pool.Submit(func() {
-				logger := logger.WithData(lager.Data{
-					"process-guid": key.ProcessGuid,
-					"index":        key.Index,
-				})
-				logger.Info("recording-evacuating-app-instance")
-				err := watcher.ccClient.AppRescheduling(key.ProcessGuid, appRescheduling, logger)
-				if err != nil {
-					logger.Error("failed-recording-evacuating-app-instance", err)
-				}
+			watcher.notify(logger.WithData(lager.Data{
+				"process-guid": key.ProcessGuid,
+				"index":        key.Index,
+			}), "evacuating-app-instance", func(logger lager.Logger) error {
+				return watcher.ccClient.AppReschedulingWithContext(ctx, key.ProcessGuid, appRescheduling, logger)
 			})
 		}
 	}
@@ -186,29 +412,611 @@ func (watcher *Watcher) handleEvent(logger lager.Logger, event models.Event) {
 					"index":        key.Index,
 				})
 
-				AppReadinessChanged := cc_messages.AppReadinessChangedRequest{
-					Instance: changedEvent.ActualLRPInstanceKey.InstanceGuid,
-					Index:    int(key.Index),
-					CellID:   changedEvent.ActualLRPInstanceKey.CellId,
-					Ready:    newValue,
+				details := cc_client.InstanceDetails{}
+				if known := watcher.lookupInstanceDetails(key); known != nil {
+					details = *known
+				}
+				if after.AvailabilityZone != "" {
+					details.AvailabilityZone = after.AvailabilityZone
+				}
+				if netInfo := copyNetInfo(after.ActualLRPNetInfo); netInfo != nil {
+					details.NetInfo = netInfo
+				}
+
+				AppReadinessChanged := cc_client.AppReadinessChangedRequest{
+					AppReadinessChangedRequest: cc_messages.AppReadinessChangedRequest{
+						Instance: changedEvent.ActualLRPInstanceKey.InstanceGuid,
+						Index:    int(key.Index),
+						CellID:   changedEvent.ActualLRPInstanceKey.CellId,
+						Ready:    newValue,
+					},
+					Since:           after.Since,
+					InstanceDetails: &details,
 				}
+				watcher.publish(logger, lifecycle.AppReadinessChanged, key.ProcessGuid, AppReadinessChanged)
 
-				watcher.pool.Submit(func() {
-					logger := logger.WithData(lager.Data{
-						"process-guid": key.ProcessGuid,
-						"index":        key.Index,
-					})
-					logger.Info("recording-app-readiness-changed")
-					err := watcher.ccClient.AppReadinessChanged(key.ProcessGuid, AppReadinessChanged, logger)
-					if err != nil {
-						logger.Error("failed-recording-app-readiness-changed", err)
-					}
+				watcher.notify(logger.WithData(lager.Data{
+					"process-guid": key.ProcessGuid,
+					"index":        key.Index,
+				}), "app-readiness-changed", func(logger lager.Logger) error {
+					return watcher.ccClient.AppReadinessChangedWithContext(ctx, key.ProcessGuid, AppReadinessChanged, logger)
 				})
 			}
 		}
 	}
 }
 
+func (watcher *Watcher) detectCrashLoop(ctx context.Context, logger lager.Logger, crashed *models.ActualLRPCrashedEvent, details *cc_client.InstanceDetails) {
+	if !watcher.crashLoops.enabled() {
+		return
+	}
+
+	key := crashed.ActualLRPKey
+	reason, timeline, looping := watcher.crashLoops.recordCrash(key, cc_client.CrashRecord{
+		Instance:        crashed.ActualLRPInstanceKey.InstanceGuid,
+		CellID:          crashed.ActualLRPInstanceKey.CellId,
+		ExitDescription: crashed.CrashReason,
+		CrashCount:      int(crashed.CrashCount),
+		CrashTimestamp:  crashed.Since,
+	})
+	if !looping {
+		return
+	}
+
+	logger.Info("app-crash-looping", lager.Data{
+		"process-guid": key.ProcessGuid,
+		"index":        key.Index,
+		"reason":       reason,
+		"crashes":      len(timeline),
+	})
+	metrics.IncrementCounter(crashLoopsDetectedCounter)
+
+	appCrashLooping := cc_client.AppCrashLoopingRequest{
+		Index:           int(key.Index),
+		Reason:          reason,
+		Crashes:         timeline,
+		InstanceDetails: details,
+	}
+	watcher.publish(logger, lifecycle.AppCrashLooping, key.ProcessGuid, appCrashLooping)
+
+	watcher.notify(logger.WithData(lager.Data{
+		"process-guid": key.ProcessGuid,
+		"index":        key.Index,
+	}), "app-crash-looping", func(logger lager.Logger) error {
+		return watcher.ccClient.AppCrashLoopingWithContext(ctx, key.ProcessGuid, appCrashLooping, logger)
+	})
+}
+
+// trackInstances records the availability zone, metric tags and network info
+// of ordinary app instances so that events which do not carry them, such as
+// crashes, can still report where the instance was running. State kept for an
+// instance index is dropped once its ordinary instance is removed.
+func (watcher *Watcher) trackInstances(event models.Event) {
+	switch event := event.(type) {
+	case *models.ActualLRPInstanceCreatedEvent:
+		lrp := event.ActualLrp
+		if lrp.Domain == cc_messages.AppLRPDomain && lrp.Presence == models.ActualLRP_Ordinary {
+			watcher.instanceDetails[lrp.ActualLRPKey] = newInstanceDetails(lrp)
+			watcher.stuckInstances.observe(lrp.ActualLRPKey, lrp.ActualLRPInstanceKey, lrp.State, lrp.Since, lrp.PlacementError)
+		}
+
+	case *models.ActualLRPInstanceChangedEvent:
+		after := event.After
+		if event.Domain != cc_messages.AppLRPDomain || after == nil || after.Presence != models.ActualLRP_Ordinary {
+			return
+		}
+
+		watcher.stuckInstances.observe(event.ActualLRPKey, event.ActualLRPInstanceKey, after.State, after.Since, after.PlacementError)
+
+		// Only claimed and running instances have a placement; keep the last
+		// known one otherwise so a subsequent crash can still report it.
+		if after.State != models.ActualLRPStateClaimed && after.State != models.ActualLRPStateRunning {
+			return
+		}
+
+		details := watcher.instanceDetails[event.ActualLRPKey]
+		details.AvailabilityZone = after.AvailabilityZone
+		details.NetInfo = copyNetInfo(after.ActualLRPNetInfo)
+		watcher.instanceDetails[event.ActualLRPKey] = details
+
+	case *models.ActualLRPInstanceRemovedEvent:
+		lrp := event.ActualLrp
+		if lrp.Presence == models.ActualLRP_Ordinary {
+			delete(watcher.instanceDetails, lrp.ActualLRPKey)
+			watcher.crashLoops.forget(lrp.ActualLRPKey)
+			watcher.stuckInstances.forget(lrp.ActualLRPKey)
+			watcher.evacuations.forget(lrp.ActualLRPKey)
+		}
+	}
+}
+
+// reportStuckInstances notifies CC about instances that have been waiting to
+// be placed or to start for longer than the configured threshold.
+func (watcher *Watcher) reportStuckInstances(ctx context.Context, logger lager.Logger) {
+	for _, stuck := range watcher.stuckInstances.stuck(watcher.clock.Now()) {
+		key := stuck.key
+		if watcher.desiredLRPs.superseded(key.ProcessGuid) || watcher.desiredLRPs.retiring(key) {
+			continue
+		}
+
+		// No event reports a stuck instance, so each report starts a trace.
+		span := tracing.NewSpan("")
+		logger := span.Logger(logger)
+		ctx := tracing.NewContext(ctx, span)
+
+		logger.Info("app-instance-failed-to-start", lager.Data{
+			"process-guid":    key.ProcessGuid,
+			"index":           key.Index,
+			"state":           stuck.state,
+			"since":           stuck.since,
+			"placement-error": stuck.placementError,
+		})
+		metrics.IncrementCounter(instancesFailedToStartCounter)
+
+		appFailedToStart := cc_client.AppInstanceFailedToStartRequest{
+			Instance:        stuck.instanceKey.InstanceGuid,
+			Index:           int(key.Index),
+			CellID:          stuck.instanceKey.CellId,
+			State:           stuck.state,
+			Since:           stuck.since,
+			PlacementError:  stuck.placementError,
+			Reason:          fmt.Sprintf("Instance has been %s for more than %s", stuck.state, watcher.stuckInstances.threshold),
+			InstanceDetails: watcher.lookupInstanceDetails(key),
+		}
+		watcher.publish(logger, lifecycle.AppInstanceFailedToStart, key.ProcessGuid, appFailedToStart)
+
+		watcher.notify(logger.WithData(lager.Data{
+			"process-guid": key.ProcessGuid,
+			"index":        key.Index,
+		}), "app-instance-failed-to-start", func(logger lager.Logger) error {
+			return watcher.ccClient.AppInstanceFailedToStartWithContext(ctx, key.ProcessGuid, appFailedToStart, logger)
+		})
+	}
+}
+
+// trackEvacuations follows evacuating app instances until a replacement is
+// running and ready on another cell, and then reports the completed move.
+func (watcher *Watcher) trackEvacuations(ctx context.Context, logger lager.Logger, event models.Event) {
+	now := watcher.clock.Now().UnixNano()
+
+	switch event := event.(type) {
+	case *models.ActualLRPInstanceCreatedEvent:
+		lrp := event.ActualLrp
+		if lrp.Domain == cc_messages.AppLRPDomain && lrp.Presence == models.ActualLRP_Evacuating {
+			watcher.evacuations.evacuating(lrp.ActualLRPKey, lrp.ActualLRPInstanceKey, now)
+		}
+
+	case *models.ActualLRPInstanceChangedEvent:
+		before, after := event.Before, event.After
+		if event.Domain != cc_messages.AppLRPDomain || after == nil {
+			return
+		}
+
+		switch after.Presence {
+		case models.ActualLRP_Evacuating:
+			watcher.evacuations.evacuating(event.ActualLRPKey, event.ActualLRPInstanceKey, now)
+
+		case models.ActualLRP_Ordinary:
+			if !instanceReady(after) || instanceReady(before) {
+				return
+			}
+			evacuated, downtime, ok := watcher.evacuations.replaced(event.ActualLRPKey, event.ActualLRPInstanceKey, now)
+			if ok {
+				watcher.reportRescheduled(ctx, logger, event.ActualLRPKey, event.ActualLRPInstanceKey, after.Since, evacuated, downtime)
+			}
+		}
+
+	case *models.ActualLRPInstanceRemovedEvent:
+		lrp := event.ActualLrp
+		if lrp.Domain == cc_messages.AppLRPDomain && lrp.Presence == models.ActualLRP_Evacuating {
+			watcher.evacuations.evacuated(lrp.ActualLRPKey, lrp.ActualLRPInstanceKey, now)
+		}
+	}
+}
+
+func (watcher *Watcher) reportRescheduled(ctx context.Context, logger lager.Logger, key models.ActualLRPKey, instanceKey models.ActualLRPInstanceKey, since int64, evacuated evacuation, downtime int64) {
+	logger.Info("app-rescheduled", lager.Data{
+		"process-guid": key.ProcessGuid,
+		"index":        key.Index,
+		"old-cell-id":  evacuated.instanceKey.CellId,
+		"new-cell-id":  instanceKey.CellId,
+		"downtime":     time.Duration(downtime).String(),
+	})
+	metrics.IncrementCounter(instancesRescheduledCounter)
+
+	appRescheduled := cc_client.AppRescheduledRequest{
+		Instance:        instanceKey.InstanceGuid,
+		Index:           int(key.Index),
+		CellID:          instanceKey.CellId,
+		OldInstance:     evacuated.instanceKey.InstanceGuid,
+		OldCellID:       evacuated.instanceKey.CellId,
+		DowntimeMillis:  int64(time.Duration(downtime) / time.Millisecond),
+		Since:           since,
+		InstanceDetails: watcher.lookupInstanceDetails(key),
+	}
+	watcher.publish(logger, lifecycle.AppRescheduled, key.ProcessGuid, appRescheduled)
+
+	if !watcher.config.NotifyAppRescheduled {
+		return
+	}
+	watcher.notify(logger.WithData(lager.Data{
+		"process-guid": key.ProcessGuid,
+		"index":        key.Index,
+	}), "app-rescheduled", func(logger lager.Logger) error {
+		return watcher.ccClient.AppRescheduledWithContext(ctx, key.ProcessGuid, appRescheduled, logger)
+	})
+}
+
+// seedInstances loads the current app instances from BBS, so that they and
+// the availability of their apps are known before their first instance event.
+func (watcher *Watcher) seedInstances(logger lager.Logger) {
+	lrps, err := watcher.bbsClient.ActualLRPs(logger, "", models.ActualLRPFilter{Domain: cc_messages.AppLRPDomain})
+	if err != nil {
+		logger.Error("failed-fetching-actual-lrps", err)
+		return
+	}
+	watcher.actualLRPs.seed(lrps)
+	watcher.appReadiness.seed(lrps)
+}
+
+// trackAppReadiness tallies the ready instances of each app against its
+// desired instance count and reports when the app as a whole becomes READY,
+// DEGRADED or UNAVAILABLE.
+func (watcher *Watcher) trackAppReadiness(ctx context.Context, logger lager.Logger, event models.Event) {
+	var (
+		key          models.ActualLRPKey
+		instanceGuid string
+		ready        bool
+	)
+
+	switch event := event.(type) {
+	case *models.ActualLRPInstanceCreatedEvent:
+		key, instanceGuid = event.ActualLrp.ActualLRPKey, event.ActualLrp.InstanceGuid
+		ready = instanceReady(event.ActualLrp.ToActualLRPInfo())
+	case *models.ActualLRPInstanceChangedEvent:
+		key, instanceGuid = event.ActualLRPKey, event.InstanceGuid
+		ready = instanceReady(event.After)
+	case *models.ActualLRPInstanceRemovedEvent:
+		key, instanceGuid = event.ActualLrp.ActualLRPKey, event.ActualLrp.InstanceGuid
+	default:
+		return
+	}
+	if key.Domain != cc_messages.AppLRPDomain || instanceGuid == "" {
+		return
+	}
+
+	desired, ok := watcher.desiredLRPs.get(key.ProcessGuid)
+	if !ok || desired.Instances == 0 {
+		watcher.appReadiness.set(key, instanceGuid, ready)
+		return
+	}
+
+	previous, current, readyInstances := watcher.appReadiness.update(key, instanceGuid, ready, desired.Instances)
+	if previous == current || watcher.desiredLRPs.superseded(key.ProcessGuid) {
+		return
+	}
+
+	appAvailabilityChanged := cc_client.AppAvailabilityChangedRequest{
+		State:            current,
+		PreviousState:    previous,
+		ReadyInstances:   readyInstances,
+		DesiredInstances: int(desired.Instances),
+		Since:            watcher.clock.Now().UnixNano(),
+	}
+
+	logger.Info("app-availability-changed", lager.Data{
+		"process-guid":      key.ProcessGuid,
+		"state":             current,
+		"previous-state":    previous,
+		"ready-instances":   readyInstances,
+		"desired-instances": desired.Instances,
+	})
+	metrics.IncrementCounter(appAvailabilityChangesCounter)
+	watcher.publish(logger, lifecycle.AppAvailabilityChanged, key.ProcessGuid, appAvailabilityChanged)
+
+	if !watcher.config.NotifyAppAvailabilityChanged {
+		return
+	}
+	watcher.notify(logger.WithData(lager.Data{"process-guid": key.ProcessGuid}), "app-availability-changed", func(logger lager.Logger) error {
+		return watcher.ccClient.AppAvailabilityChangedWithContext(ctx, key.ProcessGuid, appAvailabilityChanged, logger)
+	})
+}
+
+// detectLostInstance reports running app instances that are removed without
+// having crashed, been evacuated or been stopped by a scale-down.
+func (watcher *Watcher) detectLostInstance(ctx context.Context, logger lager.Logger, event models.Event) {
+	removed, ok := event.(*models.ActualLRPInstanceRemovedEvent)
+	if !ok {
+		return
+	}
+
+	lrp := removed.ActualLrp
+	if lrp.Domain != cc_messages.AppLRPDomain || lrp.State != models.ActualLRPStateRunning {
+		return
+	}
+
+	var reason string
+	switch lrp.Presence {
+	case models.ActualLRP_Suspect:
+		reason = InstanceLostReasonCellLost
+	case models.ActualLRP_Ordinary:
+		reason = InstanceLostReasonRemoved
+	default:
+		return
+	}
+
+	key := lrp.ActualLRPKey
+	details := newInstanceDetails(lrp)
+	appInstanceLost := cc_client.AppInstanceLostRequest{
+		Instance:        lrp.InstanceGuid,
+		Index:           int(key.Index),
+		CellID:          lrp.CellId,
+		State:           lrp.State,
+		Since:           lrp.Since,
+		Reason:          reason,
+		InstanceDetails: &details,
+	}
+
+	logger = logger.WithData(lager.Data{
+		"process-guid": key.ProcessGuid,
+		"index":        key.Index,
+	})
+
+	// An ordinary instance is also removed when its app is scaled down or
+	// stopped, which is only visible on the desired LRP.
+	if reason == InstanceLostReasonRemoved && !watcher.stillDesired(logger, key) {
+		return
+	}
+
+	logger.Info("app-instance-lost", lager.Data{
+		"cell-id": appInstanceLost.CellID,
+		"reason":  reason,
+	})
+	metrics.IncrementCounter(instancesLostCounter)
+	watcher.publish(logger, lifecycle.AppInstanceLost, key.ProcessGuid, appInstanceLost)
+
+	if !watcher.config.NotifyAppInstanceLost {
+		return
+	}
+	watcher.notify(logger, "app-instance-lost", func(logger lager.Logger) error {
+		return watcher.ccClient.AppInstanceLostWithContext(ctx, key.ProcessGuid, appInstanceLost, logger)
+	})
+}
+
+// notify sends a notification to CC from the work pool.
+func (watcher *Watcher) notify(logger lager.Logger, action string, send func(lager.Logger) error) {
+	watcher.pool.Submit(func() {
+		logger.Info("recording-" + action)
+		watcher.deliver(notification{logger: logger, action: action, send: send})
+	})
+}
+
+// deliver sends the notification. A notification that is refused because
+// the CC circuit breaker is open is spooled, so that it is sent again once
+// the breaker lets requests through.
+func (watcher *Watcher) deliver(n notification) {
+	err := n.send(n.logger)
+	switch {
+	case err == nil:
+	case errors.Is(err, cc_client.ErrCircuitOpen):
+		n.logger.Info("spooled-" + n.action)
+		watcher.spool.add(n)
+	default:
+		n.logger.Error("failed-recording-"+n.action, err)
+	}
+}
+
+// retrySpooled sends the spooled notifications again. While the breaker is
+// half-open, all but the probe are refused and spooled again.
+func (watcher *Watcher) retrySpooled(logger lager.Logger) {
+	notifications := watcher.spool.drain()
+	if len(notifications) == 0 {
+		return
+	}
+
+	logger.Info("retrying-spooled-notifications", lager.Data{"count": len(notifications)})
+	for _, n := range notifications {
+		watcher.pool.Submit(func() {
+			watcher.deliver(n)
+		})
+	}
+}
+
+// publish broadcasts an app lifecycle event to the subscribers of the event
+// stream.
+func (watcher *Watcher) publish(logger lager.Logger, eventType, processGuid string, data interface{}) {
+	err := watcher.lifecycleEvents.Publish(eventType, processGuid, data)
+	if err != nil {
+		logger.Error("failed-publishing-lifecycle-event", err, lager.Data{
+			"process-guid": processGuid,
+			"event-type":   eventType,
+		})
+	}
+}
+
+// eventTraceID returns the BBS trace id of the event, if it carries one.
+func eventTraceID(event models.Event) string {
+	if traced, ok := event.(interface{ GetTraceId() string }); ok {
+		return traced.GetTraceId()
+	}
+	return ""
+}
+
+// stillDesired returns whether the instance index is still part of its cached
+// desired LRP. The desired LRP of a stopped app is removed before its
+// instances, so an instance whose desired LRP is missing from the seeded cache
+// is not desired. Before the cache is seeded, instances are assumed to still
+// be desired, so that they are reported rather than silently dropped.
+func (watcher *Watcher) stillDesired(logger lager.Logger, key models.ActualLRPKey) bool {
+	schedulingInfo, ok := watcher.desiredLRPs.get(key.ProcessGuid)
+	if !ok {
+		if watcher.desiredLRPs.seeded() {
+			return false
+		}
+		logger.Info("desired-lrp-not-cached")
+		return true
+	}
+	return key.Index < schedulingInfo.Instances
+}
+
+// trackIncidents attributes app instance failures to the cell and the
+// availability zone they happened in so that a failing cell or zone is
+// reported once instead of as many unrelated instance failures.
+func (watcher *Watcher) trackIncidents(logger lager.Logger, event models.Event) {
+	now := watcher.clock.Now().UnixNano()
+
+	switch event := event.(type) {
+	case *models.ActualLRPCrashedEvent:
+		if event.Domain != cc_messages.AppLRPDomain {
+			return
+		}
+		crash := incident{at: now, kind: incidentCrash, processGuid: event.ProcessGuid}
+		watcher.recordCellIncident(logger, event.CellId, crash)
+		watcher.recordZoneIncident(logger, watcher.instanceDetails[event.ActualLRPKey].AvailabilityZone, crash)
+
+	case *models.ActualLRPInstanceRemovedEvent:
+		lrp := event.ActualLrp
+		if lrp.Domain == cc_messages.AppLRPDomain && lrp.Presence == models.ActualLRP_Suspect {
+			watcher.recordCellIncident(logger, lrp.CellId, incident{at: now, kind: incidentRemoval, processGuid: lrp.ProcessGuid})
+		}
+
+	case *models.ActualLRPInstanceChangedEvent:
+		before, after := event.Before, event.After
+		if event.Domain != cc_messages.AppLRPDomain || before == nil || after == nil {
+			return
+		}
+		if before.GetRoutable() && after.RoutableExists() && !after.GetRoutable() {
+			watcher.recordCellIncident(logger, event.CellId, incident{at: now, kind: incidentReadinessDrop, processGuid: event.ProcessGuid})
+		}
+		// BBS marks an instance suspect when it loses contact with its cell.
+		if before.Presence != models.ActualLRP_Suspect && after.Presence == models.ActualLRP_Suspect {
+			zone := after.AvailabilityZone
+			if zone == "" {
+				zone = before.AvailabilityZone
+			}
+			watcher.recordZoneIncident(logger, zone, incident{at: now, kind: incidentLoss, processGuid: event.ProcessGuid})
+		}
+	}
+}
+
+func (watcher *Watcher) recordCellIncident(logger lager.Logger, cellID string, i incident) {
+	summary, unhealthy := watcher.cellHealth.record(cellID, i)
+	if !unhealthy {
+		return
+	}
+
+	alert := CellUnhealthyAlert{
+		CellID:         cellID,
+		Crashes:        summary.crashes,
+		Removals:       summary.removals,
+		ReadinessDrops: summary.readinessDrops,
+		ProcessGuids:   summary.processGuids,
+		Window:         watcher.cellHealth.window.String(),
+	}
+
+	logger.Info("cell-unhealthy", lager.Data{
+		"cell-id":         alert.CellID,
+		"crashes":         alert.Crashes,
+		"removals":        alert.Removals,
+		"readiness-drops": alert.ReadinessDrops,
+		"process-guids":   alert.ProcessGuids,
+		"window":          alert.Window,
+	})
+	metrics.IncrementCounter(cellUnhealthyAlertsCounter)
+	taggedmetrics.SendValue(cellUnhealthyMetric, 1, "Metric", "cell_id", cellID)
+	watcher.publish(logger, lifecycle.CellUnhealthy, "", alert)
+}
+
+func (watcher *Watcher) reportRecoveredCells(logger lager.Logger) {
+	for _, cellID := range watcher.cellHealth.recovered(watcher.clock.Now()) {
+		logger.Info("cell-recovered", lager.Data{"cell-id": cellID})
+		taggedmetrics.SendValue(cellUnhealthyMetric, 0, "Metric", "cell_id", cellID)
+	}
+}
+
+func (watcher *Watcher) recordZoneIncident(logger lager.Logger, zone string, i incident) {
+	summary, degraded := watcher.zoneHealth.record(zone, i)
+	if !degraded {
+		return
+	}
+
+	alert := ZoneDegradedAlert{
+		AvailabilityZone: zone,
+		Crashes:          summary.crashes,
+		LostInstances:    summary.losses,
+		AffectedApps:     len(summary.processGuids),
+		ProcessGuids:     summary.processGuids,
+		Window:           watcher.zoneHealth.window.String(),
+	}
+
+	logger.Info("availability-zone-degraded", lager.Data{
+		"availability-zone": alert.AvailabilityZone,
+		"crashes":           alert.Crashes,
+		"lost-instances":    alert.LostInstances,
+		"affected-apps":     alert.AffectedApps,
+		"process-guids":     alert.ProcessGuids,
+		"window":            alert.Window,
+	})
+	metrics.IncrementCounter(zoneDegradedAlertsCounter)
+	taggedmetrics.SendValue(zoneDegradedMetric, 1, "Metric", "availability_zone", zone)
+	taggedmetrics.SendValue(zoneAffectedAppsMetric, float64(alert.AffectedApps), "Metric", "availability_zone", zone)
+	watcher.publish(logger, lifecycle.AvailabilityZoneDegraded, "", alert)
+}
+
+func (watcher *Watcher) reportRecoveredZones(logger lager.Logger) {
+	for _, zone := range watcher.zoneHealth.recovered(watcher.clock.Now()) {
+		logger.Info("availability-zone-recovered", lager.Data{"availability-zone": zone})
+		taggedmetrics.SendValue(zoneDegradedMetric, 0, "Metric", "availability_zone", zone)
+	}
+}
+
+// eventActualLRPKey returns the key of the actual LRP an event is about.
+func eventActualLRPKey(event models.Event) models.ActualLRPKey {
+	switch event := event.(type) {
+	case *models.ActualLRPCrashedEvent:
+		return event.ActualLRPKey
+	case *models.ActualLRPInstanceCreatedEvent:
+		return event.ActualLrp.ActualLRPKey
+	case *models.ActualLRPInstanceChangedEvent:
+		return event.ActualLRPKey
+	case *models.ActualLRPInstanceRemovedEvent:
+		return event.ActualLrp.ActualLRPKey
+	}
+	return models.ActualLRPKey{}
+}
+
+// instanceReady returns whether the instance is running and, when it reports
+// readiness, routable.
+func instanceReady(info *models.ActualLRPInfo) bool {
+	if info == nil || info.State != models.ActualLRPStateRunning {
+		return false
+	}
+	return !info.RoutableExists() || info.GetRoutable()
+}
+
+func (watcher *Watcher) lookupInstanceDetails(key models.ActualLRPKey) *cc_client.InstanceDetails {
+	details, ok := watcher.instanceDetails[key]
+	if !ok {
+		return nil
+	}
+	return &details
+}
+
+func newInstanceDetails(lrp *models.ActualLRP) cc_client.InstanceDetails {
+	return cc_client.InstanceDetails{
+		AvailabilityZone: lrp.AvailabilityZone,
+		MetricTags:       lrp.MetricTags,
+		NetInfo:          copyNetInfo(lrp.ActualLRPNetInfo),
+	}
+}
+
+func copyNetInfo(netInfo models.ActualLRPNetInfo) *models.ActualLRPNetInfo {
+	if netInfo.Address == "" && netInfo.InstanceAddress == "" && len(netInfo.Ports) == 0 {
+		return nil
+	}
+	return &netInfo
+}
+
 func calculateRoutableChange(beforeSet, afterSet, beforeValue, afterValue bool) (hasChanged, newValue bool) {
 	// If routable is not set for either the before or after do not emit an
 	// event.
@@ -239,7 +1047,7 @@ func calculateRoutableChange(beforeSet, afterSet, beforeValue, afterValue bool)
 	return false, false
 }
 
-func subscribeToEvents(logger lager.Logger, bbsClient bbs.Client, subscriptionChan chan<- events.EventSource) {
+func subscribeToEvents(logger lager.Logger, bbsClient BBSClient, subscriptionChan chan<- events.EventSource) {
 	logger.Info("subscribing-to-events")
 	eventSource, err := bbsClient.SubscribeToInstanceEvents(logger)
 	if err != nil {
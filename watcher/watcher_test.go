@@ -1,8 +1,12 @@
 package watcher_test
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -11,11 +15,19 @@ import (
 	"code.cloudfoundry.org/bbs/fake_bbs"
 	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/bbs/models/test/model_helpers"
+	"code.cloudfoundry.org/clock/fakeclock"
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/lager/v3/lagertest"
 	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	"code.cloudfoundry.org/tps/cc_client"
 	"code.cloudfoundry.org/tps/cc_client/fakes"
+	"code.cloudfoundry.org/tps/lifecycle"
+	"code.cloudfoundry.org/tps/tracing"
 	"code.cloudfoundry.org/tps/watcher"
+	"github.com/cloudfoundry/dropsonde/emitter/fake"
+	"github.com/cloudfoundry/dropsonde/metric_sender"
+	"github.com/cloudfoundry/dropsonde/metrics"
+	sonde_events "github.com/cloudfoundry/sonde-go/events"
 	"github.com/tedsuo/ifrit"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -33,12 +45,17 @@ var nilEventHolder = EventHolder{}
 var _ = Describe("Watcher", func() {
 	var (
 		eventSource   *eventfakes.FakeEventSource
+		desiredSource *eventfakes.FakeEventSource
+		desiredQueue  *blockingEventQueue
 		bbsClient     *fake_bbs.FakeInternalClient
 		ccClient      *fakes.FakeCcClient
 		watcherRunner *watcher.Watcher
 		process       ifrit.Process
 
-		logger *lagertest.TestLogger
+		logger        *lagertest.TestLogger
+		fakeClock     *fakeclock.FakeClock
+		watcherConfig watcher.Config
+		fakeEmitter   *fake.FakeEventEmitter
 
 		nextErr   atomic.Value
 		nextEvent atomic.Value
@@ -49,106 +66,1749 @@ var _ = Describe("Watcher", func() {
 		bbsClient = new(fake_bbs.FakeInternalClient)
 		bbsClient.SubscribeToInstanceEventsReturns(eventSource, nil)
 
+		desiredSource = new(eventfakes.FakeEventSource)
+		desiredQueue = newBlockingEventQueue()
+		desiredSource.NextStub = desiredQueue.next
+		desiredSource.CloseStub = desiredQueue.close
+		bbsClient.SubscribeToEventsReturns(desiredSource, nil)
+
 		logger = lagertest.NewTestLogger("test")
 		ccClient = new(fakes.FakeCcClient)
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		watcherConfig = watcher.Config{}
+
+		fakeEmitter = fake.NewFakeEventEmitter("tps-watcher")
+		metrics.Initialize(metric_sender.NewMetricSender(fakeEmitter), nil)
+
+		nextErr = atomic.Value{}
+		nextErr := nextErr
+		nextEvent.Store(nilEventHolder)
+
+		eventSource.CloseStub = func() error {
+			nextErr.Store(errors.New("closed"))
+			return nil
+		}
+
+		eventSource.NextStub = func() (models.Event, error) {
+			time.Sleep(10 * time.Millisecond)
+			if eventHolder := nextEvent.Load(); eventHolder != nilEventHolder {
+				nextEvent.Store(nilEventHolder)
+
+				eh := eventHolder.(EventHolder)
+				if eh.event != nil {
+					return eh.event, nil
+				}
+			}
+
+			if err := nextErr.Load(); err != nil {
+				return nil, err.(error)
+			}
+
+			return nil, nil
+		}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		watcherRunner, err = watcher.NewWatcher(logger, fakeClock, 500, 10*time.Millisecond, bbsClient, ccClient, watcherConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		process = ifrit.Invoke(watcherRunner)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+	})
+
+	// expectCanceledOnStop stops the watcher and expects the CC request that
+	// handed over its context to be canceled.
+	expectCanceledOnStop := func(contexts chan context.Context) {
+		var ctx context.Context
+		Eventually(contexts).Should(Receive(&ctx))
+		Expect(ctx.Err()).NotTo(HaveOccurred())
+
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+		Eventually(ctx.Done()).Should(BeClosed())
+	}
+
+	Describe("Desired LRP cache", func() {
+		desiredLRP := func(processGuid string, instances int32) *models.DesiredLRP {
+			lrp := model_helpers.NewValidDesiredLRP(processGuid)
+			lrp.Domain = cc_messages.AppLRPDomain
+			lrp.Instances = instances
+			return lrp
+		}
+
+		BeforeEach(func() {
+			seeded := desiredLRP("seeded-guid", 2).DesiredLRPSchedulingInfo()
+			bbsClient.DesiredLRPSchedulingInfosReturns([]*models.DesiredLRPSchedulingInfo{&seeded}, nil)
+		})
+
+		instancesOf := func(processGuid string) func() int32 {
+			return func() int32 {
+				info, ok := watcherRunner.DesiredLRP(processGuid)
+				if !ok {
+					return -1
+				}
+				return info.Instances
+			}
+		}
+
+		It("is seeded with the app's desired LRPs after subscribing", func() {
+			Eventually(instancesOf("seeded-guid")).Should(BeEquivalentTo(2))
+
+			Expect(bbsClient.SubscribeToEventsCallCount()).To(Equal(1))
+			_, _, filter := bbsClient.DesiredLRPSchedulingInfosArgsForCall(0)
+			Expect(filter.Domain).To(Equal(cc_messages.AppLRPDomain))
+		})
+
+		It("is kept up to date from desired LRP events", func() {
+			Eventually(instancesOf("seeded-guid")).Should(BeEquivalentTo(2))
+
+			desiredQueue.push(models.NewDesiredLRPCreatedEvent(desiredLRP("new-guid", 1), "trace-id"))
+			Eventually(instancesOf("new-guid")).Should(BeEquivalentTo(1))
+
+			desiredQueue.push(models.NewDesiredLRPChangedEvent(desiredLRP("seeded-guid", 2), desiredLRP("seeded-guid", 5), "trace-id"))
+			Eventually(instancesOf("seeded-guid")).Should(BeEquivalentTo(5))
+
+			desiredQueue.push(models.NewDesiredLRPRemovedEvent(desiredLRP("new-guid", 1), "trace-id"))
+			Eventually(instancesOf("new-guid")).Should(BeEquivalentTo(-1))
+		})
+
+		It("ignores desired LRPs outside of the app domain", func() {
+			task := desiredLRP("other-guid", 1)
+			task.Domain = "other-domain"
+			desiredQueue.push(models.NewDesiredLRPCreatedEvent(task, "trace-id"))
+
+			Consistently(instancesOf("other-guid")).Should(BeEquivalentTo(-1))
+		})
+
+		Context("when the event stream fails", func() {
+			It("re-subscribes and re-seeds the cache", func() {
+				Eventually(instancesOf("seeded-guid")).Should(BeEquivalentTo(2))
+
+				reseeded := desiredLRP("reseeded-guid", 3).DesiredLRPSchedulingInfo()
+				bbsClient.DesiredLRPSchedulingInfosReturns([]*models.DesiredLRPSchedulingInfo{&reseeded}, nil)
+				desiredQueue.close()
+				Consistently(bbsClient.SubscribeToEventsCallCount).Should(Equal(1))
+
+				fakeClock.WaitForWatcherAndIncrement(10 * time.Millisecond)
+				Eventually(instancesOf("reseeded-guid")).Should(BeEquivalentTo(3))
+				Expect(instancesOf("seeded-guid")()).To(BeEquivalentTo(-1))
+				Expect(bbsClient.SubscribeToEventsCallCount()).To(BeNumerically(">", 1))
+			})
+		})
+
+		Context("when seeding the cache fails", func() {
+			BeforeEach(func() {
+				bbsClient.DesiredLRPSchedulingInfosReturnsOnCall(0, nil, models.ErrUnknownError)
+			})
+
+			It("closes the subscription and retries after the retry interval", func() {
+				Eventually(desiredSource.CloseCallCount).Should(Equal(1))
+				Consistently(bbsClient.DesiredLRPSchedulingInfosCallCount).Should(Equal(1))
+
+				fakeClock.WaitForWatcherAndIncrement(10 * time.Millisecond)
+				Eventually(instancesOf("seeded-guid")).Should(BeEquivalentTo(2))
+				Expect(logger).To(Say("failed-fetching-desired-lrps"))
+				Expect(desiredSource.CloseCallCount()).To(BeNumerically(">=", 1))
+			})
+		})
+	})
+
+	Describe("Superseded app versions", func() {
+		const (
+			appGuid    = "11111111-1111-1111-1111-111111111111"
+			oldVersion = "22222222-2222-2222-2222-222222222222"
+			newVersion = "33333333-3333-3333-3333-333333333333"
+		)
+
+		var (
+			oldProcessGuid = appGuid + "-" + oldVersion
+			newProcessGuid = appGuid + "-" + newVersion
+			queue          *eventQueue
+		)
+
+		desiredLRP := func(processGuid string) *models.DesiredLRP {
+			lrp := model_helpers.NewValidDesiredLRP(processGuid)
+			lrp.Domain = cc_messages.AppLRPDomain
+			return lrp
+		}
+
+		crashOf := func(processGuid string) models.Event {
+			lrp := makeCrashingActualLRP(processGuid, "instance-guid", 0, 0, 1, cc_messages.AppLRPDomain, "exited")
+			return models.NewActualLRPCrashedEvent(lrp, lrp)
+		}
+
+		BeforeEach(func() {
+			seeded := desiredLRP(oldProcessGuid).DesiredLRPSchedulingInfo()
+			bbsClient.DesiredLRPSchedulingInfosReturns([]*models.DesiredLRPSchedulingInfo{&seeded}, nil)
+		})
+
+		JustBeforeEach(func() {
+			queue = streamEvents(eventSource)
+			Eventually(func() bool {
+				_, ok := watcherRunner.DesiredLRP(oldProcessGuid)
+				return ok
+			}).Should(BeTrue())
+		})
+
+		It("reports crashes of the current version", func() {
+			queue.push(crashOf(oldProcessGuid))
+			Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+		})
+
+		Context("when a new version of the app is desired", func() {
+			JustBeforeEach(func() {
+				desiredQueue.push(models.NewDesiredLRPCreatedEvent(desiredLRP(newProcessGuid), "trace-id"))
+				Eventually(func() bool {
+					_, ok := watcherRunner.DesiredLRP(newProcessGuid)
+					return ok
+				}).Should(BeTrue())
+			})
+
+			It("ignores crashes of the old version", func() {
+				queue.push(crashOf(oldProcessGuid), crashOf(newProcessGuid))
+
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+				Consistently(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+				_, guid, _, _ := ccClient.AppCrashedWithContextArgsForCall(0)
+				Expect(guid).To(Equal(newProcessGuid))
+
+				Expect(counterTotal(fakeEmitter, "AppSupersededVersionEventsIgnored")).To(BeEquivalentTo(1))
+			})
+
+			It("ignores readiness changes of the old version", func() {
+				before := model_helpers.NewValidActualLRP(oldProcessGuid, 0)
+				before.Domain = cc_messages.AppLRPDomain
+				before.SetRoutable(true)
+				after := *before
+				after.SetRoutable(false)
+				queue.push(models.NewActualLRPInstanceChangedEvent(before, &after, "trace-id"))
+
+				Eventually(func() uint64 { return counterTotal(fakeEmitter, "AppSupersededVersionEventsIgnored") }).Should(BeEquivalentTo(1))
+				Expect(ccClient.AppReadinessChangedWithContextCallCount()).To(Equal(0))
+			})
+
+			Context("and the new version is removed again", func() {
+				It("reports crashes of the old version", func() {
+					desiredQueue.push(models.NewDesiredLRPRemovedEvent(desiredLRP(newProcessGuid), "trace-id"))
+					Eventually(func() bool {
+						_, ok := watcherRunner.DesiredLRP(newProcessGuid)
+						return ok
+					}).Should(BeFalse())
+
+					queue.push(crashOf(oldProcessGuid))
+					Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+				})
+			})
+		})
+
+		Context("when several versions of an app are desired when the cache is seeded", func() {
+			BeforeEach(func() {
+				oldInfo := desiredLRP(oldProcessGuid).DesiredLRPSchedulingInfo()
+				newInfo := desiredLRP(newProcessGuid).DesiredLRPSchedulingInfo()
+				bbsClient.DesiredLRPSchedulingInfosReturns([]*models.DesiredLRPSchedulingInfo{&oldInfo, &newInfo}, nil)
+			})
+
+			It("does not treat either version as superseded", func() {
+				queue.push(crashOf(oldProcessGuid), crashOf(newProcessGuid))
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(2))
+			})
+		})
+	})
+
+	Describe("Scale-down and stop", func() {
+		var queue *eventQueue
+
+		desiredLRP := func(instances int32) *models.DesiredLRP {
+			lrp := model_helpers.NewValidDesiredLRP("process-guid")
+			lrp.Domain = cc_messages.AppLRPDomain
+			lrp.Instances = instances
+			return lrp
+		}
+
+		crashOf := func(index int32) models.Event {
+			lrp := makeCrashingActualLRP("process-guid", "instance-guid", index, 0, 1, cc_messages.AppLRPDomain, "exited")
+			return models.NewActualLRPCrashedEvent(lrp, lrp)
+		}
+
+		waitForInstances := func(instances int32) {
+			Eventually(func() int32 {
+				info, _ := watcherRunner.DesiredLRP("process-guid")
+				return info.Instances
+			}).Should(Equal(instances))
+		}
+
+		BeforeEach(func() {
+			watcherConfig.ScaleDownGracePeriod = time.Minute
+
+			seeded := desiredLRP(3).DesiredLRPSchedulingInfo()
+			bbsClient.DesiredLRPSchedulingInfosReturns([]*models.DesiredLRPSchedulingInfo{&seeded}, nil)
+		})
+
+		JustBeforeEach(func() {
+			queue = streamEvents(eventSource)
+			waitForInstances(3)
+		})
+
+		Context("when the app is scaled down", func() {
+			JustBeforeEach(func() {
+				desiredQueue.push(models.NewDesiredLRPChangedEvent(desiredLRP(3), desiredLRP(1), "trace-id"))
+				waitForInstances(1)
+			})
+
+			It("treats failures of the removed instances as expected", func() {
+				queue.push(crashOf(2), crashOf(0))
+
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+				Consistently(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+				_, _, request, _ := ccClient.AppCrashedWithContextArgsForCall(0)
+				Expect(request.Index).To(Equal(0))
+
+				Expect(logger).To(Say("ignoring-event-for-retiring-instance"))
+				Expect(counterTotal(fakeEmitter, "AppRetiringInstanceEventsIgnored")).To(BeEquivalentTo(1))
+			})
+
+			It("reports failures again after the grace period", func() {
+				fakeClock.Increment(2 * time.Minute)
+				queue.push(crashOf(2))
+
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+			})
+
+			Context("and scaled up again", func() {
+				It("reports failures of the instances that are desired again", func() {
+					desiredQueue.push(models.NewDesiredLRPChangedEvent(desiredLRP(1), desiredLRP(2), "trace-id"))
+					waitForInstances(2)
+
+					queue.push(crashOf(1), crashOf(2))
+					Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+					Consistently(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+					_, _, request, _ := ccClient.AppCrashedWithContextArgsForCall(0)
+					Expect(request.Index).To(Equal(1))
+				})
+			})
+		})
+
+		Context("when the app is stopped", func() {
+			JustBeforeEach(func() {
+				desiredQueue.push(models.NewDesiredLRPRemovedEvent(desiredLRP(3), "trace-id"))
+				waitForInstances(0)
+			})
+
+			It("treats failures of all its instances as expected", func() {
+				before := model_helpers.NewValidActualLRP("process-guid", 0)
+				before.Domain = cc_messages.AppLRPDomain
+				before.SetRoutable(true)
+				after := *before
+				after.SetRoutable(false)
+
+				queue.push(crashOf(0), models.NewActualLRPInstanceChangedEvent(before, &after, "trace-id"))
+
+				Eventually(func() uint64 { return counterTotal(fakeEmitter, "AppRetiringInstanceEventsIgnored") }).Should(BeEquivalentTo(2))
+				Expect(ccClient.AppCrashedWithContextCallCount()).To(Equal(0))
+				Expect(ccClient.AppReadinessChangedWithContextCallCount()).To(Equal(0))
+			})
+
+			Context("and started again", func() {
+				It("reports failures of its instances", func() {
+					desiredQueue.push(models.NewDesiredLRPCreatedEvent(desiredLRP(3), "trace-id"))
+					waitForInstances(3)
+
+					queue.push(crashOf(0))
+					Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+				})
+			})
+		})
+
+		Context("when the grace period is disabled", func() {
+			BeforeEach(func() {
+				watcherConfig.ScaleDownGracePeriod = 0
+			})
+
+			It("reports failures of the removed instances", func() {
+				desiredQueue.push(models.NewDesiredLRPChangedEvent(desiredLRP(3), desiredLRP(1), "trace-id"))
+				waitForInstances(1)
+
+				queue.push(crashOf(2))
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+			})
+		})
+	})
+
+	Describe("App availability", func() {
+		var (
+			instances []*models.ActualLRP
+			queue     *blockingEventQueue
+		)
+
+		instance := func(index int32, ready bool) *models.ActualLRP {
+			lrp := model_helpers.NewValidActualLRP("process-guid", index)
+			lrp.Domain = cc_messages.AppLRPDomain
+			lrp.InstanceGuid = fmt.Sprintf("instance-guid-%d", index)
+			lrp.SetRoutable(ready)
+			return lrp
+		}
+
+		readinessChange := func(lrp *models.ActualLRP, ready bool) models.Event {
+			after := *lrp
+			after.SetRoutable(ready)
+			return models.NewActualLRPInstanceChangedEvent(lrp, &after, "trace-id")
+		}
+
+		BeforeEach(func() {
+			desired := model_helpers.NewValidDesiredLRP("process-guid")
+			desired.Domain = cc_messages.AppLRPDomain
+			desired.Instances = 3
+			info := desired.DesiredLRPSchedulingInfo()
+			bbsClient.DesiredLRPSchedulingInfosReturns([]*models.DesiredLRPSchedulingInfo{&info}, nil)
+
+			instances = []*models.ActualLRP{instance(0, true), instance(1, true), instance(2, true)}
+			bbsClient.ActualLRPsReturns(instances, nil)
+
+			// Block instead of returning empty events, which would make the
+			// watcher re-subscribe and re-seed the instances.
+			queue = newBlockingEventQueue()
+			eventSource.NextStub = queue.next
+			eventSource.CloseStub = queue.close
+
+			watcherConfig.NotifyAppAvailabilityChanged = true
+		})
+
+		JustBeforeEach(func() {
+			Eventually(logger).Should(Say("synced-desired-lrps"))
+		})
+
+		It("seeds the ready instances of apps from BBS", func() {
+			Eventually(bbsClient.ActualLRPsCallCount).Should(Equal(1))
+			_, _, filter := bbsClient.ActualLRPsArgsForCall(0)
+			Expect(filter.Domain).To(Equal(cc_messages.AppLRPDomain))
+		})
+
+		It("reports when the app becomes degraded and then unavailable", func() {
+			queue.push(readinessChange(instances[0], false))
+
+			Eventually(ccClient.AppAvailabilityChangedWithContextCallCount).Should(Equal(1))
+			_, guid, request, _ := ccClient.AppAvailabilityChangedWithContextArgsForCall(0)
+			Expect(guid).To(Equal("process-guid"))
+			Expect(request).To(Equal(cc_client.AppAvailabilityChangedRequest{
+				State:            cc_client.AppAvailabilityDegraded,
+				PreviousState:    cc_client.AppAvailabilityReady,
+				ReadyInstances:   2,
+				DesiredInstances: 3,
+				Since:            fakeClock.Now().UnixNano(),
+			}))
+
+			queue.push(readinessChange(instances[1], false))
+			Consistently(ccClient.AppAvailabilityChangedWithContextCallCount).Should(Equal(1))
+
+			queue.push(models.NewActualLRPInstanceRemovedEvent(instances[2], "trace-id"))
+			Eventually(ccClient.AppAvailabilityChangedWithContextCallCount).Should(Equal(2))
+			_, _, request, _ = ccClient.AppAvailabilityChangedWithContextArgsForCall(1)
+			Expect(request.State).To(Equal(cc_client.AppAvailabilityUnavailable))
+			Expect(request.PreviousState).To(Equal(cc_client.AppAvailabilityDegraded))
+			Expect(request.ReadyInstances).To(Equal(0))
+
+			Expect(logger).To(Say("app-availability-changed"))
+			Expect(counterTotal(fakeEmitter, "AppAvailabilityChanges")).To(BeEquivalentTo(2))
+		})
+
+		It("cancels the request when the watcher stops", func() {
+			contexts := make(chan context.Context, 1)
+			ccClient.AppAvailabilityChangedWithContextCalls(blockUntilCanceled[cc_client.AppAvailabilityChangedRequest](contexts))
+
+			queue.push(readinessChange(instances[0], false))
+			expectCanceledOnStop(contexts)
+		})
+
+		Context("when notifying CC is disabled", func() {
+			BeforeEach(func() {
+				watcherConfig.NotifyAppAvailabilityChanged = false
+			})
+
+			It("only logs the availability change", func() {
+				queue.push(readinessChange(instances[0], false))
+
+				Eventually(logger).Should(Say("app-availability-changed"))
+				Expect(counterTotal(fakeEmitter, "AppAvailabilityChanges")).To(BeEquivalentTo(1))
+				Consistently(ccClient.AppAvailabilityChangedWithContextCallCount).Should(Equal(0))
+			})
+		})
+
+		Context("when the app recovers", func() {
+			BeforeEach(func() {
+				instances[1].SetRoutable(false)
+				bbsClient.ActualLRPsReturns(instances, nil)
+			})
+
+			It("reports when all desired instances are ready again", func() {
+				unready := *instances[1]
+				queue.push(readinessChange(&unready, true))
+
+				Eventually(ccClient.AppAvailabilityChangedWithContextCallCount).Should(Equal(1))
+				_, _, request, _ := ccClient.AppAvailabilityChangedWithContextArgsForCall(0)
+				Expect(request.State).To(Equal(cc_client.AppAvailabilityReady))
+				Expect(request.PreviousState).To(Equal(cc_client.AppAvailabilityDegraded))
+				Expect(request.ReadyInstances).To(Equal(3))
+			})
+		})
+
+		Context("when the desired instance count of the app is not known", func() {
+			BeforeEach(func() {
+				bbsClient.DesiredLRPSchedulingInfosReturns(nil, nil)
+			})
+
+			It("does not report its availability", func() {
+				queue.push(readinessChange(instances[0], false))
+
+				Eventually(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(1))
+				Consistently(ccClient.AppAvailabilityChangedWithContextCallCount).Should(Equal(0))
+			})
+		})
+	})
+
+	Describe("Actual LRP mirror", func() {
+		var (
+			instances []*models.ActualLRP
+			queue     *blockingEventQueue
+		)
+
+		BeforeEach(func() {
+			instances = []*models.ActualLRP{
+				model_helpers.NewValidActualLRP("process-guid", 1),
+				model_helpers.NewValidActualLRP("process-guid", 0),
+				model_helpers.NewValidActualLRP("other-guid", 0),
+			}
+			for _, lrp := range instances {
+				lrp.Domain = cc_messages.AppLRPDomain
+			}
+			bbsClient.ActualLRPsReturns(instances, nil)
+
+			queue = newBlockingEventQueue()
+			eventSource.NextStub = queue.next
+			eventSource.CloseStub = queue.close
+		})
+
+		JustBeforeEach(func() {
+			Eventually(bbsClient.ActualLRPsCallCount).Should(Equal(1))
+		})
+
+		It("seeds the instances of every app ordered by index", func() {
+			Eventually(func() []*models.ActualLRP {
+				return watcherRunner.ActualLRPs("process-guid")
+			}).Should(Equal([]*models.ActualLRP{instances[1], instances[0]}))
+			Expect(watcherRunner.ActualLRPs("unknown-guid")).To(BeEmpty())
+		})
+
+		It("keeps the instances up to date from instance events", func() {
+			created := model_helpers.NewValidActualLRP("process-guid", 2)
+			created.Domain = cc_messages.AppLRPDomain
+			queue.push(models.NewActualLRPInstanceCreatedEvent(created, "trace-id"))
+			Eventually(func() []*models.ActualLRP {
+				return watcherRunner.ActualLRPs("process-guid")
+			}).Should(HaveLen(3))
+
+			after := *instances[1]
+			after.State = models.ActualLRPStateCrashed
+			after.CrashReason = "exited"
+			queue.push(models.NewActualLRPInstanceChangedEvent(instances[1], &after, "trace-id"))
+			Eventually(func() string {
+				return watcherRunner.ActualLRPs("process-guid")[0].CrashReason
+			}).Should(Equal("exited"))
+			Expect(watcherRunner.ActualLRPs("process-guid")[0]).To(Equal(&after))
+
+			queue.push(models.NewActualLRPInstanceRemovedEvent(instances[2], "trace-id"))
+			Eventually(func() []*models.ActualLRP {
+				return watcherRunner.ActualLRPs("other-guid")
+			}).Should(BeEmpty())
+		})
+
+		It("tracks evacuating instances alongside their replacements", func() {
+			evacuating := *instances[0]
+			evacuating.Presence = models.ActualLRP_Evacuating
+			queue.push(models.NewActualLRPInstanceCreatedEvent(&evacuating, "trace-id"))
+
+			Eventually(func() []*models.ActualLRP {
+				return watcherRunner.ActualLRPs("process-guid")
+			}).Should(Equal([]*models.ActualLRP{instances[1], instances[0], &evacuating}))
+		})
+	})
+
+	Describe("Actual LRP crashes", func() {
+		var actual *models.ActualLRP
+
+		BeforeEach(func() {
+			actual = makeCrashingActualLRP("process-guid", "instance-guid", 1, 3, 1, cc_messages.AppLRPDomain, "out of memory")
+		})
+
+		JustBeforeEach(func() {
+			nextEvent.Store(EventHolder{models.NewActualLRPCrashedEvent(actual, actual)})
+		})
+
+		Context("and the application has the cc-app Domain", func() {
+			It("calls AppCrashed", func() {
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+				_, guid, crashed, _ := ccClient.AppCrashedWithContextArgsForCall(0)
+				Expect(guid).To(Equal("process-guid"))
+				Expect(crashed.AppCrashedRequest).To(Equal(cc_messages.AppCrashedRequest{
+					Instance:        "instance-guid",
+					Index:           1,
+					CellID:          "some-cell",
+					Reason:          "CRASHED",
+					ExitDescription: "out of memory",
+					CrashCount:      1,
+					CrashTimestamp:  3,
+				}))
+
+				Expect(logger).To(Say("app-crashed"))
+			})
+
+			It("does not include instance details it has not seen", func() {
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+				_, _, crashed, _ := ccClient.AppCrashedWithContextArgsForCall(0)
+				Expect(crashed.InstanceDetails).To(BeNil())
+			})
+
+			It("records the crash in a trace of its own", func() {
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+				ctx, _, _, _ := ccClient.AppCrashedWithContextArgsForCall(0)
+				span, ok := tracing.FromContext(ctx)
+				Expect(ok).To(BeTrue())
+				Expect(span.TraceID).To(MatchRegexp("^[0-9a-f]{32}$"))
+
+				Expect(logger).To(Say(`"trace-id":"` + span.TraceID + `"`))
+			})
+
+			Context("when the watcher stops while the crash is being recorded", func() {
+				var contexts chan context.Context
+
+				BeforeEach(func() {
+					contexts = make(chan context.Context, 1)
+					ccClient.AppCrashedWithContextStub = func(ctx context.Context, _ string, _ cc_client.AppCrashedRequest, _ lager.Logger) error {
+						contexts <- ctx
+						<-ctx.Done()
+						return ctx.Err()
+					}
+				})
+
+				It("cancels the request", func() {
+					var ctx context.Context
+					Eventually(contexts).Should(Receive(&ctx))
+					Expect(ctx.Err()).NotTo(HaveOccurred())
+
+					process.Signal(os.Interrupt)
+					Eventually(process.Wait()).Should(Receive())
+					Eventually(ctx.Done()).Should(BeClosed())
+				})
+			})
+
+			Context("when the CC circuit breaker is open", func() {
+				var refusals int32
+
+				BeforeEach(func() {
+					refusals = 2
+					ccClient.AppCrashedWithContextStub = func(context.Context, string, cc_client.AppCrashedRequest, lager.Logger) error {
+						if atomic.AddInt32(&refusals, -1) >= 0 {
+							return cc_client.ErrCircuitOpen
+						}
+						return nil
+					}
+				})
+
+				It("spools the crash and records it once the breaker lets it through", func() {
+					Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+					Eventually(logger).Should(Say("spooled-app-crashed"))
+
+					fakeClock.WaitForWatcherAndIncrement(5 * time.Second)
+					Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(2))
+					Eventually(logger).Should(Say("spooled-app-crashed"))
+
+					fakeClock.WaitForWatcherAndIncrement(5 * time.Second)
+					Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(3))
+					_, guid, crashed, _ := ccClient.AppCrashedWithContextArgsForCall(2)
+					Expect(guid).To(Equal("process-guid"))
+					Expect(crashed.Index).To(Equal(1))
+
+					fakeClock.Increment(5 * time.Second)
+					Consistently(ccClient.AppCrashedWithContextCallCount).Should(Equal(3))
+					Expect(logger).NotTo(Say("failed-recording-app-crashed"))
+				})
+			})
+
+			Context("when lifecycle events are buffered", func() {
+				BeforeEach(func() {
+					watcherConfig.LifecycleEventBufferSize = 10
+				})
+
+				It("publishes a lifecycle event with the crash", func() {
+					Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+					_, _, crashed, _ := ccClient.AppCrashedWithContextArgsForCall(0)
+
+					subscription, replay := watcherRunner.LifecycleEvents().Subscribe(0, lifecycle.Filter{ProcessGuids: []string{"process-guid"}})
+					defer subscription.Close()
+					Expect(replay).To(HaveLen(1))
+					Expect(replay[0].Type).To(Equal(lifecycle.AppCrashed))
+					Expect(replay[0].ProcessGuid).To(Equal("process-guid"))
+
+					expected, err := json.Marshal(crashed)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(replay[0].Data).To(MatchJSON(expected))
+				})
+			})
+		})
+
+		Context("when the instance was created before it crashed", func() {
+			BeforeEach(func() {
+				created := makeCrashingActualLRP("process-guid", "instance-guid", 1, 3, 1, cc_messages.AppLRPDomain, "out of memory")
+				created.AvailabilityZone = "z1"
+				created.MetricTags = map[string]string{"app_name": "dora"}
+
+				events := []EventHolder{
+					{models.NewActualLRPInstanceCreatedEvent(created, "trace-id")},
+					{models.NewActualLRPCrashedEvent(actual, actual)},
+				}
+
+				eventSource.NextStub = func() (models.Event, error) {
+					var e EventHolder
+					time.Sleep(10 * time.Millisecond)
+					if len(events) == 0 {
+						return nil, nil
+					}
+					e, events = events[0], events[1:]
+					return e.event, nil
+				}
+			})
+
+			It("includes the last known instance details", func() {
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+				_, _, crashed, _ := ccClient.AppCrashedWithContextArgsForCall(0)
+				Expect(crashed.InstanceDetails).NotTo(BeNil())
+				Expect(crashed.AvailabilityZone).To(Equal("z1"))
+				Expect(crashed.MetricTags).To(Equal(map[string]string{"app_name": "dora"}))
+				Expect(crashed.NetInfo).To(Equal(&actual.ActualLRPNetInfo))
+			})
+		})
+
+		Context("and the application does not have the cc-app Domain", func() {
+			var otherActual *models.ActualLRP
+
+			BeforeEach(func() {
+				otherActual = makeCrashingActualLRP("other-process-guid", "instance-guid", 1, 3, 1, "", "")
+
+				event := EventHolder{models.NewActualLRPCrashedEvent(actual, actual)}
+				otherEvent := EventHolder{models.NewActualLRPCrashedEvent(otherActual, otherActual)}
+				events := []EventHolder{otherEvent, event}
+
+				eventSource.NextStub = func() (models.Event, error) {
+					var e EventHolder
+					time.Sleep(10 * time.Millisecond)
+					if len(events) == 0 {
+						return nil, nil
+					}
+					e, events = events[0], events[1:]
+					return e.event, nil
+				}
+			})
+
+			It("does not call AppCrashed", func() {
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(1))
+				buffer := logger.Buffer()
+				Expect(buffer).To(Say("process-guid"))
+				Expect(buffer).NotTo(Say("other-process-guid"))
+			})
+		})
+	})
+
+	Describe("Crash loops", func() {
+		var crashes []models.Event
+
+		BeforeEach(func() {
+			watcherConfig = watcher.Config{
+				CrashLoopThreshold: 3,
+				CrashLoopWindow:    time.Minute,
+			}
+			crashes = nil
+		})
+
+		JustBeforeEach(func() {
+			streamEvents(eventSource, crashes...)
+		})
+
+		crashAt := func(instanceGuid string, crashCount int32, since time.Duration) models.Event {
+			lrp := makeCrashingActualLRP("process-guid", instanceGuid, 1, 0, crashCount, cc_messages.AppLRPDomain, "exited")
+			lrp.Since = int64(since)
+			return models.NewActualLRPCrashedEvent(lrp, lrp)
+		}
+
+		Context("when an instance crashes often enough within the window", func() {
+			BeforeEach(func() {
+				crashes = []models.Event{
+					crashAt("instance-1", 1, 0),
+					crashAt("instance-2", 2, 10*time.Second),
+					crashAt("instance-3", 3, 20*time.Second),
+					crashAt("instance-4", 4, 30*time.Second),
+				}
+			})
+
+			It("reports the crash loop once with the crash timeline", func() {
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(4))
+				Eventually(ccClient.AppCrashLoopingWithContextCallCount).Should(Equal(1))
+				Consistently(ccClient.AppCrashLoopingWithContextCallCount).Should(Equal(1))
+
+				_, guid, request, _ := ccClient.AppCrashLoopingWithContextArgsForCall(0)
+				Expect(guid).To(Equal("process-guid"))
+				Expect(request.Index).To(Equal(1))
+				Expect(request.Reason).To(Equal(watcher.CrashLoopReasonThresholdExceeded))
+				Expect(request.Crashes).To(HaveLen(3))
+				Expect(request.Crashes[0]).To(Equal(cc_client.CrashRecord{
+					Instance:        "instance-1",
+					CellID:          "some-cell",
+					ExitDescription: "exited",
+					CrashCount:      1,
+					CrashTimestamp:  0,
+				}))
+				Expect(request.Crashes[2].Instance).To(Equal("instance-3"))
+
+				Expect(logger).To(Say("app-crash-looping"))
+				Expect(counterTotal(fakeEmitter, "AppCrashLoopsDetected")).To(BeEquivalentTo(1))
+			})
+
+			Context("when the watcher stops while the crash loop is being recorded", func() {
+				var contexts chan context.Context
+
+				BeforeEach(func() {
+					contexts = make(chan context.Context, 1)
+					ccClient.AppCrashLoopingWithContextCalls(blockUntilCanceled[cc_client.AppCrashLoopingRequest](contexts))
+				})
+
+				It("cancels the request", func() {
+					expectCanceledOnStop(contexts)
+				})
+			})
+		})
+
+		Context("when the crashes are spread further apart than the window", func() {
+			BeforeEach(func() {
+				crashes = []models.Event{
+					crashAt("instance-1", 1, 0),
+					crashAt("instance-2", 2, 2*time.Minute),
+					crashAt("instance-3", 3, 4*time.Minute),
+				}
+			})
+
+			It("does not report a crash loop", func() {
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(3))
+				Consistently(ccClient.AppCrashLoopingWithContextCallCount).Should(Equal(0))
+			})
+		})
+
+		Context("when Diego starts backing off restarts", func() {
+			BeforeEach(func() {
+				crashes = []models.Event{
+					crashAt("instance-1", models.DefaultImmediateRestarts+1, 0),
+				}
+			})
+
+			It("reports the crash loop", func() {
+				Eventually(ccClient.AppCrashLoopingWithContextCallCount).Should(Equal(1))
+				_, _, request, _ := ccClient.AppCrashLoopingWithContextArgsForCall(0)
+				Expect(request.Reason).To(Equal(watcher.CrashLoopReasonBackoff))
+				Expect(request.Crashes).To(HaveLen(1))
+			})
+		})
+
+		Context("when the crash count is reset", func() {
+			BeforeEach(func() {
+				crashes = []models.Event{
+					crashAt("instance-1", 1, 0),
+					crashAt("instance-2", 2, 10*time.Second),
+					crashAt("instance-3", 1, 20*time.Second),
+				}
+			})
+
+			It("starts a new episode", func() {
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(3))
+				Consistently(ccClient.AppCrashLoopingWithContextCallCount).Should(Equal(0))
+			})
+		})
+
+		Context("when crash loop detection is disabled", func() {
+			BeforeEach(func() {
+				watcherConfig.CrashLoopThreshold = 0
+				crashes = []models.Event{
+					crashAt("instance-1", 4, 0),
+					crashAt("instance-2", 5, 10*time.Second),
+					crashAt("instance-3", 6, 20*time.Second),
+				}
+			})
+
+			It("does not report crash loops", func() {
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(3))
+				Consistently(ccClient.AppCrashLoopingWithContextCallCount).Should(Equal(0))
+			})
+		})
+	})
+
+	Describe("Instances that fail to start", func() {
+		var (
+			unclaimed *models.ActualLRP
+			events    []models.Event
+		)
+
+		BeforeEach(func() {
+			watcherConfig.StuckInstanceThreshold = time.Minute
+
+			unclaimed = model_helpers.NewValidActualLRP("process-guid", 2)
+			unclaimed.Domain = cc_messages.AppLRPDomain
+			unclaimed.State = models.ActualLRPStateUnclaimed
+			unclaimed.ActualLRPInstanceKey = models.ActualLRPInstanceKey{}
+			unclaimed.ActualLRPNetInfo = models.ActualLRPNetInfo{}
+			unclaimed.PlacementError = "insufficient resources"
+			unclaimed.Since = fakeClock.Now().UnixNano()
+
+			events = []models.Event{models.NewActualLRPInstanceCreatedEvent(unclaimed, "trace-id")}
+		})
+
+		JustBeforeEach(func() {
+			calls := eventSource.NextCallCount()
+			streamEvents(eventSource, events...)
+			Eventually(eventSource.NextCallCount).Should(BeNumerically(">", calls+len(events)))
+		})
+
+		Context("when an instance stays unclaimed past the threshold", func() {
+			It("reports that the instance failed to start", func() {
+				fakeClock.WaitForWatcherAndIncrement(30 * time.Second)
+				Consistently(ccClient.AppInstanceFailedToStartWithContextCallCount).Should(Equal(0))
+
+				fakeClock.Increment(40 * time.Second)
+				Eventually(ccClient.AppInstanceFailedToStartWithContextCallCount).Should(Equal(1))
+
+				_, guid, request, _ := ccClient.AppInstanceFailedToStartWithContextArgsForCall(0)
+				Expect(guid).To(Equal("process-guid"))
+				Expect(request.Index).To(Equal(2))
+				Expect(request.Instance).To(BeEmpty())
+				Expect(request.State).To(Equal(models.ActualLRPStateUnclaimed))
+				Expect(request.Since).To(Equal(unclaimed.Since))
+				Expect(request.PlacementError).To(Equal("insufficient resources"))
+				Expect(request.Reason).To(Equal("Instance has been UNCLAIMED for more than 1m0s"))
+
+				Expect(logger).To(Say("app-instance-failed-to-start"))
+				Expect(counterTotal(fakeEmitter, "AppInstancesFailedToStart")).To(BeEquivalentTo(1))
+			})
+
+			It("cancels the request when the watcher stops", func() {
+				contexts := make(chan context.Context, 1)
+				ccClient.AppInstanceFailedToStartWithContextCalls(blockUntilCanceled[cc_client.AppInstanceFailedToStartRequest](contexts))
+
+				fakeClock.WaitForWatcherAndIncrement(70 * time.Second)
+				expectCanceledOnStop(contexts)
+			})
+
+			It("reports it only once", func() {
+				fakeClock.WaitForWatcherAndIncrement(70 * time.Second)
+				Eventually(ccClient.AppInstanceFailedToStartWithContextCallCount).Should(Equal(1))
+
+				fakeClock.Increment(70 * time.Second)
+				Consistently(ccClient.AppInstanceFailedToStartWithContextCallCount).Should(Equal(1))
+			})
+		})
+
+		Context("when the instance is claimed and then stays claimed", func() {
+			BeforeEach(func() {
+				claimed := *unclaimed
+				claimed.State = models.ActualLRPStateClaimed
+				claimed.ActualLRPInstanceKey = models.NewActualLRPInstanceKey("instance-guid", "cell-id")
+				claimed.PlacementError = ""
+				claimed.Since = fakeClock.Now().Add(30 * time.Second).UnixNano()
+
+				events = append(events, models.NewActualLRPInstanceChangedEvent(unclaimed, &claimed, "trace-id"))
+			})
+
+			It("measures the time from when it was claimed", func() {
+				fakeClock.WaitForWatcherAndIncrement(70 * time.Second)
+				Consistently(ccClient.AppInstanceFailedToStartWithContextCallCount).Should(Equal(0))
+
+				fakeClock.Increment(30 * time.Second)
+				Eventually(ccClient.AppInstanceFailedToStartWithContextCallCount).Should(Equal(1))
+
+				_, _, request, _ := ccClient.AppInstanceFailedToStartWithContextArgsForCall(0)
+				Expect(request.State).To(Equal(models.ActualLRPStateClaimed))
+				Expect(request.Instance).To(Equal("instance-guid"))
+				Expect(request.CellID).To(Equal("cell-id"))
+			})
+		})
+
+		Context("when the instance starts running", func() {
+			BeforeEach(func() {
+				running := *unclaimed
+				running.State = models.ActualLRPStateRunning
+				running.ActualLRPInstanceKey = models.NewActualLRPInstanceKey("instance-guid", "cell-id")
+
+				events = append(events, models.NewActualLRPInstanceChangedEvent(unclaimed, &running, "trace-id"))
+			})
+
+			It("does not report it", func() {
+				fakeClock.WaitForWatcherAndIncrement(2 * time.Minute)
+				Consistently(ccClient.AppInstanceFailedToStartWithContextCallCount).Should(Equal(0))
+			})
+		})
+
+		Context("when the instance is removed", func() {
+			BeforeEach(func() {
+				events = append(events, models.NewActualLRPInstanceRemovedEvent(unclaimed, "trace-id"))
+			})
+
+			It("does not report it", func() {
+				fakeClock.WaitForWatcherAndIncrement(2 * time.Minute)
+				Consistently(ccClient.AppInstanceFailedToStartWithContextCallCount).Should(Equal(0))
+			})
+		})
+	})
+
+	Describe("Startup latency", func() {
+		var (
+			created *models.ActualLRP
+			running *models.ActualLRP
+			events  []models.Event
+		)
+
+		BeforeEach(func() {
+			now := fakeClock.Now()
+
+			created = model_helpers.NewValidActualLRP("process-guid", 0)
+			created.Domain = cc_messages.AppLRPDomain
+			created.State = models.ActualLRPStateUnclaimed
+			created.Since = now.Add(-10 * time.Second).UnixNano()
+
+			running = model_helpers.NewValidActualLRP("process-guid", 0)
+			running.Domain = cc_messages.AppLRPDomain
+			running.ActualLRPInstanceKey = models.NewActualLRPInstanceKey("instance-guid", "cell-id")
+			running.State = models.ActualLRPStateRunning
+			running.Since = now.Add(-4 * time.Second).UnixNano()
+			running.SetRoutable(false)
+		})
+
+		JustBeforeEach(func() {
+			streamEvents(eventSource, events...)
+		})
+
+		Context("when the instance becomes routable after it is running", func() {
+			BeforeEach(func() {
+				routable := *running
+				routable.SetRoutable(true)
+
+				events = []models.Event{
+					models.NewActualLRPInstanceCreatedEvent(created, "trace-id"),
+					models.NewActualLRPInstanceChangedEvent(created, running, "trace-id"),
+					models.NewActualLRPInstanceChangedEvent(running, &routable, "trace-id"),
+				}
+			})
+
+			It("sends the time to running and to routable without per-instance tags", func() {
+				Eventually(func() []*sonde_events.Envelope {
+					return valueEnvelopes(fakeEmitter, "AppInstanceTimeToRoutable")
+				}).Should(HaveLen(1))
+
+				toRunning := valueEnvelopes(fakeEmitter, "AppInstanceTimeToRunning")
+				Expect(toRunning).To(HaveLen(1))
+				Expect(toRunning[0].GetValueMetric().GetValue()).To(Equal(6000.0))
+				Expect(toRunning[0].GetValueMetric().GetUnit()).To(Equal("ms"))
+				Expect(toRunning[0].GetTags()).To(BeEmpty())
+
+				toRoutable := valueEnvelopes(fakeEmitter, "AppInstanceTimeToRoutable")
+				Expect(toRoutable[0].GetValueMetric().GetValue()).To(Equal(10000.0))
+				Expect(toRoutable[0].GetTags()).To(BeEmpty())
+			})
+
+			It("periodically sends histograms and per-app and per-cell summaries", func() {
+				Eventually(func() []*sonde_events.Envelope {
+					return valueEnvelopes(fakeEmitter, "AppInstanceTimeToRoutable")
+				}).Should(HaveLen(1))
+
+				fakeClock.WaitForWatcherAndIncrement(time.Minute)
+
+				Eventually(logger).Should(Say("app-startup-latency-summary"))
+				Eventually(func() []*sonde_events.Envelope {
+					return valueEnvelopes(fakeEmitter, "AppInstanceTimeToRunningMean")
+				}).Should(HaveLen(1))
+
+				mean := valueEnvelopes(fakeEmitter, "AppInstanceTimeToRunningMean")
+				Expect(mean[0].GetValueMetric().GetValue()).To(Equal(6000.0))
+				Expect(mean[0].GetTags()).To(Equal(map[string]string{"process_guid": "process-guid"}))
+
+				Expect(logger).To(Say("cell-startup-latency-summary"))
+				cellMax := valueEnvelopes(fakeEmitter, "AppInstanceTimeToRoutableCellMax")
+				Expect(cellMax).To(HaveLen(1))
+				Expect(cellMax[0].GetValueMetric().GetValue()).To(Equal(10000.0))
+				Expect(cellMax[0].GetTags()).To(Equal(map[string]string{"cell_id": "cell-id"}))
+
+				buckets := map[string]float64{}
+				for _, envelope := range valueEnvelopes(fakeEmitter, "AppInstanceTimeToRoutableBucket") {
+					buckets[envelope.GetTags()["le"]] = envelope.GetValueMetric().GetValue()
+				}
+				Expect(buckets).To(HaveKeyWithValue("5", 0.0))
+				Expect(buckets).To(HaveKeyWithValue("10", 1.0))
+				Expect(buckets).To(HaveKeyWithValue("+Inf", 1.0))
+			})
+		})
+
+		Context("when the instance is routable as soon as it is running", func() {
+			BeforeEach(func() {
+				running.SetRoutable(true)
+
+				events = []models.Event{
+					models.NewActualLRPInstanceCreatedEvent(created, "trace-id"),
+					models.NewActualLRPInstanceChangedEvent(created, running, "trace-id"),
+				}
+			})
+
+			It("uses the running time for both measurements", func() {
+				Eventually(func() []*sonde_events.Envelope {
+					return valueEnvelopes(fakeEmitter, "AppInstanceTimeToRoutable")
+				}).Should(HaveLen(1))
+
+				toRoutable := valueEnvelopes(fakeEmitter, "AppInstanceTimeToRoutable")
+				Expect(toRoutable[0].GetValueMetric().GetValue()).To(Equal(6000.0))
+			})
+		})
+
+		Context("when the creation of the instance was not observed", func() {
+			BeforeEach(func() {
+				events = []models.Event{
+					models.NewActualLRPInstanceChangedEvent(created, running, "trace-id"),
+				}
+			})
+
+			It("does not send any measurement", func() {
+				Eventually(eventSource.NextCallCount).Should(BeNumerically(">", 1))
+				Consistently(func() []*sonde_events.Envelope {
+					return valueEnvelopes(fakeEmitter, "AppInstanceTimeToRunning")
+				}).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Evacuation completion", func() {
+		var (
+			evacuating  *models.ActualLRP
+			unclaimed   *models.ActualLRP
+			replacement *models.ActualLRP
+			queue       *eventQueue
+		)
+
+		BeforeEach(func() {
+			evacuating = model_helpers.NewValidActualLRP("process-guid", 1)
+			evacuating.Domain = cc_messages.AppLRPDomain
+			evacuating.ActualLRPInstanceKey = models.NewActualLRPInstanceKey("old-instance-guid", "old-cell")
+			evacuating.Presence = models.ActualLRP_Evacuating
+
+			unclaimed = model_helpers.NewValidActualLRP("process-guid", 1)
+			unclaimed.Domain = cc_messages.AppLRPDomain
+			unclaimed.ActualLRPInstanceKey = models.ActualLRPInstanceKey{}
+			unclaimed.State = models.ActualLRPStateUnclaimed
+
+			replacement = model_helpers.NewValidActualLRP("process-guid", 1)
+			replacement.Domain = cc_messages.AppLRPDomain
+			replacement.ActualLRPInstanceKey = models.NewActualLRPInstanceKey("new-instance-guid", "new-cell")
+			replacement.State = models.ActualLRPStateRunning
+			replacement.SetRoutable(true)
+
+			watcherConfig.NotifyAppRescheduled = true
+		})
+
+		JustBeforeEach(func() {
+			queue = streamEvents(eventSource, models.NewActualLRPInstanceCreatedEvent(evacuating, "trace-id"))
+			Eventually(eventSource.NextCallCount).Should(BeNumerically(">", 1))
+		})
+
+		Context("when the evacuating instance stops before its replacement is ready", func() {
+			It("reports the rescheduled instance with the downtime", func() {
+				queue.push(models.NewActualLRPInstanceRemovedEvent(evacuating, "trace-id"))
+				Eventually(ccClient.AppReschedulingWithContextCallCount).Should(Equal(1))
+
+				fakeClock.Increment(3 * time.Second)
+				queue.push(models.NewActualLRPInstanceChangedEvent(unclaimed, replacement, "trace-id"))
+
+				Eventually(ccClient.AppRescheduledWithContextCallCount).Should(Equal(1))
+				_, guid, request, _ := ccClient.AppRescheduledWithContextArgsForCall(0)
+				Expect(guid).To(Equal("process-guid"))
+				Expect(request.Index).To(Equal(1))
+				Expect(request.Instance).To(Equal("new-instance-guid"))
+				Expect(request.CellID).To(Equal("new-cell"))
+				Expect(request.OldInstance).To(Equal("old-instance-guid"))
+				Expect(request.OldCellID).To(Equal("old-cell"))
+				Expect(request.DowntimeMillis).To(BeEquivalentTo(3000))
+				Expect(request.Since).To(Equal(replacement.Since))
+
+				Expect(logger).To(Say("app-rescheduled"))
+				Expect(counterTotal(fakeEmitter, "AppInstancesRescheduled")).To(BeEquivalentTo(1))
+			})
+
+			It("cancels the request when the watcher stops", func() {
+				contexts := make(chan context.Context, 1)
+				ccClient.AppRescheduledWithContextCalls(blockUntilCanceled[cc_client.AppRescheduledRequest](contexts))
+
+				queue.push(models.NewActualLRPInstanceRemovedEvent(evacuating, "trace-id"))
+				queue.push(models.NewActualLRPInstanceChangedEvent(unclaimed, replacement, "trace-id"))
+				expectCanceledOnStop(contexts)
+			})
+		})
 
-		var err error
-		watcherRunner, err = watcher.NewWatcher(logger, 500, 10*time.Millisecond, bbsClient, ccClient)
-		Expect(err).NotTo(HaveOccurred())
+		Context("when the replacement is ready before the evacuating instance stops", func() {
+			It("reports no downtime", func() {
+				fakeClock.Increment(3 * time.Second)
+				queue.push(models.NewActualLRPInstanceChangedEvent(unclaimed, replacement, "trace-id"))
 
-		nextErr = atomic.Value{}
-		nextErr := nextErr
-		nextEvent.Store(nilEventHolder)
+				Eventually(ccClient.AppRescheduledWithContextCallCount).Should(Equal(1))
+				_, _, request, _ := ccClient.AppRescheduledWithContextArgsForCall(0)
+				Expect(request.DowntimeMillis).To(BeZero())
+			})
 
-		eventSource.CloseStub = func() error {
-			nextErr.Store(errors.New("closed"))
-			return nil
+			It("does not report the move again when the evacuating instance stops", func() {
+				queue.push(models.NewActualLRPInstanceChangedEvent(unclaimed, replacement, "trace-id"))
+				Eventually(ccClient.AppRescheduledWithContextCallCount).Should(Equal(1))
+
+				queue.push(models.NewActualLRPInstanceRemovedEvent(evacuating, "trace-id"))
+				Eventually(ccClient.AppReschedulingWithContextCallCount).Should(Equal(1))
+
+				notReady := *replacement
+				notReady.SetRoutable(false)
+				queue.push(models.NewActualLRPInstanceChangedEvent(replacement, &notReady, "trace-id"))
+				queue.push(models.NewActualLRPInstanceChangedEvent(&notReady, replacement, "trace-id"))
+				Eventually(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(2))
+				Consistently(ccClient.AppRescheduledWithContextCallCount).Should(Equal(1))
+			})
+		})
+
+		Context("when the replacement is running but not yet routable", func() {
+			BeforeEach(func() {
+				replacement.SetRoutable(false)
+			})
+
+			It("waits for it to become routable", func() {
+				queue.push(models.NewActualLRPInstanceChangedEvent(unclaimed, replacement, "trace-id"))
+				Consistently(ccClient.AppRescheduledWithContextCallCount).Should(Equal(0))
+
+				routable := *replacement
+				routable.SetRoutable(true)
+				queue.push(models.NewActualLRPInstanceChangedEvent(replacement, &routable, "trace-id"))
+				Eventually(ccClient.AppRescheduledWithContextCallCount).Should(Equal(1))
+			})
+		})
+
+		Context("when notifying CC is disabled", func() {
+			BeforeEach(func() {
+				watcherConfig.NotifyAppRescheduled = false
+			})
+
+			It("only logs the rescheduled instance", func() {
+				queue.push(models.NewActualLRPInstanceChangedEvent(unclaimed, replacement, "trace-id"))
+				Eventually(logger).Should(Say("app-rescheduled"))
+				Consistently(ccClient.AppRescheduledWithContextCallCount).Should(Equal(0))
+			})
+		})
+
+		Context("when an instance becomes ready without an evacuation", func() {
+			It("does not report a rescheduled instance", func() {
+				other := *replacement
+				other.Index = 2
+				queue.push(models.NewActualLRPInstanceChangedEvent(unclaimed, &other, "trace-id"))
+				Consistently(ccClient.AppRescheduledWithContextCallCount).Should(Equal(0))
+			})
+		})
+	})
+
+	Describe("Lost instances", func() {
+		var (
+			running   *models.ActualLRP
+			instances int32
+			queue     *eventQueue
+		)
+
+		desiredLRP := func(instances int32) *models.DesiredLRP {
+			lrp := model_helpers.NewValidDesiredLRP("process-guid")
+			lrp.Domain = cc_messages.AppLRPDomain
+			lrp.Instances = instances
+			return lrp
 		}
 
-		eventSource.NextStub = func() (models.Event, error) {
-			time.Sleep(10 * time.Millisecond)
-			if eventHolder := nextEvent.Load(); eventHolder != nilEventHolder {
-				nextEvent.Store(nilEventHolder)
+		BeforeEach(func() {
+			running = model_helpers.NewValidActualLRP("process-guid", 1)
+			running.Domain = cc_messages.AppLRPDomain
+			running.AvailabilityZone = "z1"
 
-				eh := eventHolder.(EventHolder)
-				if eh.event != nil {
-					return eh.event, nil
+			instances = 2
+			watcherConfig.NotifyAppInstanceLost = true
+
+			bbsClient.DesiredLRPSchedulingInfosStub = func(lager.Logger, string, models.DesiredLRPFilter) ([]*models.DesiredLRPSchedulingInfo, error) {
+				if instances == 0 {
+					return nil, nil
 				}
+				seeded := desiredLRP(instances).DesiredLRPSchedulingInfo()
+				return []*models.DesiredLRPSchedulingInfo{&seeded}, nil
 			}
+		})
 
-			if err := nextErr.Load(); err != nil {
-				return nil, err.(error)
+		JustBeforeEach(func() {
+			queue = streamEvents(eventSource)
+			if instances > 0 {
+				Eventually(func() bool {
+					_, ok := watcherRunner.DesiredLRP("process-guid")
+					return ok
+				}).Should(BeTrue())
 			}
+		})
 
-			return nil, nil
-		}
-	})
+		Context("when a running instance is removed while its index is still desired", func() {
+			It("reports the lost instance with its last known cell and state", func() {
+				queue.push(models.NewActualLRPInstanceRemovedEvent(running, "trace-id"))
 
-	JustBeforeEach(func() {
-		process = ifrit.Invoke(watcherRunner)
-	})
+				Eventually(ccClient.AppInstanceLostWithContextCallCount).Should(Equal(1))
+				_, guid, request, _ := ccClient.AppInstanceLostWithContextArgsForCall(0)
+				Expect(guid).To(Equal("process-guid"))
+				Expect(request.Instance).To(Equal(running.InstanceGuid))
+				Expect(request.Index).To(Equal(1))
+				Expect(request.CellID).To(Equal(running.CellId))
+				Expect(request.State).To(Equal(models.ActualLRPStateRunning))
+				Expect(request.Since).To(Equal(running.Since))
+				Expect(request.Reason).To(Equal(watcher.InstanceLostReasonRemoved))
+				Expect(request.InstanceDetails.AvailabilityZone).To(Equal("z1"))
+
+				Expect(logger).To(Say("app-instance-lost"))
+				Expect(counterTotal(fakeEmitter, "AppInstancesLost")).To(BeEquivalentTo(1))
+			})
 
-	AfterEach(func() {
-		process.Signal(os.Interrupt)
-		Eventually(process.Wait()).Should(Receive())
+			It("cancels the request when the watcher stops", func() {
+				contexts := make(chan context.Context, 1)
+				ccClient.AppInstanceLostWithContextCalls(blockUntilCanceled[cc_client.AppInstanceLostRequest](contexts))
+
+				queue.push(models.NewActualLRPInstanceRemovedEvent(running, "trace-id"))
+				expectCanceledOnStop(contexts)
+			})
+
+			It("continues the BBS trace of the event", func() {
+				queue.push(models.NewActualLRPInstanceRemovedEvent(running, "4bf92f35-77b3-4da6-a3ce-929d0e0e4736"))
+
+				Eventually(ccClient.AppInstanceLostWithContextCallCount).Should(Equal(1))
+				ctx, _, _, _ := ccClient.AppInstanceLostWithContextArgsForCall(0)
+				span, ok := tracing.FromContext(ctx)
+				Expect(ok).To(BeTrue())
+				Expect(span.TraceID).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+
+				Expect(logger).To(Say(`"trace-id":"4bf92f3577b34da6a3ce929d0e0e4736"`))
+			})
+		})
+
+		Context("when notifying CC is disabled", func() {
+			BeforeEach(func() {
+				watcherConfig.NotifyAppInstanceLost = false
+			})
+
+			It("only logs the lost instance", func() {
+				queue.push(models.NewActualLRPInstanceRemovedEvent(running, "trace-id"))
+
+				Eventually(logger).Should(Say("app-instance-lost"))
+				Expect(counterTotal(fakeEmitter, "AppInstancesLost")).To(BeEquivalentTo(1))
+				Consistently(ccClient.AppInstanceLostWithContextCallCount).Should(Equal(0))
+			})
+		})
+
+		Context("when the app was scaled down", func() {
+			BeforeEach(func() {
+				instances = 1
+			})
+
+			It("does not report the instance", func() {
+				queue.push(models.NewActualLRPInstanceRemovedEvent(running, "trace-id"))
+
+				Consistently(logger).ShouldNot(Say("app-instance-lost"))
+				Expect(ccClient.AppInstanceLostWithContextCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the app was stopped", func() {
+			BeforeEach(func() {
+				watcherConfig.ScaleDownGracePeriod = time.Minute
+			})
+
+			It("does not report the instance", func() {
+				desiredQueue.push(models.NewDesiredLRPRemovedEvent(desiredLRP(instances), "trace-id"))
+				Eventually(func() bool {
+					_, ok := watcherRunner.DesiredLRP("process-guid")
+					return ok
+				}).Should(BeFalse())
+
+				queue.push(models.NewActualLRPInstanceRemovedEvent(running, "trace-id"))
+
+				Eventually(logger).Should(Say("ignoring-event-for-retiring-instance"))
+				Consistently(ccClient.AppInstanceLostWithContextCallCount).Should(Equal(0))
+			})
+		})
+
+		Context("when the app was stopped and the grace period is disabled", func() {
+			BeforeEach(func() {
+				watcherConfig.ScaleDownGracePeriod = 0
+			})
+
+			It("does not report the instance", func() {
+				desiredQueue.push(models.NewDesiredLRPRemovedEvent(desiredLRP(instances), "trace-id"))
+				Eventually(func() bool {
+					_, ok := watcherRunner.DesiredLRP("process-guid")
+					return ok
+				}).Should(BeFalse())
+
+				queue.push(models.NewActualLRPInstanceRemovedEvent(running, "trace-id"))
+
+				Consistently(logger).ShouldNot(Say("app-instance-lost"))
+				Expect(ccClient.AppInstanceLostWithContextCallCount()).To(Equal(0))
+				Expect(counterTotal(fakeEmitter, "AppInstancesLost")).To(BeZero())
+			})
+		})
+
+		Context("when the desired LRP cache has not been seeded", func() {
+			BeforeEach(func() {
+				instances = 0
+				bbsClient.DesiredLRPSchedulingInfosStub = nil
+				bbsClient.DesiredLRPSchedulingInfosReturns(nil, models.ErrUnknownError)
+			})
+
+			It("logs the missing desired LRP and reports the instance", func() {
+				queue.push(models.NewActualLRPInstanceRemovedEvent(running, "trace-id"))
+
+				Eventually(logger).Should(Say("desired-lrp-not-cached"))
+				Eventually(ccClient.AppInstanceLostWithContextCallCount).Should(Equal(1))
+			})
+		})
+
+		Context("when a suspect instance is removed", func() {
+			BeforeEach(func() {
+				running.Presence = models.ActualLRP_Suspect
+			})
+
+			It("reports that its cell was lost", func() {
+				queue.push(models.NewActualLRPInstanceRemovedEvent(running, "trace-id"))
+
+				Eventually(ccClient.AppInstanceLostWithContextCallCount).Should(Equal(1))
+				_, _, request, _ := ccClient.AppInstanceLostWithContextArgsForCall(0)
+				Expect(request.Reason).To(Equal(watcher.InstanceLostReasonCellLost))
+				Expect(logger).NotTo(Say("desired-lrp-not-cached"))
+			})
+		})
+
+		Context("when the removed instance was not running", func() {
+			BeforeEach(func() {
+				running.State = models.ActualLRPStateCrashed
+			})
+
+			It("does not report the instance", func() {
+				queue.push(models.NewActualLRPInstanceRemovedEvent(running, "trace-id"))
+				Consistently(ccClient.AppInstanceLostWithContextCallCount).Should(Equal(0))
+			})
+		})
+
+		Context("when an evacuating instance is removed", func() {
+			BeforeEach(func() {
+				running.Presence = models.ActualLRP_Evacuating
+			})
+
+			It("does not report the instance as lost", func() {
+				queue.push(models.NewActualLRPInstanceRemovedEvent(running, "trace-id"))
+
+				Eventually(ccClient.AppReschedulingWithContextCallCount).Should(Equal(1))
+				Consistently(ccClient.AppInstanceLostWithContextCallCount).Should(Equal(0))
+			})
+		})
 	})
 
-	Describe("Actual LRP crashes", func() {
-		var actual *models.ActualLRP
+	Describe("Cell health", func() {
+		var queue *eventQueue
 
 		BeforeEach(func() {
-			actual = makeCrashingActualLRP("process-guid", "instance-guid", 1, 3, 1, cc_messages.AppLRPDomain, "out of memory")
+			watcherConfig.CellUnhealthyThreshold = 3
+			watcherConfig.CellUnhealthyWindow = time.Minute
 		})
 
 		JustBeforeEach(func() {
-			nextEvent.Store(EventHolder{models.NewActualLRPCrashedEvent(actual, actual)})
+			queue = streamEvents(eventSource)
 		})
 
-		Context("and the application has the cc-app Domain", func() {
-			It("calls AppCrashed", func() {
-				Eventually(ccClient.AppCrashedCallCount).Should(Equal(1))
-				guid, crashed, _ := ccClient.AppCrashedArgsForCall(0)
-				Expect(guid).To(Equal("process-guid"))
-				Expect(crashed).To(Equal(cc_messages.AppCrashedRequest{
-					Instance:        "instance-guid",
-					Index:           1,
-					CellID:          "some-cell",
-					Reason:          "CRASHED",
-					ExitDescription: "out of memory",
-					CrashCount:      1,
-					CrashTimestamp:  3,
-				}))
+		crashOn := func(cellID, processGuid string) models.Event {
+			lrp := makeCrashingActualLRP(processGuid, "instance-guid", 0, 0, 1, cc_messages.AppLRPDomain, "exited")
+			lrp.CellId = cellID
+			return models.NewActualLRPCrashedEvent(lrp, lrp)
+		}
 
-				Expect(logger).To(Say("app-crashed"))
+		suspectRemovedOn := func(cellID, processGuid string) models.Event {
+			lrp := makeRemovingActualLRP(processGuid, "instance-guid", 0, cc_messages.AppLRPDomain, models.ActualLRP_Suspect)
+			lrp.CellId = cellID
+			return models.NewActualLRPInstanceRemovedEvent(lrp, "trace-id")
+		}
+
+		readinessDropOn := func(cellID, processGuid string) models.Event {
+			before := model_helpers.NewValidActualLRP(processGuid, 0)
+			before.Domain = cc_messages.AppLRPDomain
+			before.CellId = cellID
+			before.SetRoutable(true)
+			after := *before
+			after.SetRoutable(false)
+			return models.NewActualLRPInstanceChangedEvent(before, &after, "trace-id")
+		}
+
+		cellUnhealthyValues := func(cellID string) []float64 {
+			var values []float64
+			for _, envelope := range valueEnvelopes(fakeEmitter, "CellUnhealthy") {
+				if envelope.GetTags()["cell_id"] == cellID {
+					values = append(values, envelope.GetValueMetric().GetValue())
+				}
+			}
+			return values
+		}
+
+		Context("when failures on one cell cross the threshold within the window", func() {
+			It("reports the cell as unhealthy once", func() {
+				queue.push(
+					crashOn("cell-1", "process-guid-a"),
+					suspectRemovedOn("cell-1", "process-guid-b"),
+					readinessDropOn("cell-1", "process-guid-a"),
+					crashOn("cell-1", "process-guid-c"),
+				)
+
+				Eventually(func() []float64 { return cellUnhealthyValues("cell-1") }).Should(Equal([]float64{1}))
+				Consistently(func() []float64 { return cellUnhealthyValues("cell-1") }).Should(Equal([]float64{1}))
+
+				Expect(counterTotal(fakeEmitter, "CellUnhealthyAlerts")).To(BeEquivalentTo(1))
+				Expect(logger).To(Say("cell-unhealthy"))
+				Expect(logger).To(Say(`"cell-id":"cell-1","crashes":1,"process-guids":\["process-guid-a","process-guid-b"\],"readiness-drops":1,"removals":1`))
+			})
+
+			Context("when lifecycle events are buffered", func() {
+				BeforeEach(func() {
+					watcherConfig.LifecycleEventBufferSize = 10
+				})
+
+				It("publishes a lifecycle event with the alert", func() {
+					queue.push(
+						crashOn("cell-1", "process-guid-a"),
+						suspectRemovedOn("cell-1", "process-guid-b"),
+						readinessDropOn("cell-1", "process-guid-a"),
+					)
+					Eventually(logger).Should(Say("cell-unhealthy"))
+
+					subscription, replay := watcherRunner.LifecycleEvents().Subscribe(0, lifecycle.Filter{})
+					defer subscription.Close()
+
+					var alerts []lifecycle.Event
+					for _, event := range replay {
+						if event.Type == lifecycle.CellUnhealthy {
+							alerts = append(alerts, event)
+						}
+					}
+					Expect(alerts).To(HaveLen(1))
+					Expect(alerts[0].ProcessGuid).To(BeEmpty())
+					Expect(alerts[0].Data).To(MatchJSON(`{
+						"cell_id": "cell-1",
+						"crashes": 1,
+						"removals": 1,
+						"readiness_drops": 1,
+						"process_guids": ["process-guid-a", "process-guid-b"],
+						"window": "1m0s"
+					}`))
+				})
+			})
+
+			It("reports the cell as recovered once the failures leave the window", func() {
+				queue.push(
+					crashOn("cell-1", "process-guid-a"),
+					crashOn("cell-1", "process-guid-b"),
+					crashOn("cell-1", "process-guid-c"),
+				)
+				Eventually(func() []float64 { return cellUnhealthyValues("cell-1") }).Should(Equal([]float64{1}))
+
+				fakeClock.WaitForWatcherAndIncrement(30 * time.Second)
+				Consistently(func() []float64 { return cellUnhealthyValues("cell-1") }).Should(Equal([]float64{1}))
+
+				fakeClock.Increment(40 * time.Second)
+				Eventually(func() []float64 { return cellUnhealthyValues("cell-1") }).Should(Equal([]float64{1, 0}))
+				Expect(logger).To(Say("cell-recovered"))
 			})
 		})
 
-		Context("and the application does not have the cc-app Domain", func() {
-			var otherActual *models.ActualLRP
+		Context("when the failures are spread across cells", func() {
+			It("does not report any cell", func() {
+				queue.push(
+					crashOn("cell-1", "process-guid"),
+					crashOn("cell-2", "process-guid"),
+					crashOn("cell-3", "process-guid"),
+				)
+
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(3))
+				Consistently(func() uint64 { return counterTotal(fakeEmitter, "CellUnhealthyAlerts") }).Should(BeZero())
+			})
+		})
+
+		Context("when the failures are spread further apart than the window", func() {
+			It("does not report the cell", func() {
+				queue.push(crashOn("cell-1", "process-guid"), crashOn("cell-1", "process-guid"))
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(2))
+
+				fakeClock.WaitForWatcherAndIncrement(2 * time.Minute)
+				queue.push(crashOn("cell-1", "process-guid"))
 
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(3))
+				Consistently(func() uint64 { return counterTotal(fakeEmitter, "CellUnhealthyAlerts") }).Should(BeZero())
+			})
+		})
+
+		Context("when cell health checks are disabled", func() {
 			BeforeEach(func() {
-				otherActual = makeCrashingActualLRP("other-process-guid", "instance-guid", 1, 3, 1, "", "")
+				watcherConfig.CellUnhealthyThreshold = 0
+			})
 
-				event := EventHolder{models.NewActualLRPCrashedEvent(actual, actual)}
-				otherEvent := EventHolder{models.NewActualLRPCrashedEvent(otherActual, otherActual)}
-				events := []EventHolder{otherEvent, event}
+			It("does not report the cell", func() {
+				queue.push(
+					crashOn("cell-1", "process-guid"),
+					crashOn("cell-1", "process-guid"),
+					crashOn("cell-1", "process-guid"),
+				)
 
-				eventSource.NextStub = func() (models.Event, error) {
-					var e EventHolder
-					time.Sleep(10 * time.Millisecond)
-					if len(events) == 0 {
-						return nil, nil
-					}
-					e, events = events[0], events[1:]
-					return e.event, nil
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(3))
+				Consistently(func() uint64 { return counterTotal(fakeEmitter, "CellUnhealthyAlerts") }).Should(BeZero())
+			})
+		})
+	})
+
+	Describe("Availability zone health", func() {
+		var queue *eventQueue
+
+		BeforeEach(func() {
+			watcherConfig.ZoneDegradedThreshold = 3
+			watcherConfig.ZoneDegradedWindow = time.Minute
+		})
+
+		JustBeforeEach(func() {
+			queue = streamEvents(eventSource)
+		})
+
+		runningIn := func(zone, processGuid string, index int32) *models.ActualLRP {
+			lrp := model_helpers.NewValidActualLRP(processGuid, index)
+			lrp.Domain = cc_messages.AppLRPDomain
+			lrp.AvailabilityZone = zone
+			return lrp
+		}
+
+		lost := func(lrp *models.ActualLRP) models.Event {
+			suspect := *lrp
+			suspect.Presence = models.ActualLRP_Suspect
+			return models.NewActualLRPInstanceChangedEvent(lrp, &suspect, "trace-id")
+		}
+
+		crashed := func(lrp *models.ActualLRP) models.Event {
+			return models.NewActualLRPCrashedEvent(lrp, lrp)
+		}
+
+		zoneValues := func(name, zone string) []float64 {
+			var values []float64
+			for _, envelope := range valueEnvelopes(fakeEmitter, name) {
+				if envelope.GetTags()["availability_zone"] == zone {
+					values = append(values, envelope.GetValueMetric().GetValue())
 				}
+			}
+			return values
+		}
+
+		Context("when instances in one zone are lost or crash within the window", func() {
+			It("reports the zone as degraded once with the number of affected apps", func() {
+				a0 := runningIn("z1", "process-guid-a", 0)
+				a1 := runningIn("z1", "process-guid-a", 1)
+				b0 := runningIn("z1", "process-guid-b", 0)
+				queue.push(
+					models.NewActualLRPInstanceCreatedEvent(b0, "trace-id"),
+					lost(a0),
+					lost(a1),
+					crashed(b0),
+					lost(b0),
+				)
+
+				Eventually(func() []float64 { return zoneValues("AvailabilityZoneDegraded", "z1") }).Should(Equal([]float64{1}))
+				Consistently(func() []float64 { return zoneValues("AvailabilityZoneDegraded", "z1") }).Should(Equal([]float64{1}))
+				Expect(zoneValues("AvailabilityZoneAffectedApps", "z1")).To(Equal([]float64{2}))
+
+				Expect(counterTotal(fakeEmitter, "AvailabilityZoneDegradedAlerts")).To(BeEquivalentTo(1))
+				Expect(logger).To(Say(`"affected-apps":2,"availability-zone":"z1","crashes":1,"lost-instances":2`))
 			})
 
-			It("does not call AppCrashed", func() {
-				Eventually(ccClient.AppCrashedCallCount).Should(Equal(1))
-				buffer := logger.Buffer()
-				Expect(buffer).To(Say("process-guid"))
-				Expect(buffer).NotTo(Say("other-process-guid"))
+			Context("when lifecycle events are buffered", func() {
+				BeforeEach(func() {
+					watcherConfig.LifecycleEventBufferSize = 10
+				})
+
+				It("publishes a lifecycle event with the alert", func() {
+					queue.push(
+						lost(runningIn("z1", "process-guid-a", 0)),
+						lost(runningIn("z1", "process-guid-a", 1)),
+						lost(runningIn("z1", "process-guid-b", 0)),
+					)
+					Eventually(logger).Should(Say("availability-zone-degraded"))
+
+					subscription, replay := watcherRunner.LifecycleEvents().Subscribe(0, lifecycle.Filter{})
+					defer subscription.Close()
+
+					var alerts []lifecycle.Event
+					for _, event := range replay {
+						if event.Type == lifecycle.AvailabilityZoneDegraded {
+							alerts = append(alerts, event)
+						}
+					}
+					Expect(alerts).To(HaveLen(1))
+					Expect(alerts[0].ProcessGuid).To(BeEmpty())
+					Expect(alerts[0].Data).To(MatchJSON(`{
+						"availability_zone": "z1",
+						"crashes": 0,
+						"lost_instances": 3,
+						"affected_apps": 2,
+						"process_guids": ["process-guid-a", "process-guid-b"],
+						"window": "1m0s"
+					}`))
+				})
+			})
+
+			It("reports the zone as recovered once the failures leave the window", func() {
+				queue.push(
+					lost(runningIn("z1", "process-guid", 0)),
+					lost(runningIn("z1", "process-guid", 1)),
+					lost(runningIn("z1", "process-guid", 2)),
+				)
+				Eventually(func() []float64 { return zoneValues("AvailabilityZoneDegraded", "z1") }).Should(Equal([]float64{1}))
+
+				fakeClock.WaitForWatcherAndIncrement(70 * time.Second)
+				Eventually(func() []float64 { return zoneValues("AvailabilityZoneDegraded", "z1") }).Should(Equal([]float64{1, 0}))
+				Expect(logger).To(Say("availability-zone-recovered"))
+			})
+		})
+
+		Context("when the failures are spread across zones", func() {
+			It("does not report any zone", func() {
+				queue.push(
+					lost(runningIn("z1", "process-guid", 0)),
+					lost(runningIn("z2", "process-guid", 1)),
+					lost(runningIn("z3", "process-guid", 2)),
+				)
+
+				Eventually(eventSource.NextCallCount).Should(BeNumerically(">", 3))
+				Consistently(func() uint64 { return counterTotal(fakeEmitter, "AvailabilityZoneDegradedAlerts") }).Should(BeZero())
+			})
+		})
+
+		Context("when the zone of an instance is unknown", func() {
+			It("does not attribute its failures to a zone", func() {
+				lrp := runningIn("", "process-guid", 0)
+				queue.push(lost(lrp), crashed(lrp), crashed(lrp))
+
+				Eventually(ccClient.AppCrashedWithContextCallCount).Should(Equal(2))
+				Consistently(func() uint64 { return counterTotal(fakeEmitter, "AvailabilityZoneDegradedAlerts") }).Should(BeZero())
 			})
 		})
 	})
@@ -181,10 +1841,10 @@ var _ = Describe("Watcher", func() {
 			})
 
 			It("does not call AppRescheduling for that event", func() {
-				Eventually(ccClient.AppReschedulingCallCount).Should(Equal(1))
-				buffer := logger.Buffer()
-				Expect(buffer).NotTo(Say("first-process-guid"))
-				Expect(buffer).To(Say("other-process-guid"))
+				Eventually(ccClient.AppReschedulingWithContextCallCount).Should(Equal(1))
+				Consistently(ccClient.AppReschedulingWithContextCallCount).Should(Equal(1))
+				_, guid, _, _ := ccClient.AppReschedulingWithContextArgsForCall(0)
+				Expect(guid).To(Equal("other-process-guid"))
 			})
 		})
 
@@ -212,7 +1872,7 @@ var _ = Describe("Watcher", func() {
 			})
 
 			It("does not call AppRescheduling for that event", func() {
-				Eventually(ccClient.AppReschedulingCallCount).Should(Equal(1))
+				Eventually(ccClient.AppReschedulingWithContextCallCount).Should(Equal(1))
 				buffer := logger.Buffer()
 				Expect(buffer).NotTo(Say("first-process-guid"))
 				Expect(buffer).To(Say("other-process-guid"))
@@ -243,15 +1903,18 @@ var _ = Describe("Watcher", func() {
 			})
 
 			It("calls AppRescheduling", func() {
-				Eventually(ccClient.AppReschedulingCallCount).Should(Equal(1))
-				guid, crashed, _ := ccClient.AppReschedulingArgsForCall(0)
+				Eventually(ccClient.AppReschedulingWithContextCallCount).Should(Equal(1))
+				_, guid, crashed, _ := ccClient.AppReschedulingWithContextArgsForCall(0)
 				Expect(guid).To(Equal("first-process-guid"))
-				Expect(crashed).To(Equal(cc_messages.AppReschedulingRequest{
+				Expect(crashed.AppReschedulingRequest).To(Equal(cc_messages.AppReschedulingRequest{
 					Instance: "first-instance-guid",
 					Index:    1,
 					CellID:   "some-cell",
 					Reason:   "Cell is being evacuated",
 				}))
+				Expect(crashed.AvailabilityZone).To(Equal("some-zone"))
+				Expect(crashed.MetricTags).To(Equal(model_helpers.NewActualLRPMetricTags()))
+				Expect(crashed.NetInfo.Address).To(Equal("some-address"))
 
 				Expect(logger).To(Say("app-evacuating"))
 			})
@@ -285,6 +1948,7 @@ var _ = Describe("Watcher", func() {
 					InstanceGuid: "after-instance-guid",
 					CellId:       "after-cell-id",
 				},
+				Since: 1234,
 			}
 		})
 
@@ -295,7 +1959,7 @@ var _ = Describe("Watcher", func() {
 
 		Context("when it does not have readiness info before or after", func() {
 			It("does not call AppReadinessChanged", func() {
-				Consistently(ccClient.AppReadinessChangedCallCount).Should(Equal(0))
+				Consistently(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(0))
 			})
 		})
 
@@ -306,8 +1970,8 @@ var _ = Describe("Watcher", func() {
 				})
 
 				It("does calls AppReadinessChanged", func() {
-					Eventually(ccClient.AppReadinessChangedCallCount).Should(Equal(1))
-					processGuid, request, _ := ccClient.AppReadinessChangedArgsForCall(0)
+					Eventually(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(1))
+					_, processGuid, request, _ := ccClient.AppReadinessChangedWithContextArgsForCall(0)
 					Expect(processGuid).To(Equal("after-process-guid"))
 					Expect(request.Instance).To(Equal("after-instance-guid"))
 					Expect(request.Index).To(Equal(7))
@@ -322,13 +1986,14 @@ var _ = Describe("Watcher", func() {
 				})
 
 				It("does call AppReadinessChanged", func() {
-					Eventually(ccClient.AppReadinessChangedCallCount).Should(Equal(1))
-					processGuid, request, _ := ccClient.AppReadinessChangedArgsForCall(0)
+					Eventually(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(1))
+					_, processGuid, request, _ := ccClient.AppReadinessChangedWithContextArgsForCall(0)
 					Expect(processGuid).To(Equal("after-process-guid"))
 					Expect(request.Instance).To(Equal("after-instance-guid"))
 					Expect(request.Index).To(Equal(7))
 					Expect(request.CellID).To(Equal("after-cell-id"))
 					Expect(request.Ready).To(Equal(true))
+					Expect(request.Since).To(BeEquivalentTo(1234))
 				})
 			})
 		})
@@ -340,7 +2005,7 @@ var _ = Describe("Watcher", func() {
 				})
 
 				It("does not call AppReadinessChanged", func() {
-					Consistently(ccClient.AppReadinessChangedCallCount).Should(Equal(0))
+					Consistently(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(0))
 				})
 			})
 
@@ -350,8 +2015,8 @@ var _ = Describe("Watcher", func() {
 				})
 
 				It("does call AppReadinessChanged", func() {
-					Eventually(ccClient.AppReadinessChangedCallCount).Should(Equal(1))
-					processGuid, request, _ := ccClient.AppReadinessChangedArgsForCall(0)
+					Eventually(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(1))
+					_, processGuid, request, _ := ccClient.AppReadinessChangedWithContextArgsForCall(0)
 					Expect(processGuid).To(Equal("after-process-guid"))
 					Expect(request.Instance).To(Equal("after-instance-guid"))
 					Expect(request.Index).To(Equal(7))
@@ -367,7 +2032,7 @@ var _ = Describe("Watcher", func() {
 				lrpAfter.SetRoutable(true)
 			})
 			It("does not call AppReadinessChanged", func() {
-				Consistently(ccClient.AppReadinessChangedCallCount).Should(Equal(0))
+				Consistently(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(0))
 			})
 		})
 
@@ -377,7 +2042,7 @@ var _ = Describe("Watcher", func() {
 				lrpAfter.SetRoutable(false)
 			})
 			It("does not call AppReadinessChanged", func() {
-				Consistently(ccClient.AppReadinessChangedCallCount).Should(Equal(0))
+				Consistently(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(0))
 			})
 		})
 
@@ -387,8 +2052,8 @@ var _ = Describe("Watcher", func() {
 				lrpAfter.SetRoutable(true)
 			})
 			It("calls AppReady", func() {
-				Eventually(ccClient.AppReadinessChangedCallCount).Should(Equal(1))
-				processGuid, request, _ := ccClient.AppReadinessChangedArgsForCall(0)
+				Eventually(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(1))
+				_, processGuid, request, _ := ccClient.AppReadinessChangedWithContextArgsForCall(0)
 				Expect(processGuid).To(Equal("after-process-guid"))
 				Expect(request.Instance).To(Equal("after-instance-guid"))
 				Expect(request.Index).To(Equal(7))
@@ -397,14 +2062,31 @@ var _ = Describe("Watcher", func() {
 			})
 
 		})
+		Context("when the readiness changes on a placed instance", func() {
+			BeforeEach(func() {
+				lrpBefore.SetRoutable(false)
+				lrpAfter.SetRoutable(true)
+				lrpAfter.State = models.ActualLRPStateRunning
+				lrpAfter.AvailabilityZone = "z2"
+				lrpAfter.ActualLRPNetInfo = models.NewActualLRPNetInfo("1.2.3.4", "5.6.7.8", models.ActualLRPNetInfo_PreferredAddressHost, models.NewPortMapping(61000, 8080))
+			})
+
+			It("includes the availability zone and net info", func() {
+				Eventually(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(1))
+				_, _, request, _ := ccClient.AppReadinessChangedWithContextArgsForCall(0)
+				Expect(request.AvailabilityZone).To(Equal("z2"))
+				Expect(request.NetInfo).To(Equal(&lrpAfter.ActualLRPNetInfo))
+			})
+		})
+
 		Context("when it goes from ready to not ready", func() {
 			BeforeEach(func() {
 				lrpBefore.SetRoutable(true)
 				lrpAfter.SetRoutable(false)
 			})
 			It("calls AppNotReady", func() {
-				Eventually(ccClient.AppReadinessChangedCallCount).Should(Equal(1))
-				processGuid, request, _ := ccClient.AppReadinessChangedArgsForCall(0)
+				Eventually(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(1))
+				_, processGuid, request, _ := ccClient.AppReadinessChangedWithContextArgsForCall(0)
 				Expect(processGuid).To(Equal("after-process-guid"))
 				Expect(request.Instance).To(Equal("after-instance-guid"))
 				Expect(request.Index).To(Equal(7))
@@ -420,7 +2102,7 @@ var _ = Describe("Watcher", func() {
 				lrpAfter.ActualLRPKey.Domain = "meow.com"
 			})
 			It("does not call AppReadinessChanged", func() {
-				Consistently(ccClient.AppReadinessChangedCallCount).Should(Equal(0))
+				Consistently(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(0))
 			})
 		})
 
@@ -434,15 +2116,15 @@ var _ = Describe("Watcher", func() {
 				Eventually(logger).Should(gbytes.Say("recording-app-readiness-changed"))
 				Eventually(logger).Should(gbytes.Say(`"index":7`))
 				Eventually(logger).Should(gbytes.Say(`"process-guid":"after-process-guid"`))
-				Eventually(ccClient.AppReadinessChangedCallCount).Should(Equal(1))
+				Eventually(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(1))
 			})
 			Context("when ccClient.AppReadinessChanged returns an error", func() {
 				BeforeEach(func() {
-					ccClient.AppReadinessChangedReturns(errors.New("meow"))
+					ccClient.AppReadinessChangedWithContextReturns(errors.New("meow"))
 				})
 				It("logs an error", func() {
 					Eventually(logger).Should(gbytes.Say("recording-app-readiness-changed"))
-					Eventually(ccClient.AppReadinessChangedCallCount).Should(Equal(1))
+					Eventually(ccClient.AppReadinessChangedWithContextCallCount).Should(Equal(1))
 					Eventually(logger).Should(gbytes.Say("failed-recording-app-readiness-changed"))
 					Eventually(logger).Should(gbytes.Say("meow"))
 				})
@@ -457,7 +2139,7 @@ var _ = Describe("Watcher", func() {
 			})
 
 			It("does not emit any more messages", func() {
-				Consistently(ccClient.AppCrashedCallCount).Should(Equal(0))
+				Consistently(ccClient.AppCrashedWithContextCallCount).Should(Equal(0))
 			})
 		})
 	})
@@ -525,3 +2207,91 @@ func makeRemovingActualLRP(processGuid, instanceGuid string, index int32, domain
 
 	return lrp
 }
+
+type eventQueue struct {
+	mu     sync.Mutex
+	events []models.Event
+}
+
+func (q *eventQueue) push(events ...models.Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.events = append(q.events, events...)
+}
+
+func (q *eventQueue) next() (models.Event, error) {
+	time.Sleep(10 * time.Millisecond)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.events) == 0 {
+		return nil, nil
+	}
+	var e models.Event
+	e, q.events = q.events[0], q.events[1:]
+	return e, nil
+}
+
+func streamEvents(eventSource *eventfakes.FakeEventSource, events ...models.Event) *eventQueue {
+	queue := &eventQueue{events: events}
+	eventSource.NextCalls(queue.next)
+	return queue
+}
+
+// blockUntilCanceled returns a stub of a CC client call that hands over its
+// context and blocks until the context is canceled.
+func blockUntilCanceled[R any](contexts chan<- context.Context) func(context.Context, string, R, lager.Logger) error {
+	return func(ctx context.Context, _ string, _ R, _ lager.Logger) error {
+		contexts <- ctx
+		<-ctx.Done()
+		return ctx.Err()
+	}
+}
+
+// blockingEventQueue is an event source that blocks until it is closed.
+type blockingEventQueue struct {
+	closeOnce sync.Once
+	closed    chan struct{}
+	events    chan models.Event
+}
+
+func newBlockingEventQueue() *blockingEventQueue {
+	return &blockingEventQueue{closed: make(chan struct{}), events: make(chan models.Event, 10)}
+}
+
+func (q *blockingEventQueue) push(event models.Event) {
+	q.events <- event
+}
+
+func (q *blockingEventQueue) next() (models.Event, error) {
+	select {
+	case event := <-q.events:
+		return event, nil
+	case <-q.closed:
+		return nil, events.ErrSourceClosed
+	}
+}
+
+func (q *blockingEventQueue) close() error {
+	q.closeOnce.Do(func() { close(q.closed) })
+	return nil
+}
+
+func counterTotal(emitter *fake.FakeEventEmitter, name string) uint64 {
+	var total uint64
+	for _, event := range emitter.GetEvents() {
+		if counter, ok := event.(*sonde_events.CounterEvent); ok && counter.GetName() == name {
+			total += counter.GetDelta()
+		}
+	}
+	return total
+}
+
+func valueEnvelopes(emitter *fake.FakeEventEmitter, name string) []*sonde_events.Envelope {
+	var envelopes []*sonde_events.Envelope
+	for _, envelope := range emitter.GetEnvelopes() {
+		if envelope.GetValueMetric().GetName() == name {
+			envelopes = append(envelopes, envelope)
+		}
+	}
+	return envelopes
+}
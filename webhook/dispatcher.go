@@ -0,0 +1,149 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/tps/lifecycle"
+	"code.cloudfoundry.org/workpool"
+	"github.com/cloudfoundry/dropsonde/metrics"
+)
+
+const (
+	DefaultDeliveryTimeout = 10 * time.Second
+	DefaultWorkPoolSize    = 50
+)
+
+const (
+	webhookDeliveriesCounter       = "WebhookDeliveries"
+	webhookDeliveryFailuresCounter = "WebhookDeliveryFailures"
+)
+
+// Dispatcher delivers app lifecycle events to the targets of the matching
+// webhook subscriptions. Deliveries are not retried.
+type Dispatcher struct {
+	logger      lager.Logger
+	registry    *Registry
+	broadcaster *lifecycle.Broadcaster
+	httpClient  *http.Client
+	pool        *workpool.WorkPool
+}
+
+func NewDispatcher(logger lager.Logger, registry *Registry, broadcaster *lifecycle.Broadcaster, httpClient *http.Client, workPoolSize int) (*Dispatcher, error) {
+	pool, err := workpool.NewWorkPool(workPoolSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Dispatcher{
+		logger:      logger,
+		registry:    registry,
+		broadcaster: broadcaster,
+		httpClient:  httpClient,
+		pool:        pool,
+	}, nil
+}
+
+// Run loads the persisted subscriptions, which may have been changed by
+// another watcher, and delivers events until it is signalled.
+func (d *Dispatcher) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	logger := d.logger.Session("webhook-dispatcher")
+	logger.Info("starting")
+	defer logger.Info("finished")
+
+	err := d.registry.Load()
+	if err != nil {
+		logger.Error("failed-loading-subscriptions", err)
+		return err
+	}
+	logger.Info("loaded-subscriptions", lager.Data{"count": len(d.registry.List())})
+
+	var lastEventID uint64
+	subscription, replay := d.broadcaster.Subscribe(lastEventID, lifecycle.Filter{})
+
+	close(ready)
+	logger.Info("started")
+
+	for {
+		for _, event := range replay {
+			lastEventID = event.ID
+			d.dispatch(logger, event)
+		}
+		replay = nil
+
+		select {
+		case event, ok := <-subscription.Events():
+			if !ok {
+				logger.Info("fell-behind-resubscribing", lager.Data{"last-event-id": lastEventID})
+				subscription, replay = d.broadcaster.Subscribe(lastEventID, lifecycle.Filter{})
+				continue
+			}
+			lastEventID = event.ID
+			d.dispatch(logger, event)
+
+		case <-signals:
+			logger.Info("stopping")
+			subscription.Close()
+			return nil
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(logger lager.Logger, event lifecycle.Event) {
+	for _, s := range d.registry.List() {
+		if !s.matches(event) {
+			continue
+		}
+
+		s := s
+		d.pool.Submit(func() {
+			logger := logger.WithData(lager.Data{
+				"subscription-guid": s.Guid,
+				"event-id":          event.ID,
+				"event-type":        event.Type,
+				"process-guid":      event.ProcessGuid,
+			})
+
+			err := d.deliver(s, event)
+			if err != nil {
+				logger.Error("failed-delivering-webhook", err)
+				metrics.IncrementCounter(webhookDeliveryFailuresCounter)
+				return
+			}
+			logger.Debug("delivered-webhook")
+			metrics.IncrementCounter(webhookDeliveriesCounter)
+		})
+	}
+}
+
+func (d *Dispatcher) deliver(s Subscription, event lifecycle.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", s.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Tps-Subscription-Guid", s.Guid)
+	request.Header.Set("X-Tps-Event-Id", event.StreamID())
+	request.Header.Set("X-Tps-Event-Type", event.Type)
+
+	response, err := d.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook target responded with status %d", response.StatusCode)
+	}
+	return nil
+}
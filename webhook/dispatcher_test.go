@@ -0,0 +1,128 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/tps/lifecycle"
+	"code.cloudfoundry.org/tps/webhook"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+type delivery struct {
+	header http.Header
+	event  lifecycle.Event
+}
+
+var _ = Describe("Dispatcher", func() {
+	var (
+		fakeClock   *fakeclock.FakeClock
+		broadcaster *lifecycle.Broadcaster
+		registry    *webhook.Registry
+		path        string
+		deliveries  chan delivery
+		status      int
+		target      *httptest.Server
+		process     ifrit.Process
+	)
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Unix(100, 0))
+		broadcaster = lifecycle.NewBroadcaster(fakeClock, 10)
+		path = filepath.Join(GinkgoT().TempDir(), "subscriptions.json")
+		registry = webhook.NewRegistry(webhook.NewFileStore(path), fakeClock)
+
+		status = http.StatusOK
+		deliveries = make(chan delivery, 10)
+		target = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			body, err := io.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+
+			var event lifecycle.Event
+			Expect(json.Unmarshal(body, &event)).To(Succeed())
+			deliveries <- delivery{header: r.Header, event: event}
+			w.WriteHeader(status)
+		}))
+	})
+
+	JustBeforeEach(func() {
+		dispatcher, err := webhook.NewDispatcher(lagertest.NewTestLogger("test"), registry, broadcaster, target.Client(), 5)
+		Expect(err).NotTo(HaveOccurred())
+		process = ifrit.Invoke(dispatcher)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+		target.Close()
+	})
+
+	Context("when subscriptions were persisted by another registry", func() {
+		var subscription webhook.Subscription
+
+		BeforeEach(func() {
+			var err error
+			subscription, err = webhook.NewRegistry(webhook.NewFileStore(path), fakeClock).Create(webhook.Subscription{
+				URL:          target.URL + "/hook",
+				EventTypes:   []string{lifecycle.AppCrashed},
+				ProcessGuids: []string{"process-guid"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("loads them and delivers the matching events", func() {
+			Expect(broadcaster.Publish(lifecycle.AppReadinessChanged, "process-guid", "ignored")).To(Succeed())
+			Expect(broadcaster.Publish(lifecycle.AppCrashed, "other-guid", "ignored")).To(Succeed())
+			Expect(broadcaster.Publish(lifecycle.AppCrashed, "process-guid", map[string]int{"index": 1})).To(Succeed())
+
+			var d delivery
+			Eventually(deliveries).Should(Receive(&d))
+			Expect(d.event.ID).To(BeEquivalentTo(3))
+			Expect(d.event.Data).To(MatchJSON(`{"index":1}`))
+			Expect(d.header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(d.header.Get("X-Tps-Subscription-Guid")).To(Equal(subscription.Guid))
+			Expect(d.header.Get("X-Tps-Event-Id")).To(Equal(broadcaster.Epoch() + "-3"))
+			Expect(d.header.Get("X-Tps-Event-Type")).To(Equal(lifecycle.AppCrashed))
+			Consistently(deliveries).ShouldNot(Receive())
+		})
+	})
+
+	It("delivers to subscriptions created while it runs", func() {
+		_, err := registry.Create(webhook.Subscription{URL: target.URL})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(broadcaster.Publish(lifecycle.AppInstanceLost, "process-guid", "lost")).To(Succeed())
+		Eventually(deliveries).Should(Receive())
+	})
+
+	It("keeps delivering when a target fails", func() {
+		status = http.StatusInternalServerError
+		_, err := registry.Create(webhook.Subscription{URL: target.URL})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(broadcaster.Publish(lifecycle.AppCrashed, "process-guid", "first")).To(Succeed())
+		Eventually(deliveries).Should(Receive())
+		Expect(broadcaster.Publish(lifecycle.AppCrashed, "process-guid", "second")).To(Succeed())
+		Eventually(deliveries).Should(Receive())
+	})
+
+	Context("when the registry cannot be loaded", func() {
+		BeforeEach(func() {
+			Expect(os.WriteFile(path, []byte("{"), 0600)).To(Succeed())
+		})
+
+		It("exits with an error", func() {
+			Eventually(process.Wait()).Should(Receive(HaveOccurred()))
+		})
+	})
+})
@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStore persists subscriptions to a local file. The file is only
+// reachable from one VM, so the subscriptions do not follow the lock to
+// another watcher after a failover.
+type FileStore struct {
+	path string
+
+	mu sync.Mutex
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (s *FileStore) List() ([]Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read()
+}
+
+func (s *FileStore) Create(subscription Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.read()
+	if err != nil {
+		return err
+	}
+	return s.write(append(list, subscription))
+}
+
+func (s *FileStore) Delete(guid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	for i := range list {
+		if list[i].Guid == guid {
+			return s.write(append(list[:i], list[i+1:]...))
+		}
+	}
+	return ErrSubscriptionNotFound
+}
+
+// read returns the persisted subscriptions. A missing file holds no
+// subscriptions.
+func (s *FileStore) read() ([]Subscription, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Subscription
+	err = json.Unmarshal(data, &list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// write writes the subscriptions to a temporary file and renames it over the
+// store file, so a crash never leaves a partially written store.
+func (s *FileStore) write(list []Subscription) error {
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"code.cloudfoundry.org/clock"
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+//go:generate counterfeiter -o fakes/fake_store.go . Store
+
+// Store persists webhook subscriptions. Delete returns
+// ErrSubscriptionNotFound when there is no subscription with the guid.
+type Store interface {
+	List() ([]Subscription, error)
+	Create(Subscription) error
+	Delete(guid string) error
+}
+
+// Registry holds the webhook subscriptions in memory for the dispatcher and
+// persists every change to its store. Load replaces them with the persisted
+// ones, so a watcher that takes over the lock picks up the subscriptions
+// created on the previous one when the store is shared. It is safe for
+// concurrent use.
+type Registry struct {
+	store Store
+	clock clock.Clock
+
+	mu            sync.RWMutex
+	subscriptions map[string]Subscription
+}
+
+func NewRegistry(store Store, clock clock.Clock) *Registry {
+	return &Registry{
+		store:         store,
+		clock:         clock,
+		subscriptions: map[string]Subscription{},
+	}
+}
+
+// Load replaces the subscriptions with the persisted ones.
+func (r *Registry) Load() error {
+	list, err := r.store.List()
+	if err != nil {
+		return err
+	}
+
+	subscriptions := make(map[string]Subscription, len(list))
+	for _, s := range list {
+		subscriptions[s.Guid] = s
+	}
+
+	r.mu.Lock()
+	r.subscriptions = subscriptions
+	r.mu.Unlock()
+	return nil
+}
+
+// Create validates and persists a new subscription, assigning its guid and
+// creation time.
+func (r *Registry) Create(s Subscription) (Subscription, error) {
+	err := s.Validate()
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	guid, err := uuid.NewV4()
+	if err != nil {
+		return Subscription{}, err
+	}
+	s.Guid = guid.String()
+	s.CreatedAt = r.clock.Now().UnixNano()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.store.Create(s)
+	if err != nil {
+		return Subscription{}, err
+	}
+	r.subscriptions[s.Guid] = s
+	return s, nil
+}
+
+// List returns the subscriptions ordered by creation time.
+func (r *Registry) List() []Subscription {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]Subscription, 0, len(r.subscriptions))
+	for _, s := range r.subscriptions {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt != list[j].CreatedAt {
+			return list[i].CreatedAt < list[j].CreatedAt
+		}
+		return list[i].Guid < list[j].Guid
+	})
+	return list
+}
+
+// Delete removes the subscription with the given guid.
+func (r *Registry) Delete(guid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.subscriptions[guid]; !ok {
+		return ErrSubscriptionNotFound
+	}
+
+	err := r.store.Delete(guid)
+	if err != nil && !errors.Is(err, ErrSubscriptionNotFound) {
+		return err
+	}
+	delete(r.subscriptions, guid)
+	return nil
+}
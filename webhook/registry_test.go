@@ -0,0 +1,147 @@
+package webhook_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/tps/lifecycle"
+	"code.cloudfoundry.org/tps/webhook"
+	"code.cloudfoundry.org/tps/webhook/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	var (
+		path      string
+		fakeClock *fakeclock.FakeClock
+		registry  *webhook.Registry
+	)
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "subscriptions.json")
+		fakeClock = fakeclock.NewFakeClock(time.Unix(100, 0))
+		registry = webhook.NewRegistry(webhook.NewFileStore(path), fakeClock)
+		Expect(registry.Load()).To(Succeed())
+	})
+
+	It("starts out empty when nothing was persisted", func() {
+		Expect(registry.List()).To(BeEmpty())
+	})
+
+	It("creates, lists and deletes subscriptions", func() {
+		first, err := registry.Create(webhook.Subscription{URL: "https://example.com/hook", EventTypes: []string{lifecycle.AppCrashed}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first.Guid).NotTo(BeEmpty())
+		Expect(first.CreatedAt).To(Equal(fakeClock.Now().UnixNano()))
+
+		fakeClock.Increment(time.Second)
+		second, err := registry.Create(webhook.Subscription{URL: "http://example.com/other", ProcessGuids: []string{"process-guid"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(registry.List()).To(Equal([]webhook.Subscription{first, second}))
+
+		Expect(registry.Delete(first.Guid)).To(Succeed())
+		Expect(registry.List()).To(Equal([]webhook.Subscription{second}))
+		Expect(registry.Delete(first.Guid)).To(MatchError(webhook.ErrSubscriptionNotFound))
+	})
+
+	It("persists subscriptions across registries", func() {
+		created, err := registry.Create(webhook.Subscription{URL: "https://example.com/hook"})
+		Expect(err).NotTo(HaveOccurred())
+
+		reloaded := webhook.NewRegistry(webhook.NewFileStore(path), fakeClock)
+		Expect(reloaded.Load()).To(Succeed())
+		Expect(reloaded.List()).To(Equal([]webhook.Subscription{created}))
+
+		Expect(reloaded.Delete(created.Guid)).To(Succeed())
+		Expect(registry.Load()).To(Succeed())
+		Expect(registry.List()).To(BeEmpty())
+	})
+
+	It("rejects invalid subscriptions", func() {
+		_, err := registry.Create(webhook.Subscription{URL: "/relative"})
+		Expect(err).To(MatchError(webhook.ErrInvalidURL))
+
+		_, err = registry.Create(webhook.Subscription{URL: "ftp://example.com"})
+		Expect(err).To(MatchError(webhook.ErrInvalidURL))
+
+		_, err = registry.Create(webhook.Subscription{URL: "https://example.com", EventTypes: []string{"app_exploded"}})
+		Expect(err).To(MatchError(webhook.ErrUnknownEventType))
+
+		Expect(registry.List()).To(BeEmpty())
+		_, err = os.Stat(path)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("accepts subscriptions to alerts", func() {
+		_, err := registry.Create(webhook.Subscription{URL: "https://example.com/hook", EventTypes: []string{lifecycle.CellUnhealthy, lifecycle.AvailabilityZoneDegraded}})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("fails to load a corrupt registry", func() {
+		Expect(os.WriteFile(path, []byte("{"), 0600)).To(Succeed())
+		Expect(registry.Load()).NotTo(Succeed())
+	})
+
+	It("keeps the subscriptions unchanged when they cannot be persisted", func() {
+		registry = webhook.NewRegistry(webhook.NewFileStore(filepath.Join(path, "missing-dir", "subscriptions.json")), fakeClock)
+		_, err := registry.Create(webhook.Subscription{URL: "https://example.com/hook"})
+		Expect(err).To(HaveOccurred())
+		Expect(registry.List()).To(BeEmpty())
+	})
+
+	Context("when the store is shared with another watcher", func() {
+		var store *fakes.FakeStore
+
+		BeforeEach(func() {
+			store = new(fakes.FakeStore)
+			registry = webhook.NewRegistry(store, fakeClock)
+		})
+
+		It("loads the subscriptions created there", func() {
+			persisted := webhook.Subscription{Guid: "guid", URL: "https://example.com/hook", CreatedAt: 1}
+			store.ListReturns([]webhook.Subscription{persisted}, nil)
+
+			Expect(registry.Load()).To(Succeed())
+			Expect(registry.List()).To(Equal([]webhook.Subscription{persisted}))
+		})
+
+		It("persists every change to the store", func() {
+			created, err := registry.Create(webhook.Subscription{URL: "https://example.com/hook"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(store.CreateCallCount()).To(Equal(1))
+			Expect(store.CreateArgsForCall(0)).To(Equal(created))
+
+			Expect(registry.Delete(created.Guid)).To(Succeed())
+			Expect(store.DeleteCallCount()).To(Equal(1))
+			Expect(store.DeleteArgsForCall(0)).To(Equal(created.Guid))
+		})
+
+		It("forgets a subscription that was already deleted there", func() {
+			created, err := registry.Create(webhook.Subscription{URL: "https://example.com/hook"})
+			Expect(err).NotTo(HaveOccurred())
+
+			store.DeleteReturns(webhook.ErrSubscriptionNotFound)
+			Expect(registry.Delete(created.Guid)).To(Succeed())
+			Expect(registry.List()).To(BeEmpty())
+		})
+
+		It("keeps a subscription that cannot be deleted from the store", func() {
+			created, err := registry.Create(webhook.Subscription{URL: "https://example.com/hook"})
+			Expect(err).NotTo(HaveOccurred())
+
+			store.DeleteReturns(errors.New("boom"))
+			Expect(registry.Delete(created.Guid)).To(MatchError("boom"))
+			Expect(registry.List()).To(Equal([]webhook.Subscription{created}))
+		})
+
+		It("fails to load when the store cannot be read", func() {
+			store.ListReturns(nil, errors.New("boom"))
+			Expect(registry.Load()).To(MatchError("boom"))
+		})
+	})
+})
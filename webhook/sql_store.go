@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// The SQL drivers supported by SQLStore, which are the ones locket supports.
+const (
+	MySQLDriver    = "mysql"
+	PostgresDriver = "postgres"
+)
+
+// SQLStore persists subscriptions to a SQL database, such as the one locket
+// keeps its locks in, so that every watcher that can take the lock shares the
+// same subscriptions.
+type SQLStore struct {
+	db     *sql.DB
+	driver string
+}
+
+func NewSQLStore(db *sql.DB, driver string) (*SQLStore, error) {
+	switch driver {
+	case MySQLDriver, PostgresDriver:
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q: must be %q or %q", driver, MySQLDriver, PostgresDriver)
+	}
+	return &SQLStore{db: db, driver: driver}, nil
+}
+
+// CreateTable creates the subscriptions table unless it already exists.
+func (s *SQLStore) CreateTable() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+		guid VARCHAR(255) PRIMARY KEY,
+		subscription TEXT NOT NULL,
+		created_at BIGINT NOT NULL
+	)`)
+	return err
+}
+
+func (s *SQLStore) List() ([]Subscription, error) {
+	rows, err := s.db.Query(`SELECT subscription FROM webhook_subscriptions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Subscription
+	for rows.Next() {
+		var data []byte
+		err = rows.Scan(&data)
+		if err != nil {
+			return nil, err
+		}
+
+		var subscription Subscription
+		err = json.Unmarshal(data, &subscription)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, subscription)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) Create(subscription Subscription) error {
+	data, err := json.Marshal(subscription)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(s.rebind(`INSERT INTO webhook_subscriptions (guid, subscription, created_at) VALUES (?, ?, ?)`),
+		subscription.Guid, string(data), subscription.CreatedAt)
+	return err
+}
+
+func (s *SQLStore) Delete(guid string) error {
+	result, err := s.db.Exec(s.rebind(`DELETE FROM webhook_subscriptions WHERE guid = ?`), guid)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// rebind replaces the ? placeholders of the query with the numbered ones
+// postgres expects.
+func (s *SQLStore) rebind(query string) string {
+	if s.driver != PostgresDriver {
+		return query
+	}
+
+	rebound := make([]byte, 0, len(query)+8)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' {
+			rebound = append(rebound, query[i])
+			continue
+		}
+		n++
+		rebound = append(rebound, fmt.Sprintf("$%d", n)...)
+	}
+	return string(rebound)
+}
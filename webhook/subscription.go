@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"code.cloudfoundry.org/tps/lifecycle"
+)
+
+var (
+	ErrInvalidURL       = errors.New("target url must be an absolute http or https url")
+	ErrUnknownEventType = errors.New("unknown event type")
+)
+
+// Subscription delivers the app lifecycle events of the given types, or of
+// every type if EventTypes is empty, and of the given process guids, or of
+// every app if ProcessGuids is empty, to the target URL.
+type Subscription struct {
+	Guid         string   `json:"guid"`
+	URL          string   `json:"url"`
+	EventTypes   []string `json:"event_types,omitempty"`
+	ProcessGuids []string `json:"process_guids,omitempty"`
+	CreatedAt    int64    `json:"created_at"`
+}
+
+// Validate checks that the subscription has a deliverable target and only
+// names known event types.
+func (s Subscription) Validate() error {
+	target, err := url.Parse(s.URL)
+	if err != nil || !target.IsAbs() || target.Host == "" || (target.Scheme != "http" && target.Scheme != "https") {
+		return ErrInvalidURL
+	}
+
+	for _, eventType := range s.EventTypes {
+		if !knownEventType(eventType) {
+			return fmt.Errorf("%w: %s", ErrUnknownEventType, eventType)
+		}
+	}
+	return nil
+}
+
+func (s Subscription) matches(event lifecycle.Event) bool {
+	return contains(s.EventTypes, event.Type) && contains(s.ProcessGuids, event.ProcessGuid)
+}
+
+// contains returns whether value is in values; an empty list contains every
+// value.
+func contains(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func knownEventType(eventType string) bool {
+	for _, t := range lifecycle.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}